@@ -15,6 +15,8 @@ import (
 )
 
 func main() {
+	reloadCh := make(chan struct{})
+
 	app := &cli.App{
 		Usage:     "Create a personal link shortening service",
 		ArgsUsage: " ",
@@ -37,13 +39,48 @@ func main() {
 					return cliActions.InitializeConfigFile(cfgPath)
 				},
 			},
+			{
+				Name:     "config",
+				Usage:    "Inspect and validate the configuration",
+				Category: "Configuration",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "show",
+						Usage: "Print the config after applying environment overrides",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "redacted",
+								Usage: "hide secret values",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							cfgPath := c.Value("config").(string)
+							return cliActions.ShowConfig(cfgPath, c.Bool("redacted"))
+						},
+					},
+					{
+						Name:  "check",
+						Usage: "Validate the config and report every problem found",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "skip-database",
+								Usage: "do not try to connect to the database",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							cfgPath := c.Value("config").(string)
+							return cliActions.CheckConfig(c.Context, cfgPath, c.Bool("skip-database"))
+						},
+					},
+				},
+			},
 			{
 				Name:     "start",
 				Usage:    "Start the web server",
 				Category: "Server",
 				Action: func(c *cli.Context) error {
 					cfgPath := c.Value("config").(string)
-					return cliActions.StartServer(c.Context, cfgPath)
+					return cliActions.StartServer(c.Context, cfgPath, reloadCh)
 				},
 			},
 			{
@@ -60,20 +97,66 @@ func main() {
 				Name:     "usermod",
 				Usage:    "Modify user details",
 				Category: "User management",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "role",
+						Usage: "set the role (viewer, creator, moderator, admin) without prompting",
+					},
+				},
 				Action: func(c *cli.Context) error {
 					cfgPath := c.Value("config").(string)
 					username := c.Args().First()
-					return cliActions.ModifyUser(c.Context, cfgPath, username)
+					return cliActions.ModifyUser(c.Context, cfgPath, username, c.String("role"))
 				},
 			},
 			{
 				Name:     "userdel",
 				Usage:    "Delete a user",
 				Category: "User management",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "reassign-to",
+						Usage: "give the user's links to another user",
+					},
+					&cli.StringFlag{
+						Name:  "reassign-to-team",
+						Usage: "give the user's links to a team",
+					},
+				},
 				Action: func(c *cli.Context) error {
 					cfgPath := c.Value("config").(string)
 					username := c.Args().First()
-					return cliActions.DeleteUser(c.Context, cfgPath, username)
+					return cliActions.DeleteUser(c.Context, cfgPath, username, c.String("reassign-to"), c.String("reassign-to-team"))
+				},
+			},
+			{
+				Name:     "userinfo",
+				Usage:    "Show account status and recent login attempts",
+				Category: "User management",
+				Action: func(c *cli.Context) error {
+					cfgPath := c.Value("config").(string)
+					username := c.Args().First()
+					return cliActions.ShowUserInfo(c.Context, cfgPath, username)
+				},
+			},
+			{
+				Name:     "userunlock",
+				Usage:    "Unlock a locked user account",
+				Category: "User management",
+				Action: func(c *cli.Context) error {
+					cfgPath := c.Value("config").(string)
+					username := c.Args().First()
+					return cliActions.UnlockUser(c.Context, cfgPath, username)
+				},
+			},
+			{
+				Name:     "user2fareset",
+				Usage:    "Disable two-factor authentication and sign out a user",
+				Category: "User management",
+				Action: func(c *cli.Context) error {
+					cfgPath := c.Value("config").(string)
+					username := c.Args().First()
+					return cliActions.ResetUserTwoFactor(c.Context, cfgPath, username)
 				},
 			},
 		},
@@ -89,6 +172,18 @@ func main() {
 		fmt.Printf("\nWarm shutdown. Please wait.\n")
 	}()
 
+	sighupCh := make(chan os.Signal, 1)
+	signal.Notify(sighupCh, syscall.SIGHUP)
+
+	go func() {
+		for range sighupCh {
+			select {
+			case reloadCh <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
 	err := app.RunContext(ctx, os.Args)
 	if err != nil {
 		fmt.Println(err)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -14,38 +15,139 @@ type Config struct {
 	URLPrefix    string `yaml:"url_prefix,omitempty"`
 	HomeRedirect string `yaml:"home_redirect,omitempty"`
 
+	Log struct {
+		Level  string `yaml:"level,omitempty"`
+		Format string `yaml:"format,omitempty"`
+	} `yaml:"log,omitempty"`
+
 	Codec struct {
 		Alphabet  string `yaml:"alphabet"`
 		BlockSize int    `yaml:"block_size"`
 	} `yaml:"codec"`
 
 	Database struct {
-		Type      string            `yaml:"type"`
-		Host      string            `yaml:"host,omitempty"`
-		Port      uint16            `yaml:"port,omitempty"`
-		Username  string            `yaml:"username,omitempty"`
-		Password  string            `yaml:"password,omitempty"`
-		Name      string            `yaml:"name,omitempty"`
-		ExtraArgs map[string]string `yaml:"extra_args,omitempty"`
+		Type         string            `yaml:"type"`
+		Host         string            `yaml:"host,omitempty"`
+		Port         uint16            `yaml:"port,omitempty"`
+		Username     string            `yaml:"username,omitempty"`
+		Password     string            `yaml:"password,omitempty" secret:"true"`
+		PasswordFile string            `yaml:"password_file,omitempty"`
+		Name         string            `yaml:"name,omitempty"`
+		URL          string            `yaml:"url,omitempty" secret:"true"`
+		ExtraArgs    map[string]string `yaml:"extra_args,omitempty" secret:"true"`
+		SQLite       SQLiteOptions     `yaml:"sqlite,omitempty"`
+
+		SSLMode     string `yaml:"ssl_mode,omitempty"`
+		SSLRootCert string `yaml:"ssl_root_cert,omitempty"`
+		SSLCert     string `yaml:"ssl_cert,omitempty"`
+		SSLKey      string `yaml:"ssl_key,omitempty"`
+
+		MaxOpenConns     int           `yaml:"max_open_conns,omitempty"`
+		MaxIdleConns     int           `yaml:"max_idle_conns,omitempty"`
+		ConnMaxLifetime  time.Duration `yaml:"conn_max_lifetime,omitempty"`
+		StatementTimeout time.Duration `yaml:"statement_timeout,omitempty"`
+		QueryTimeout     time.Duration `yaml:"query_timeout,omitempty"`
+		ConnectTimeout   time.Duration `yaml:"connect_timeout,omitempty"`
+
+		Replicas       []string      `yaml:"replicas,omitempty" secret:"true"`
+		ReplicaMaxLag  time.Duration `yaml:"replica_max_lag,omitempty"`
+		ReadYourWrites bool          `yaml:"read_your_writes,omitempty"`
 	} `yaml:"database"`
 
 	Server struct {
 		Host string `yaml:"host"`
 		Port uint16 `yaml:"port"`
 
+		TrustedProxies  []string `yaml:"trusted_proxies,omitempty"`
+		ClientIPHeaders []string `yaml:"client_ip_headers,omitempty"`
+
 		UseTLS         bool   `yaml:"use_tls"`
 		TLSCertificate string `yaml:"tls_certificate,omitempty"`
 		TLSPrivateKey  string `yaml:"tls_private_key,omitempty"`
 
+		UseACME          bool     `yaml:"use_acme,omitempty"`
+		ACMEDirectoryURL string   `yaml:"acme_directory_url,omitempty"`
+		ACMERootCA       string   `yaml:"acme_root_ca,omitempty"`
+		ACMEEmail        string   `yaml:"acme_email,omitempty"`
+		ACMECacheDir     string   `yaml:"acme_cache_dir,omitempty"`
+		ACMEHosts        []string `yaml:"acme_hosts,omitempty"`
+		ACMEHTTPPort     uint16   `yaml:"acme_http_port,omitempty"`
+
 		UseCache      bool `yaml:"use_cache,omitempty"`
 		CacheCapacity uint `yaml:"cache_capacity,omitempty"`
 
 		UseCORS     bool     `yaml:"use_cors,omitempty"`
 		CORSOrigins []string `yaml:"cors_origins,omitempty"`
+
+		UseMetrics    bool   `yaml:"use_metrics,omitempty"`
+		MetricsListen string `yaml:"metrics_listen,omitempty"`
+		MetricsToken  string `yaml:"metrics_token,omitempty" secret:"true"`
+
+		ReadTimeout     time.Duration `yaml:"read_timeout,omitempty"`
+		WriteTimeout    time.Duration `yaml:"write_timeout,omitempty"`
+		IdleTimeout     time.Duration `yaml:"idle_timeout,omitempty"`
+		ShutdownTimeout time.Duration `yaml:"shutdown_timeout,omitempty"`
 	} `yaml:"server"`
+
+	Auth struct {
+		MaxFailedAttempts   uint          `yaml:"max_failed_attempts"`
+		LockoutDuration     time.Duration `yaml:"lockout_duration"`
+		LoginEventRetention time.Duration `yaml:"login_event_retention"`
+		SessionLifetime     time.Duration `yaml:"session_lifetime"`
+	} `yaml:"auth,omitempty"`
+
+	OIDC struct {
+		Enabled       bool     `yaml:"enabled"`
+		IssuerURL     string   `yaml:"issuer_url,omitempty"`
+		ClientID      string   `yaml:"client_id,omitempty"`
+		ClientSecret  string   `yaml:"client_secret,omitempty" secret:"true"`
+		RedirectURL   string   `yaml:"redirect_url,omitempty"`
+		Scopes        []string `yaml:"scopes,omitempty"`
+		UsernameClaim string   `yaml:"username_claim,omitempty"`
+		GroupsClaim   string   `yaml:"groups_claim,omitempty"`
+		AdminGroups   []string `yaml:"admin_groups,omitempty"`
+		LinkExisting  bool     `yaml:"link_existing,omitempty"`
+		ProviderName  string   `yaml:"provider_name,omitempty"`
+	} `yaml:"oidc,omitempty"`
+
+	RateLimit struct {
+		Enabled      bool            `yaml:"enabled"`
+		Backend      string          `yaml:"backend,omitempty"`
+		API          RateLimitPolicy `yaml:"api,omitempty"`
+		AuthFailures RateLimitPolicy `yaml:"auth_failures,omitempty"`
+		LinkCreation RateLimitPolicy `yaml:"link_creation,omitempty"`
+		Redirects    RateLimitPolicy `yaml:"redirects,omitempty"`
+	} `yaml:"rate_limit,omitempty"`
+}
+
+type SQLiteOptions struct {
+	JournalMode  string        `yaml:"journal_mode,omitempty"`
+	Synchronous  string        `yaml:"synchronous,omitempty"`
+	BusyTimeout  time.Duration `yaml:"busy_timeout,omitempty"`
+	CacheSize    int           `yaml:"cache_size,omitempty"`
+	MaxOpenConns int           `yaml:"max_open_conns,omitempty"`
+}
+
+type RateLimitPolicy struct {
+	Requests uint          `yaml:"requests"`
+	Period   time.Duration `yaml:"period"`
+	Burst    uint          `yaml:"burst,omitempty"`
 }
 
 func LoadConfigFromFile(configPath string) (*Config, error) {
+	conf, err := ReadConfigFromFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = validateConfigValues(conf); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return conf, nil
+}
+
+func ReadConfigFromFile(configPath string) (*Config, error) {
 	var err error
 
 	cleanedConfigPath, err := filepath.Abs(filepath.Clean(configPath))
@@ -59,17 +161,26 @@ func LoadConfigFromFile(configPath string) (*Config, error) {
 	}
 	defer func() { _ = file.Close() }()
 
-	var conf *Config
+	var conf Config
+	conf.Auth.MaxFailedAttempts = defaultMaxFailedAttempts
+	conf.Auth.LockoutDuration = defaultLockoutDuration
+
 	decoder := yaml.NewDecoder(file)
 	if err = decoder.Decode(&conf); err != nil {
 		return nil, err
 	}
 
-	if err = validateConfigValues(conf); err != nil {
+	if err = applyEnvOverrides(&conf); err != nil {
+		return nil, fmt.Errorf("invalid environment: %w", err)
+	}
+
+	if err = applyFileIndirections(&conf); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	return conf, nil
+	applyDefaultValues(&conf)
+
+	return &conf, nil
 }
 
 func WriteConfigToFile(configPath string, conf *Config) error {
@@ -0,0 +1,166 @@
+package cfg
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const EnvPrefix = "SLS"
+
+const redactedValue = "<redacted>"
+
+func applyEnvOverrides(conf *Config) error {
+	return walkConfigFields(reflect.ValueOf(conf).Elem(), EnvPrefix, func(field reflect.Value, _ reflect.StructField, envKey string) error {
+		if path, ok := os.LookupEnv(envKey + "_FILE"); ok {
+			value, err := readSecretFile(path)
+			if err != nil {
+				return fmt.Errorf("%s_FILE: %w", envKey, err)
+			}
+			return setFieldFromString(field, value, envKey+"_FILE")
+		}
+		if value, ok := os.LookupEnv(envKey); ok {
+			return setFieldFromString(field, value, envKey)
+		}
+		return nil
+	})
+}
+
+func applyFileIndirections(conf *Config) error {
+	if conf.Database.PasswordFile != "" {
+		value, err := readSecretFile(conf.Database.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("database: password_file: %w", err)
+		}
+		conf.Database.Password = value
+	}
+	return nil
+}
+
+func Redacted(conf *Config) *Config {
+	clone := *conf
+	_ = walkConfigFields(reflect.ValueOf(&clone).Elem(), EnvPrefix, func(field reflect.Value, sf reflect.StructField, _ string) error {
+		if sf.Tag.Get("secret") != "true" {
+			return nil
+		}
+		if field.Kind() == reflect.String && field.String() != "" {
+			field.SetString(redactedValue)
+		}
+		if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String && field.Len() > 0 {
+			items := make([]string, field.Len())
+			for i := range items {
+				items[i] = redactedValue
+			}
+			field.Set(reflect.ValueOf(items))
+		}
+		if field.Kind() == reflect.Map && field.Len() > 0 {
+			items := make(map[string]string, field.Len())
+			for _, key := range field.MapKeys() {
+				items[key.String()] = redactedValue
+			}
+			field.Set(reflect.ValueOf(items))
+		}
+		return nil
+	})
+	return &clone
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("can not read file: %s", path)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func walkConfigFields(v reflect.Value, prefix string, visit func(reflect.Value, reflect.StructField, string) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + "_" + strings.ToUpper(name)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := walkConfigFields(field, key, visit); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := visit(field, sf, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setFieldFromString(field reflect.Value, value string, source string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid duration '%s'", source, value)
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid boolean '%s'", source, value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%s: invalid integer '%s'", source, value)
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%s: invalid unsigned integer '%s'", source, value)
+		}
+		field.SetUint(n)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("%s: unsupported field type", source)
+		}
+		items := splitList(value)
+		field.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		if field.Type().Key().Kind() != reflect.String || field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("%s: unsupported field type", source)
+		}
+		m := make(map[string]string)
+		for _, item := range splitList(value) {
+			k, v, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("%s: expected key=value pairs, got '%s'", source, item)
+			}
+			m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+		field.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("%s: unsupported field type", source)
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,9 +1,67 @@
 package cfg
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	minAlphabetLength = 16
+	maxBlockSize      = 32
+
+	defaultReadTimeout     = 15 * time.Second
+	defaultWriteTimeout    = 30 * time.Second
+	defaultIdleTimeout     = 120 * time.Second
+	defaultShutdownTimeout = 30 * time.Second
+
+	defaultLogLevel  = "info"
+	defaultLogFormat = "text"
+
+	defaultACMECacheDir = "acme-cache"
+	defaultACMEHTTPPort = 80
+
+	defaultMaxFailedAttempts   = 5
+	defaultLockoutDuration     = 15 * time.Minute
+	defaultLoginEventRetention = 90 * 24 * time.Hour
+	defaultSessionLifetime     = 24 * time.Hour
+
+	defaultRateLimitBackend = "memory"
+
+	defaultSQLiteJournalMode  = "WAL"
+	defaultSQLiteSynchronous  = "NORMAL"
+	defaultSQLiteBusyTimeout  = 5 * time.Second
+	defaultSQLiteCacheSize    = -16000
+	defaultSQLiteMaxOpenConns = 4
+
+	defaultDBMaxOpenConns     = 20
+	defaultDBMaxIdleConns     = 5
+	defaultDBConnMaxLifetime  = 30 * time.Minute
+	defaultDBStatementTimeout = 10 * time.Second
+	defaultDBQueryTimeout     = 10 * time.Second
+	defaultDBConnectTimeout   = 30 * time.Second
+	defaultDBReplicaMaxLag    = 10 * time.Second
+
+	defaultOIDCUsernameClaim = "preferred_username"
+	defaultOIDCGroupsClaim   = "groups"
+)
+
+const (
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderXRealIP       = "X-Real-IP"
+	HeaderForwarded     = "Forwarded"
 )
 
 func CreateRandomAlphabet() string {
@@ -15,56 +73,608 @@ func CreateRandomAlphabet() string {
 	return string(runes)
 }
 
-func validateConfigValues(conf *Config) error {
-	if conf.Database.Type == "postgresql" {
-		if conf.Database.Host == "" {
-			return errors.New("database: host required")
+func applyDefaultValues(conf *Config) {
+	if conf.Log.Level == "" {
+		conf.Log.Level = defaultLogLevel
+	}
+
+	if conf.Log.Format == "" {
+		conf.Log.Format = defaultLogFormat
+	}
+
+	if conf.Database.Type == "postgresql" || conf.Database.Type == "mysql" {
+		if conf.Database.MaxOpenConns == 0 {
+			conf.Database.MaxOpenConns = defaultDBMaxOpenConns
 		}
 
-		if conf.Database.Port == 0 {
-			return errors.New("database: port required")
+		if conf.Database.MaxIdleConns == 0 {
+			conf.Database.MaxIdleConns = defaultDBMaxIdleConns
 		}
 
-		if conf.Database.Username == "" {
-			return errors.New("database: username required")
+		if conf.Database.ConnMaxLifetime == 0 {
+			conf.Database.ConnMaxLifetime = defaultDBConnMaxLifetime
 		}
 
-		if conf.Database.Password == "" {
-			return errors.New("database: password required")
+		if conf.Database.ConnectTimeout == 0 {
+			conf.Database.ConnectTimeout = defaultDBConnectTimeout
 		}
+	}
 
-		if conf.Database.Name == "" {
-			return errors.New("database: name required")
+	if conf.Database.Type == "postgresql" && conf.Database.StatementTimeout == 0 {
+		conf.Database.StatementTimeout = defaultDBStatementTimeout
+	}
+
+	if len(conf.Database.Replicas) > 0 && conf.Database.ReplicaMaxLag == 0 {
+		conf.Database.ReplicaMaxLag = defaultDBReplicaMaxLag
+	}
+
+	if conf.Database.QueryTimeout == 0 {
+		conf.Database.QueryTimeout = defaultDBQueryTimeout
+	}
+
+	if conf.Database.Type == "sqlite3" {
+		if conf.Database.SQLite.JournalMode == "" {
+			conf.Database.SQLite.JournalMode = defaultSQLiteJournalMode
+		}
+
+		if conf.Database.SQLite.Synchronous == "" {
+			conf.Database.SQLite.Synchronous = defaultSQLiteSynchronous
+		}
+
+		if conf.Database.SQLite.BusyTimeout == 0 {
+			conf.Database.SQLite.BusyTimeout = defaultSQLiteBusyTimeout
+		}
+
+		if conf.Database.SQLite.CacheSize == 0 {
+			conf.Database.SQLite.CacheSize = defaultSQLiteCacheSize
+		}
+
+		if conf.Database.SQLite.MaxOpenConns == 0 {
+			conf.Database.SQLite.MaxOpenConns = defaultSQLiteMaxOpenConns
+		}
+	}
+
+	if conf.Server.ReadTimeout == 0 {
+		conf.Server.ReadTimeout = defaultReadTimeout
+	}
+
+	if conf.Server.WriteTimeout == 0 {
+		conf.Server.WriteTimeout = defaultWriteTimeout
+	}
+
+	if conf.Server.IdleTimeout == 0 {
+		conf.Server.IdleTimeout = defaultIdleTimeout
+	}
+
+	if conf.Server.ShutdownTimeout == 0 {
+		conf.Server.ShutdownTimeout = defaultShutdownTimeout
+	}
+
+	if len(conf.Server.TrustedProxies) > 0 && len(conf.Server.ClientIPHeaders) == 0 {
+		conf.Server.ClientIPHeaders = []string{HeaderXForwardedFor, HeaderXRealIP}
+	}
+
+	if conf.Auth.LoginEventRetention == 0 {
+		conf.Auth.LoginEventRetention = defaultLoginEventRetention
+	}
+
+	if conf.Auth.SessionLifetime == 0 {
+		conf.Auth.SessionLifetime = defaultSessionLifetime
+	}
+
+	if conf.OIDC.Enabled {
+		if len(conf.OIDC.Scopes) == 0 {
+			conf.OIDC.Scopes = []string{"openid", "profile", "email"}
+		}
+
+		if conf.OIDC.UsernameClaim == "" {
+			conf.OIDC.UsernameClaim = defaultOIDCUsernameClaim
+		}
+
+		if conf.OIDC.GroupsClaim == "" {
+			conf.OIDC.GroupsClaim = defaultOIDCGroupsClaim
+		}
+	}
+
+	if conf.RateLimit.Enabled {
+		if conf.RateLimit.Backend == "" {
+			conf.RateLimit.Backend = defaultRateLimitBackend
+		}
+
+		setDefaultPolicy(&conf.RateLimit.API, RateLimitPolicy{Requests: 300, Period: time.Minute})
+		setDefaultPolicy(&conf.RateLimit.AuthFailures, RateLimitPolicy{Requests: 10, Period: 15 * time.Minute})
+		setDefaultPolicy(&conf.RateLimit.LinkCreation, RateLimitPolicy{Requests: 60, Period: time.Hour, Burst: 10})
+		setDefaultPolicy(&conf.RateLimit.Redirects, RateLimitPolicy{Requests: 600, Period: time.Minute})
+	}
+
+	if conf.Server.UseACME {
+		if conf.Server.ACMEDirectoryURL == "" {
+			conf.Server.ACMEDirectoryURL = autocert.DefaultACMEDirectory
+		}
+
+		if conf.Server.ACMECacheDir == "" {
+			conf.Server.ACMECacheDir = defaultACMECacheDir
+		}
+
+		if conf.Server.ACMEHTTPPort == 0 {
+			conf.Server.ACMEHTTPPort = defaultACMEHTTPPort
+		}
+
+		if len(conf.Server.ACMEHosts) == 0 {
+			conf.Server.ACMEHosts = deriveACMEHosts(conf)
 		}
-	} else if conf.Database.Type == "sqlite3" {
+	}
+}
+
+func setDefaultPolicy(policy *RateLimitPolicy, defaultPolicy RateLimitPolicy) {
+	if policy.Period == 0 {
+		*policy = defaultPolicy
+	}
+}
+
+func deriveACMEHosts(conf *Config) []string {
+	if conf.URLPrefix != "" {
+		if parsedURL, err := url.Parse(conf.URLPrefix); err == nil && parsedURL.Hostname() != "" {
+			return []string{parsedURL.Hostname()}
+		}
+	}
+	if conf.Server.Host != "" && net.ParseIP(conf.Server.Host) == nil {
+		return []string{conf.Server.Host}
+	}
+	return nil
+}
+
+func validateConfigValues(conf *Config) error {
+	if problems := checkRequiredValues(conf); len(problems) > 0 {
+		return problems[0]
+	}
+	return nil
+}
+
+func DiagnoseConfig(conf *Config) []error {
+	problems := checkRequiredValues(conf)
+	problems = append(problems, checkCodecValues(conf)...)
+	problems = append(problems, checkURLValues(conf)...)
+	problems = append(problems, checkTLSFiles(conf)...)
+	problems = append(problems, checkDatabaseTLSFiles(conf)...)
+	return problems
+}
+
+func checkRequiredValues(conf *Config) []error {
+	var problems []error
+
+	if conf.Database.Type == "postgresql" || conf.Database.Type == "mysql" {
+		problems = append(problems, checkServerDatabaseValues(conf)...)
+	} else if conf.Database.Type == "sqlite3" || conf.Database.Type == "bolt" {
 		if conf.Database.Name == "" {
-			return errors.New("database: name (sqlite3 file path) required")
+			problems = append(problems, fmt.Errorf("database: name (%s file path) required", conf.Database.Type))
+		}
+	} else if conf.Database.Type != "memory" {
+		problems = append(problems, fmt.Errorf("database: invalid type '%s'", conf.Database.Type))
+	}
+
+	if conf.Database.URL != "" && conf.Database.Type != "postgresql" && conf.Database.Type != "mysql" {
+		problems = append(problems, errors.New("database: url is only supported for postgresql and mysql"))
+	}
+
+	if len(conf.Database.Replicas) > 0 && conf.Database.Type != "postgresql" {
+		problems = append(problems, errors.New("database: replicas are only supported for postgresql"))
+	}
+
+	for i, replica := range conf.Database.Replicas {
+		if u, err := url.Parse(replica); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			problems = append(problems, fmt.Errorf("database: replica %d must be a postgres:// or postgresql:// URL", i+1))
+		}
+	}
+
+	if conf.Database.ReplicaMaxLag < 0 {
+		problems = append(problems, errors.New("database: replica_max_lag must not be negative"))
+	}
+
+	if conf.Database.Type != "postgresql" && (conf.Database.SSLMode != "" || conf.Database.SSLRootCert != "" || conf.Database.SSLCert != "" || conf.Database.SSLKey != "") {
+		problems = append(problems, errors.New("database: ssl options are only supported for postgresql"))
+	}
+
+	if conf.Database.SSLMode != "" && !slices.Contains([]string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}, conf.Database.SSLMode) {
+		problems = append(problems, fmt.Errorf("database: invalid ssl_mode '%s'", conf.Database.SSLMode))
+	}
+
+	if (conf.Database.SSLCert == "") != (conf.Database.SSLKey == "") {
+		problems = append(problems, errors.New("database: ssl_cert and ssl_key must be set together"))
+	}
+
+	if conf.Database.MaxOpenConns < 0 {
+		problems = append(problems, errors.New("database: max_open_conns must not be negative"))
+	}
+
+	if conf.Database.MaxIdleConns < 0 {
+		problems = append(problems, errors.New("database: max_idle_conns must not be negative"))
+	}
+
+	if conf.Database.ConnMaxLifetime < 0 {
+		problems = append(problems, errors.New("database: conn_max_lifetime must not be negative"))
+	}
+
+	if conf.Database.StatementTimeout < 0 {
+		problems = append(problems, errors.New("database: statement_timeout must not be negative"))
+	}
+
+	if conf.Database.QueryTimeout < 0 {
+		problems = append(problems, errors.New("database: query_timeout must not be negative"))
+	}
+
+	if conf.Database.ConnectTimeout < 0 {
+		problems = append(problems, errors.New("database: connect_timeout must not be negative"))
+	}
+
+	if conf.Database.Type == "sqlite3" {
+		sqlite := conf.Database.SQLite
+		if sqlite.JournalMode != "" && !slices.Contains([]string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}, strings.ToUpper(sqlite.JournalMode)) {
+			problems = append(problems, fmt.Errorf("database: invalid sqlite journal_mode '%s'", sqlite.JournalMode))
+		}
+
+		if sqlite.Synchronous != "" && !slices.Contains([]string{"OFF", "NORMAL", "FULL", "EXTRA"}, strings.ToUpper(sqlite.Synchronous)) {
+			problems = append(problems, fmt.Errorf("database: invalid sqlite synchronous '%s'", sqlite.Synchronous))
+		}
+
+		if sqlite.BusyTimeout < 0 {
+			problems = append(problems, errors.New("database: sqlite busy_timeout must not be negative"))
+		}
+
+		if sqlite.MaxOpenConns < 0 {
+			problems = append(problems, errors.New("database: sqlite max_open_conns must not be negative"))
 		}
-	} else {
-		return fmt.Errorf("database: invalid type '%s'", conf.Database.Type)
 	}
 
-	if conf.Server.UseTLS {
+	if !slices.Contains([]string{"debug", "info", "warn", "error"}, conf.Log.Level) {
+		problems = append(problems, fmt.Errorf("log: invalid level '%s'", conf.Log.Level))
+	}
+
+	if !slices.Contains([]string{"text", "json"}, conf.Log.Format) {
+		problems = append(problems, fmt.Errorf("log: invalid format '%s'", conf.Log.Format))
+	}
+
+	for _, proxy := range conf.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			problems = append(problems, fmt.Errorf("server: trusted proxy '%s' is not a valid IP or CIDR", proxy))
+		}
+	}
+
+	for _, header := range conf.Server.ClientIPHeaders {
+		if !slices.ContainsFunc([]string{HeaderXForwardedFor, HeaderXRealIP, HeaderForwarded}, func(h string) bool {
+			return strings.EqualFold(h, header)
+		}) {
+			problems = append(problems, fmt.Errorf("server: unsupported client ip header '%s'", header))
+		}
+	}
+
+	if conf.Server.UseTLS && !conf.Server.UseACME {
 		if conf.Server.TLSCertificate == "" {
-			return errors.New("server: tls_certificate required for use_tls")
+			problems = append(problems, errors.New("server: tls_certificate required for use_tls"))
 		}
 
 		if conf.Server.TLSPrivateKey == "" {
-			return errors.New("server: tls_private_key required for use_tls")
+			problems = append(problems, errors.New("server: tls_private_key required for use_tls"))
+		}
+	}
+
+	if conf.Server.UseACME {
+		if !conf.Server.UseTLS {
+			problems = append(problems, errors.New("server: use_tls required for use_acme"))
+		}
+
+		if len(conf.Server.ACMEHosts) == 0 {
+			problems = append(problems, errors.New("server: acme_hosts required when host is not a domain name"))
+		}
+
+		if conf.Server.ACMEHTTPPort == conf.Server.Port {
+			problems = append(problems, errors.New("server: acme_http_port must differ from port"))
 		}
 	}
 
 	if conf.Server.UseCORS {
 		if len(conf.Server.CORSOrigins) < 1 {
-			return errors.New("server: at least 1 cors_origin entry required for use_cors")
+			problems = append(problems, errors.New("server: at least 1 cors_origin entry required for use_cors"))
 		}
 	}
 
 	if conf.Server.UseCache {
 		if conf.Server.CacheCapacity < 1 {
-			return errors.New("server: cache_capacity should be a positive integer")
+			problems = append(problems, errors.New("server: cache_capacity should be a positive integer"))
+		}
+	}
+
+	if conf.Server.UseMetrics {
+		if conf.Server.MetricsListen == "" && conf.Server.MetricsToken == "" {
+			problems = append(problems, errors.New("server: metrics_listen or metrics_token required for use_metrics"))
+		}
+	}
+
+	if conf.Auth.LockoutDuration < 0 || conf.Auth.LoginEventRetention < 0 || conf.Auth.SessionLifetime < 0 {
+		problems = append(problems, errors.New("auth: durations must not be negative"))
+	}
+
+	if conf.OIDC.Enabled {
+		if !isAbsoluteHTTPURL(conf.OIDC.IssuerURL) {
+			problems = append(problems, errors.New("oidc: issuer_url must be an absolute http(s) URL"))
+		}
+
+		if conf.OIDC.ClientID == "" {
+			problems = append(problems, errors.New("oidc: client_id is required"))
+		}
+
+		if conf.OIDC.RedirectURL != "" && !isAbsoluteHTTPURL(conf.OIDC.RedirectURL) {
+			problems = append(problems, errors.New("oidc: redirect_url must be an absolute http(s) URL"))
+		}
+
+		if !slices.Contains(conf.OIDC.Scopes, "openid") {
+			problems = append(problems, errors.New("oidc: scopes must include 'openid'"))
+		}
+	}
+
+	if conf.RateLimit.Enabled {
+		if conf.RateLimit.Backend != "memory" {
+			problems = append(problems, fmt.Errorf("rate_limit: unsupported backend '%s'", conf.RateLimit.Backend))
+		}
+
+		if conf.RateLimit.API.Period < 0 || conf.RateLimit.AuthFailures.Period < 0 ||
+			conf.RateLimit.LinkCreation.Period < 0 || conf.RateLimit.Redirects.Period < 0 {
+			problems = append(problems, errors.New("rate_limit: periods must not be negative"))
+		}
+	}
+
+	if conf.Server.ReadTimeout < 0 || conf.Server.WriteTimeout < 0 || conf.Server.IdleTimeout < 0 || conf.Server.ShutdownTimeout < 0 {
+		problems = append(problems, errors.New("server: timeouts must not be negative"))
+	}
+
+	return problems
+}
+
+func checkServerDatabaseValues(conf *Config) []error {
+	var problems []error
+
+	if conf.Database.URL != "" {
+		if conf.Database.Type == "postgresql" {
+			if u, err := url.Parse(conf.Database.URL); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+				problems = append(problems, errors.New("database: url must be a postgres:// or postgresql:// URL"))
+			}
+		}
+		return problems
+	}
+
+	socket := strings.HasPrefix(conf.Database.Host, "/")
+
+	if conf.Database.Host == "" {
+		problems = append(problems, errors.New("database: host required"))
+	}
+
+	if conf.Database.Port == 0 && !socket {
+		problems = append(problems, errors.New("database: port required"))
+	}
+
+	if conf.Database.Username == "" {
+		problems = append(problems, errors.New("database: username required"))
+	}
+
+	if conf.Database.Password == "" && !socket && conf.Database.SSLCert == "" {
+		problems = append(problems, errors.New("database: password required"))
+	}
+
+	if conf.Database.Name == "" {
+		problems = append(problems, errors.New("database: name required"))
+	}
+
+	return problems
+}
+
+func checkCodecValues(conf *Config) []error {
+	var problems []error
+
+	if len(conf.Codec.Alphabet) < minAlphabetLength {
+		problems = append(problems, fmt.Errorf("codec: alphabet is too short (minimum length: %d)", minAlphabetLength))
+	}
+
+	seen := make(map[rune]bool)
+	for _, char := range conf.Codec.Alphabet {
+		if char >= 128 || !unicode.IsPrint(char) || unicode.IsSpace(char) {
+			problems = append(problems, fmt.Errorf("codec: alphabet contains invalid character %q", char))
+			continue
+		}
+		if seen[char] {
+			problems = append(problems, fmt.Errorf("codec: alphabet contains duplicate character %q", char))
+		}
+		seen[char] = true
+	}
+
+	if conf.Codec.BlockSize < 0 || conf.Codec.BlockSize > maxBlockSize {
+		problems = append(problems, fmt.Errorf("codec: block_size must be between 0 and %d", maxBlockSize))
+	}
+
+	return problems
+}
+
+func checkURLValues(conf *Config) []error {
+	var problems []error
+
+	if conf.URLPrefix != "" {
+		if !isAbsoluteHTTPURL(conf.URLPrefix) {
+			problems = append(problems, fmt.Errorf("url_prefix: '%s' is not a valid http(s) URL", conf.URLPrefix))
+		} else if strings.HasSuffix(conf.URLPrefix, "/") {
+			problems = append(problems, errors.New("url_prefix: must not end with a slash"))
+		}
+	}
+
+	if conf.HomeRedirect != "" {
+		if !strings.HasPrefix(conf.HomeRedirect, "/") && !isAbsoluteHTTPURL(conf.HomeRedirect) {
+			problems = append(problems, fmt.Errorf("home_redirect: '%s' is neither a path nor a valid http(s) URL", conf.HomeRedirect))
+		}
+	}
+
+	for _, origin := range conf.Server.CORSOrigins {
+		if !isAbsoluteHTTPURL(origin) {
+			problems = append(problems, fmt.Errorf("server: cors_origin '%s' is not a valid http(s) origin", origin))
+		}
+	}
+
+	return problems
+}
+
+func checkTLSFiles(conf *Config) []error {
+	if conf.Server.UseACME {
+		return checkACMEValues(conf)
+	}
+
+	if !conf.Server.UseTLS || conf.Server.TLSCertificate == "" || conf.Server.TLSPrivateKey == "" {
+		return nil
+	}
+
+	var problems []error
+
+	for _, path := range []string{conf.Server.TLSCertificate, conf.Server.TLSPrivateKey} {
+		if _, err := os.Stat(path); err != nil {
+			problems = append(problems, fmt.Errorf("server: can not access %s", path))
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	pair, err := tls.LoadX509KeyPair(conf.Server.TLSCertificate, conf.Server.TLSPrivateKey)
+	if err != nil {
+		return []error{fmt.Errorf("server: invalid tls certificate/key pair: %w", err)}
+	}
+
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return []error{fmt.Errorf("server: invalid tls certificate: %w", err)}
+	}
+	if time.Now().After(leaf.NotAfter) {
+		problems = append(problems, fmt.Errorf("server: tls certificate expired on %s", leaf.NotAfter.Format(time.DateOnly)))
+	}
+
+	return problems
+}
+
+func checkDatabaseTLSFiles(conf *Config) []error {
+	var problems []error
+
+	for _, path := range []string{conf.Database.SSLRootCert, conf.Database.SSLCert, conf.Database.SSLKey} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			problems = append(problems, fmt.Errorf("database: can not access %s", path))
+		}
+	}
+
+	return problems
+}
+
+func checkACMEValues(conf *Config) []error {
+	var problems []error
+
+	if !isAbsoluteHTTPURL(conf.Server.ACMEDirectoryURL) {
+		problems = append(problems, fmt.Errorf("server: acme_directory_url '%s' is not a valid http(s) URL", conf.Server.ACMEDirectoryURL))
+	}
+
+	if conf.Server.ACMERootCA != "" {
+		if data, err := os.ReadFile(conf.Server.ACMERootCA); err != nil {
+			problems = append(problems, fmt.Errorf("server: can not access %s", conf.Server.ACMERootCA))
+		} else if !x509.NewCertPool().AppendCertsFromPEM(data) {
+			problems = append(problems, fmt.Errorf("server: no certificates found in %s", conf.Server.ACMERootCA))
+		}
+	}
+
+	if info, err := os.Stat(conf.Server.ACMECacheDir); err == nil && !info.IsDir() {
+		problems = append(problems, fmt.Errorf("server: acme_cache_dir %s is not a directory", conf.Server.ACMECacheDir))
+	}
+
+	for _, host := range conf.Server.ACMEHosts {
+		if net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+			problems = append(problems, fmt.Errorf("server: acme host '%s' is not a public domain name", host))
 		}
 	}
 
+	return problems
+}
+
+func CheckReloadable(current, next *Config) error {
+	var changed []string
+
+	currentDatabase, nextDatabase := current.Database, next.Database
+	currentDatabase.QueryTimeout, nextDatabase.QueryTimeout = 0, 0
+	if !reflect.DeepEqual(currentDatabase, nextDatabase) {
+		changed = append(changed, "database")
+	}
+
+	if current.Log.Format != next.Log.Format {
+		changed = append(changed, "log.format")
+	}
+
+	if current.RateLimit.Enabled != next.RateLimit.Enabled || current.RateLimit.Backend != next.RateLimit.Backend {
+		changed = append(changed, "rate_limit backend")
+	}
+
+	if !reflect.DeepEqual(current.OIDC, next.OIDC) {
+		changed = append(changed, "oidc")
+	}
+
+	if current.Codec != next.Codec {
+		changed = append(changed, "codec")
+	}
+
+	if current.Server.Host != next.Server.Host {
+		changed = append(changed, "server.host")
+	}
+
+	if current.Server.Port != next.Server.Port {
+		changed = append(changed, "server.port")
+	}
+
+	if !slices.Equal(current.Server.TrustedProxies, next.Server.TrustedProxies) ||
+		!slices.Equal(current.Server.ClientIPHeaders, next.Server.ClientIPHeaders) {
+		changed = append(changed, "server proxy settings")
+	}
+
+	if current.Server.UseTLS != next.Server.UseTLS {
+		changed = append(changed, "server.use_tls")
+	}
+
+	if current.Server.UseACME != next.Server.UseACME ||
+		current.Server.ACMEDirectoryURL != next.Server.ACMEDirectoryURL ||
+		current.Server.ACMERootCA != next.Server.ACMERootCA ||
+		current.Server.ACMEEmail != next.Server.ACMEEmail ||
+		current.Server.ACMECacheDir != next.Server.ACMECacheDir ||
+		current.Server.ACMEHTTPPort != next.Server.ACMEHTTPPort ||
+		!slices.Equal(current.Server.ACMEHosts, next.Server.ACMEHosts) {
+		changed = append(changed, "server acme settings")
+	}
+
+	if current.Server.UseMetrics != next.Server.UseMetrics || current.Server.MetricsListen != next.Server.MetricsListen {
+		changed = append(changed, "server metrics settings")
+	}
+
+	if current.Server.UseCache != next.Server.UseCache {
+		changed = append(changed, "server.use_cache")
+	}
+
+	if current.Server.ReadTimeout != next.Server.ReadTimeout ||
+		current.Server.WriteTimeout != next.Server.WriteTimeout ||
+		current.Server.IdleTimeout != next.Server.IdleTimeout {
+		changed = append(changed, "server timeouts")
+	}
+
+	if len(changed) > 0 {
+		return fmt.Errorf("can not change %s without a restart", strings.Join(changed, ", "))
+	}
+
 	return nil
 }
+
+func isAbsoluteHTTPURL(rawURL string) bool {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return (parsedURL.Scheme == "http" || parsedURL.Scheme == "https") && parsedURL.Host != ""
+}
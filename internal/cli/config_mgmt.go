@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+	"github.com/salmanmorshed/simplelinkshortener/internal/db"
+)
+
+var ErrConfigProblems = errors.New("configuration check failed")
+
+func ShowConfig(cfgPath string, redacted bool) error {
+	conf, err := cfg.LoadConfigFromFile(cfgPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if redacted {
+		conf = cfg.Redacted(conf)
+	}
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	defer func() { _ = encoder.Close() }()
+	if err = encoder.Encode(conf); err != nil {
+		return fmt.Errorf("failed to print config: %w", err)
+	}
+
+	return nil
+}
+
+func CheckConfig(ctx context.Context, cfgPath string, skipDatabase bool) error {
+	conf, err := cfg.ReadConfigFromFile(cfgPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	problems := cfg.DiagnoseConfig(conf)
+
+	if !skipDatabase && conf.Database.Type != "" {
+		dbCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		if err = db.CheckConnection(dbCtx, conf); err != nil {
+			problems = append(problems, fmt.Errorf("database: not reachable: %w", err))
+		}
+	}
+
+	if len(problems) == 0 {
+		fmt.Println("Config OK:", cfgPath)
+		return nil
+	}
+
+	for _, problem := range problems {
+		fmt.Println("-", problem)
+	}
+	return fmt.Errorf("%w: %d problem(s) found", ErrConfigProblems, len(problems))
+}
@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/manifoldco/promptui"
 
@@ -17,7 +18,7 @@ func InitializeConfigFile(cfgPath string) error {
 
 	prompt1 := promptui.Select{
 		Label: "Choose database type",
-		Items: []string{"sqlite3", "postgresql"},
+		Items: []string{"sqlite3", "postgresql", "mysql", "bolt"},
 	}
 	_, conf.Database.Type, err = prompt1.Run()
 	if err != nil {
@@ -34,7 +35,22 @@ func InitializeConfigFile(cfgPath string) error {
 		if err != nil {
 			return ErrAborted
 		}
-	} else if conf.Database.Type == "postgresql" {
+	} else if conf.Database.Type == "bolt" {
+		prompt2 := promptui.Prompt{
+			Label:     "Path to bolt file",
+			Default:   "db.bolt",
+			AllowEdit: true,
+		}
+		conf.Database.Name, err = prompt2.Run()
+		if err != nil {
+			return ErrAborted
+		}
+	} else if conf.Database.Type == "postgresql" || conf.Database.Type == "mysql" {
+		defaultPort, defaultUsername := "5432", "postgres"
+		if conf.Database.Type == "mysql" {
+			defaultPort, defaultUsername = "3306", "root"
+		}
+
 		fmt.Println("Enter database connection details")
 
 		prompt2 := promptui.Prompt{
@@ -53,7 +69,7 @@ func InitializeConfigFile(cfgPath string) error {
 		)
 		prompt3 := promptui.Prompt{
 			Label:     "Port",
-			Default:   "5432",
+			Default:   defaultPort,
 			AllowEdit: true,
 		}
 		PortStr, err = prompt3.Run()
@@ -67,7 +83,7 @@ func InitializeConfigFile(cfgPath string) error {
 
 		prompt4 := promptui.Prompt{
 			Label:     "Username",
-			Default:   "postgres",
+			Default:   defaultUsername,
 			AllowEdit: true,
 		}
 		conf.Database.Username, err = prompt4.Run()
@@ -95,15 +111,21 @@ func InitializeConfigFile(cfgPath string) error {
 			return ErrAborted
 		}
 
-		conf.Database.ExtraArgs = map[string]string{
-			"sslmode":  "prefer",
-			"timezone": "UTC",
+		if conf.Database.Type == "postgresql" {
+			conf.Database.SSLMode = "prefer"
+			conf.Database.ExtraArgs = map[string]string{
+				"timezone": "UTC",
+			}
+		} else {
+			conf.Database.ExtraArgs = map[string]string{
+				"tls": "preferred",
+			}
 		}
 	} else {
 		return fmt.Errorf("unsupported database type: %s", conf.Database.Type)
 	}
 
-	var useReverseProxy, useTLS, domain string
+	var useReverseProxy, useTLS, domain, certSource string
 
 	prompt7 := promptui.Select{
 		Label: "Will it run behind a reverse proxy?",
@@ -139,6 +161,39 @@ func InitializeConfigFile(cfgPath string) error {
 		if conf.Server.UseTLS {
 			conf.Server.Port = 443
 
+			prompt10a := promptui.Select{
+				Label: "How should certificates be obtained?",
+				Items: []string{"automatically (ACME/Let's Encrypt)", "from existing files"},
+			}
+			_, certSource, err = prompt10a.Run()
+			if err != nil {
+				return ErrAborted
+			}
+		}
+
+		if conf.Server.UseTLS && certSource == "automatically (ACME/Let's Encrypt)" {
+			conf.Server.UseACME = true
+			conf.Server.ACMEHosts = []string{domain}
+
+			prompt10b := promptui.Prompt{
+				Label:     "Contact email for the ACME account (optional)",
+				AllowEdit: true,
+			}
+			conf.Server.ACMEEmail, err = prompt10b.Run()
+			if err != nil {
+				return ErrAborted
+			}
+
+			prompt10c := promptui.Prompt{
+				Label:     "Certificate cache directory",
+				Default:   "acme-cache",
+				AllowEdit: true,
+			}
+			conf.Server.ACMECacheDir, err = prompt10c.Run()
+			if err != nil {
+				return ErrAborted
+			}
+		} else if conf.Server.UseTLS {
 			prompt10 := promptui.Prompt{
 				Label:     "Certificate",
 				Default:   fmt.Sprintf("/etc/letsencrypt/live/%s/fullchain.pem", domain),
@@ -165,6 +220,32 @@ func InitializeConfigFile(cfgPath string) error {
 		conf.Server.UseTLS = false
 		conf.Server.Host = "127.0.0.1"
 		conf.Server.Port = 8000
+
+		prompt12 := promptui.Prompt{
+			Label:     "Proxy addresses to trust (comma separated IPs/CIDRs)",
+			Default:   "127.0.0.1/32,::1/128",
+			AllowEdit: true,
+		}
+		trustedProxies, err := prompt12.Run()
+		if err != nil {
+			return ErrAborted
+		}
+		for _, proxy := range strings.Split(trustedProxies, ",") {
+			if proxy = strings.TrimSpace(proxy); proxy != "" {
+				conf.Server.TrustedProxies = append(conf.Server.TrustedProxies, proxy)
+			}
+		}
+
+		prompt13 := promptui.Select{
+			Label: "Header the proxy uses to pass the client address",
+			Items: []string{cfg.HeaderXForwardedFor, cfg.HeaderXRealIP, cfg.HeaderForwarded},
+		}
+		_, clientIPHeader, err := prompt13.Run()
+		if err != nil {
+			return ErrAborted
+		}
+		conf.Server.ClientIPHeaders = []string{clientIPHeader}
+
 		if conf.Server.UseTLS {
 			conf.URLPrefix = fmt.Sprintf("https://%s", domain)
 		} else {
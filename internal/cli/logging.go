@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+)
+
+var logLevel slog.LevelVar
+
+func setupLogging(conf *cfg.Config) {
+	setLogLevel(conf)
+
+	opts := &slog.HandlerOptions{Level: &logLevel}
+	if conf.Log.Format == "json" {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	} else {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	}
+}
+
+func setLogLevel(conf *cfg.Config) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(conf.Log.Level)); err != nil {
+		level = slog.LevelInfo
+	}
+	logLevel.Set(level)
+}
@@ -3,6 +3,8 @@ package cli
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/salmanmorshed/intstrcodec"
 
@@ -11,12 +13,18 @@ import (
 	"github.com/salmanmorshed/simplelinkshortener/internal/web"
 )
 
-func StartServer(ctx context.Context, cfgPath string) error {
+func StartServer(ctx context.Context, cfgPath string, reloadCh <-chan struct{}) error {
 	conf, err := cfg.LoadConfigFromFile(cfgPath)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	setupLogging(conf)
+
+	if err = db.WaitForDatabase(ctx, conf); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
 	store, err := db.NewStore(conf)
 	if err != nil {
 		return fmt.Errorf("failed to initialize store: %w", err)
@@ -28,15 +36,83 @@ func StartServer(ctx context.Context, cfgPath string) error {
 		return fmt.Errorf("failed to initialize codec: %w", err)
 	}
 
-	serve := web.SetupRouter(ctx, conf, store, codec)
+	serverCtx, stopServer := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopServer()
+
+	server := web.SetupRouter(serverCtx, conf, store, codec)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- server.Serve() }()
+	go pruneAuthRecords(serverCtx, store, conf.Auth.LoginEventRetention)
+
+	for {
+		select {
+		case err := <-errCh:
+			stopServer()
+			web.CacheWaitGroup.Wait()
+			return err
+
+		case <-reloadCh:
+			conf = reloadConfig(server, cfgPath, conf)
+
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.Server.ShutdownTimeout)
+			defer cancel()
+
+			err := server.Shutdown(shutdownCtx)
+			if err != nil {
+				slog.Warn("failed to drain in-flight requests", "error", err)
+			}
+
+			stopServer()
+			web.CacheWaitGroup.Wait()
+
+			return err
+		}
+	}
+}
+
+func pruneAuthRecords(ctx context.Context, store db.Store, retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := store.DeleteLoginEventsBefore(ctx, time.Now().Add(-retention))
+		if err != nil {
+			slog.Warn(err.Error())
+		} else if deleted > 0 {
+			slog.Info("pruned login events", "count", deleted)
+		}
+
+		deleted, err = store.DeleteExpiredSessions(ctx)
+		if err != nil {
+			slog.Warn(err.Error())
+		} else if deleted > 0 {
+			slog.Info("pruned expired sessions", "count", deleted)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func reloadConfig(server *web.Server, cfgPath string, current *cfg.Config) *cfg.Config {
+	conf, err := cfg.LoadConfigFromFile(cfgPath)
+	if err != nil {
+		slog.Error("config reload rejected", "error", err)
+		return current
+	}
+
+	if err = server.Reload(conf); err != nil {
+		slog.Error("config reload rejected", "error", err)
+		return current
+	}
 
-	errCh := make(chan error)
-	go func() { errCh <- serve() }()
-	go func() {
-		<-ctx.Done()
-		web.CacheWaitGroup.Wait()
-		errCh <- nil
-	}()
+	setLogLevel(conf)
 
-	return <-errCh
+	slog.Info("config reloaded", "path", cfgPath)
+	return conf
 }
@@ -3,6 +3,8 @@ package cli
 import (
 	"context"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/manifoldco/promptui"
 
@@ -50,7 +52,7 @@ func AddUser(ctx context.Context, cfgPath string, username string) error {
 		return ErrAborted
 	}
 
-	newUser, err := store.CreateUser(ctx, username, password)
+	newUser, err := store.CreateUser(ctx, username, password, db.DefaultRole)
 	if err != nil {
 		return err
 	}
@@ -59,7 +61,7 @@ func AddUser(ctx context.Context, cfgPath string, username string) error {
 	return nil
 }
 
-func ModifyUser(ctx context.Context, cfgPath string, username string) error {
+func ModifyUser(ctx context.Context, cfgPath string, username string, role string) error {
 	var err error
 
 	conf, err := cfg.LoadConfigFromFile(cfgPath)
@@ -83,16 +85,23 @@ func ModifyUser(ctx context.Context, cfgPath string, username string) error {
 		return nil
 	}
 
-	var toggleAdminLabel string
-	if user.IsAdmin {
-		toggleAdminLabel = "Revoke admin status"
-	} else {
-		toggleAdminLabel = "Grant admin status"
+	if role != "" {
+		newRole, err := db.ParseRole(role)
+		if err != nil {
+			return err
+		}
+
+		if err := store.SetRole(ctx, user.Username, newRole); err != nil {
+			return err
+		}
+
+		fmt.Println("Updated role for", user.Username, "to", newRole)
+		return nil
 	}
 
 	prompt1 := promptui.Select{
 		Label: "Operation",
-		Items: []string{"Change password", "Change username", toggleAdminLabel},
+		Items: []string{"Change password", "Change username", "Change role"},
 	}
 	_, action, err := prompt1.Run()
 	if err != nil {
@@ -135,28 +144,29 @@ func ModifyUser(ctx context.Context, cfgPath string, username string) error {
 		}
 
 		fmt.Println("Updated username", oldUsername, "to", newUsername)
-	} else if action == toggleAdminLabel {
-		prompt3 := promptui.Prompt{
-			Label:     "Are you sure?",
-			IsConfirm: true,
+	} else if action == "Change role" {
+		prompt2 := promptui.Select{
+			Label:     fmt.Sprintf("New role (current: %s)", user.Role),
+			Items:     db.Roles,
+			CursorPos: max(slices.Index(db.Roles, user.Role), 0),
 		}
-		confirm, err := prompt3.Run()
-		if err != nil || (confirm != "y" && confirm != "Y") {
+		idx, _, err := prompt2.Run()
+		if err != nil {
 			fmt.Println("aborted")
 			return nil
 		}
 
-		if err := store.ToggleAdmin(ctx, user.Username); err != nil {
+		if err := store.SetRole(ctx, user.Username, db.Roles[idx]); err != nil {
 			return err
 		}
 
-		fmt.Println("Admin status updated for", user.Username)
+		fmt.Println("Updated role for", user.Username, "to", db.Roles[idx])
 	}
 
 	return nil
 }
 
-func DeleteUser(ctx context.Context, cfgPath string, username string) error {
+func DeleteUser(ctx context.Context, cfgPath string, username string, reassignTo string, reassignToTeam string) error {
 	var err error
 
 	conf, err := cfg.LoadConfigFromFile(cfgPath)
@@ -180,6 +190,13 @@ func DeleteUser(ctx context.Context, cfgPath string, username string) error {
 		return err
 	}
 
+	var owner *db.LinkOwner
+	if linkCount := store.GetLinkCountForUser(ctx, user.Username); linkCount > 0 {
+		if owner, err = selectLinkOwner(ctx, store, user, linkCount, reassignTo, reassignToTeam); err != nil {
+			return err
+		}
+	}
+
 	prompt1 := promptui.Prompt{
 		Label:     fmt.Sprintf("Delete user %s", user.Username),
 		IsConfirm: true,
@@ -189,11 +206,199 @@ func DeleteUser(ctx context.Context, cfgPath string, username string) error {
 		return ErrAborted
 	}
 
+	if owner != nil {
+		count, err := store.TransferUserLinks(ctx, user.Username, *owner)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Reassigned", count, "links")
+	}
+
 	if err = store.DeleteUser(ctx, user.Username); err != nil {
-		return fmt.Errorf("failed to delete user %s", user.Username)
+		return fmt.Errorf("failed to delete user %s: %w", user.Username, err)
 	}
 
 	fmt.Println("Deleted user", user.Username)
 
 	return nil
 }
+
+func ShowUserInfo(ctx context.Context, cfgPath string, username string) error {
+	var err error
+
+	conf, err := cfg.LoadConfigFromFile(cfgPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	store, err := db.NewStore(conf)
+	if err != nil {
+		return fmt.Errorf("failed to initialize store: %w", err)
+	}
+	defer store.Close()
+
+	var user *db.User
+	if username == "" {
+		user, err = showUserSelection(ctx, store, "Select user to inspect")
+	} else {
+		user, err = store.RetrieveUser(ctx, username)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Username:", user.Username)
+	fmt.Println("Role:", user.Role)
+	fmt.Println("Created at:", user.CreatedAt.Format(time.RFC3339))
+	fmt.Println("Two-factor authentication:", user.TOTPEnabled)
+	fmt.Println("Failed attempts:", user.FailedAttempts)
+	if user.IsLocked() {
+		fmt.Println("Locked until:", user.LockedUntil.Local().Format(time.RFC3339))
+	} else {
+		fmt.Println("Locked: no")
+	}
+
+	events, err := store.RetrieveLoginEvents(ctx, user.Username, 20, 0)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("\nRecent login attempts:")
+	for _, event := range events {
+		result := "success"
+		if !event.Success {
+			result = "failure (" + event.Reason + ")"
+		}
+		fmt.Printf("  %s  %-6s  %-15s  %s  %s\n",
+			event.CreatedAt.Local().Format(time.DateTime), event.Method, event.IP, result, event.UserAgent)
+	}
+
+	return nil
+}
+
+func UnlockUser(ctx context.Context, cfgPath string, username string) error {
+	var err error
+
+	conf, err := cfg.LoadConfigFromFile(cfgPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	store, err := db.NewStore(conf)
+	if err != nil {
+		return fmt.Errorf("failed to initialize store: %w", err)
+	}
+	defer store.Close()
+
+	var user *db.User
+	if username == "" {
+		user, err = showUserSelection(ctx, store, "Select user to unlock")
+	} else {
+		user, err = store.RetrieveUser(ctx, username)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = store.UnlockUser(ctx, user.Username); err != nil {
+		return err
+	}
+
+	fmt.Println("Unlocked user", user.Username)
+	return nil
+}
+
+func ResetUserTwoFactor(ctx context.Context, cfgPath string, username string) error {
+	var err error
+
+	conf, err := cfg.LoadConfigFromFile(cfgPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	store, err := db.NewStore(conf)
+	if err != nil {
+		return fmt.Errorf("failed to initialize store: %w", err)
+	}
+	defer store.Close()
+
+	var user *db.User
+	if username == "" {
+		user, err = showUserSelection(ctx, store, "Select user to reset two-factor authentication")
+	} else {
+		user, err = store.RetrieveUser(ctx, username)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = store.DisableTOTP(ctx, user.Username); err != nil {
+		return err
+	}
+
+	if err = store.DeleteSessionsForUser(ctx, user.Username); err != nil {
+		return err
+	}
+
+	fmt.Println("Reset two-factor authentication for user", user.Username)
+	return nil
+}
+
+func selectLinkOwner(ctx context.Context, store db.Store, user *db.User, linkCount uint, reassignTo string, reassignToTeam string) (*db.LinkOwner, error) {
+	if reassignTo == "" && reassignToTeam == "" {
+		prompt1 := promptui.Select{
+			Label: fmt.Sprintf("%s owns %d links. Reassign them to", user.Username, linkCount),
+			Items: []string{"Another user", "A team"},
+		}
+		idx, _, err := prompt1.Run()
+		if err != nil {
+			return nil, ErrAborted
+		}
+
+		if idx == 0 {
+			target, err := showUserSelection(ctx, store, "Select new owner")
+			if err != nil {
+				return nil, err
+			}
+			reassignTo = target.Username
+		} else {
+			teams, err := store.RetrieveAllTeams(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if len(teams) == 0 {
+				return nil, fmt.Errorf("there are no teams")
+			}
+
+			names := make([]string, len(teams))
+			for i, team := range teams {
+				names[i] = team.Name
+			}
+			prompt2 := promptui.Select{
+				Label: "Select new owner team",
+				Items: names,
+			}
+			_, reassignToTeam, err = prompt2.Run()
+			if err != nil {
+				return nil, ErrAborted
+			}
+		}
+	}
+
+	if reassignToTeam != "" {
+		team, err := store.RetrieveTeam(ctx, reassignToTeam)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find team %s", reassignToTeam)
+		}
+		return &db.LinkOwner{TeamID: team.ID}, nil
+	}
+
+	if reassignTo == user.Username {
+		return nil, fmt.Errorf("can not reassign links to the deleted user")
+	}
+	target, err := store.RetrieveUser(ctx, reassignTo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user %s", reassignTo)
+	}
+	return &db.LinkOwner{Username: target.Username}, nil
+}
@@ -0,0 +1,1364 @@
+package db
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	boltMeta           = []byte("meta")
+	boltUsers          = []byte("users")
+	boltUsernames      = []byte("usernames")
+	boltLinks          = []byte("links")
+	boltUserLinks      = []byte("user_links")
+	boltTeamLinks      = []byte("team_links")
+	boltTeams          = []byte("teams")
+	boltTeamNames      = []byte("team_names")
+	boltTeamMembers    = []byte("team_members")
+	boltLoginEvents    = []byte("login_events")
+	boltRecoveryCodes  = []byte("recovery_codes")
+	boltAPITokens      = []byte("api_tokens")
+	boltAPITokenHashes = []byte("api_token_hashes")
+	boltSessions       = []byte("sessions")
+	boltOIDCIdentities = []byte("oidc_identities")
+
+	boltSchemaVersionKey = []byte("schema_version")
+)
+
+type BoltStore struct {
+	db *bbolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{
+			boltMeta, boltUsers, boltUsernames, boltLinks, boltUserLinks, boltTeamLinks, boltTeams, boltTeamNames,
+			boltTeamMembers, boltLoginEvents, boltRecoveryCodes, boltAPITokens, boltAPITokenHashes, boltSessions,
+			boltOIDCIdentities,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		meta := tx.Bucket(boltMeta)
+		version := meta.Get(boltSchemaVersionKey)
+		if version != nil && btoi(version) >= CurrentSchemaVersion {
+			return nil
+		}
+		if version != nil && btoi(version) < 8 {
+			if err := boltBackfillLoginEventUsers(tx); err != nil {
+				return err
+			}
+		}
+		return meta.Put(boltSchemaVersionKey, itob(CurrentSchemaVersion))
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize %s: %w", path, err)
+	}
+
+	return &BoltStore{db}, nil
+}
+
+func boltBackfillLoginEventUsers(tx *bbolt.Tx) error {
+	events := tx.Bucket(boltLoginEvents)
+	var updated []LoginEvent
+	err := events.ForEach(func(_, v []byte) error {
+		var event LoginEvent
+		if err := json.Unmarshal(v, &event); err != nil {
+			return err
+		}
+		if user := boltFindUser(tx, event.Username); event.UserID == nil && user != nil {
+			event.UserID = &user.ID
+			updated = append(updated, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := range updated {
+		if err = putRecord(events, itob(updated[i].ID), &updated[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func boltError(err error, message string) error {
+	var storeErr *storeError
+	if errors.As(err, &storeErr) {
+		return err
+	}
+	return errors.New(message)
+}
+
+func itob(v uint) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	return b
+}
+
+func btoi(b []byte) uint {
+	return uint(binary.BigEndian.Uint64(b))
+}
+
+func pairKey(a uint, b uint) []byte {
+	return append(itob(a), itob(b)...)
+}
+
+func getRecord(b *bbolt.Bucket, key []byte, v any) bool {
+	data := b.Get(key)
+	return data != nil && json.Unmarshal(data, v) == nil
+}
+
+func putRecord(b *bbolt.Bucket, key []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+func nextID(b *bbolt.Bucket) (uint, error) {
+	id, err := b.NextSequence()
+	return uint(id), err
+}
+
+func boltFindUser(tx *bbolt.Tx, username string) *User {
+	id := tx.Bucket(boltUsernames).Get([]byte(username))
+	if id == nil {
+		return nil
+	}
+	var user User
+	if !getRecord(tx.Bucket(boltUsers), id, &user) {
+		return nil
+	}
+	return &user
+}
+
+func boltFindUserID(tx *bbolt.Tx, username string) *uint {
+	if id := tx.Bucket(boltUsernames).Get([]byte(username)); id != nil {
+		userID := btoi(id)
+		return &userID
+	}
+	return nil
+}
+
+func boltUsernameOf(tx *bbolt.Tx, userID uint) string {
+	var user User
+	if getRecord(tx.Bucket(boltUsers), itob(userID), &user) {
+		return user.Username
+	}
+	return ""
+}
+
+func boltFindTeam(tx *bbolt.Tx, name string) *Team {
+	id := tx.Bucket(boltTeamNames).Get([]byte(name))
+	if id == nil {
+		return nil
+	}
+	var team Team
+	if !getRecord(tx.Bucket(boltTeams), id, &team) {
+		return nil
+	}
+	return &team
+}
+
+func boltTeamExists(tx *bbolt.Tx, teamID uint) bool {
+	return tx.Bucket(boltTeams).Get(itob(teamID)) != nil
+}
+
+func boltOIDCIdentityKey(identity OIDCIdentity) []byte {
+	return []byte(identity.Issuer + "\x00" + identity.Subject)
+}
+
+func boltUpdateUser(tx *bbolt.Tx, username string, update func(*User)) error {
+	user := boltFindUser(tx, username)
+	if user == nil {
+		return nil
+	}
+	update(user)
+	return putRecord(tx.Bucket(boltUsers), itob(user.ID), user)
+}
+
+func boltLinkView(tx *bbolt.Tx, link *Link) *Link {
+	link.CreatedBy = nil
+	if link.CreatedByID != nil {
+		if username := boltUsernameOf(tx, *link.CreatedByID); username != "" {
+			link.CreatedBy = &username
+		}
+	}
+	return link
+}
+
+func boltLinkIndexKey(tx *bbolt.Tx, link *Link) (*bbolt.Bucket, []byte) {
+	if link.TeamID != nil {
+		return tx.Bucket(boltTeamLinks), pairKey(*link.TeamID, link.ID)
+	}
+	if link.CreatedByID != nil {
+		return tx.Bucket(boltUserLinks), pairKey(*link.CreatedByID, link.ID)
+	}
+	return nil, nil
+}
+
+func boltPutLink(tx *bbolt.Tx, link *Link) error {
+	if index, key := boltLinkIndexKey(tx, link); index != nil {
+		if err := index.Put(key, nil); err != nil {
+			return err
+		}
+	}
+	link.CreatedBy = nil
+	return putRecord(tx.Bucket(boltLinks), itob(link.ID), link)
+}
+
+func boltDeleteLinkIndex(tx *bbolt.Tx, link *Link) error {
+	if index, key := boltLinkIndexKey(tx, link); index != nil {
+		return index.Delete(key)
+	}
+	return nil
+}
+
+func boltIndexedIDs(index *bbolt.Bucket, owner uint) []uint {
+	var ids []uint
+	prefix := itob(owner)
+	c := index.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		ids = append(ids, btoi(k[8:]))
+	}
+	return ids
+}
+
+func boltPageLinks(tx *bbolt.Tx, index *bbolt.Bucket, owner uint, limit int, offset int) []Link {
+	ids := boltIndexedIDs(index, owner)
+	links := make([]Link, 0, limit)
+	for i := len(ids) - 1 - offset; i >= 0 && len(links) < limit; i-- {
+		var link Link
+		if getRecord(tx.Bucket(boltLinks), itob(ids[i]), &link) {
+			links = append(links, *boltLinkView(tx, &link))
+		}
+	}
+	return links
+}
+
+func boltDeleteKeysWhere(b *bbolt.Bucket, match func(k, v []byte) bool) (int64, error) {
+	var keys [][]byte
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if match(k, v) {
+			keys = append(keys, slices.Clone(k))
+		}
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(keys)), nil
+}
+
+func boltDeleteAPIToken(tx *bbolt.Tx, token *APIToken) error {
+	if err := tx.Bucket(boltAPITokenHashes).Delete([]byte(token.TokenHash)); err != nil {
+		return err
+	}
+	return tx.Bucket(boltAPITokens).Delete(itob(token.ID))
+}
+
+func boltMemberView(tx *bbolt.Tx, member *TeamMember) *TeamMember {
+	member.Username = boltUsernameOf(tx, member.UserID)
+	return member
+}
+
+func (s *BoltStore) CreateUser(_ context.Context, username string, password string, role Role) (*User, error) {
+	return s.insertUser(username, password, role, nil)
+}
+
+func (s *BoltStore) CreateOIDCUser(_ context.Context, username string, password string, role Role, identity OIDCIdentity) (*User, error) {
+	return s.insertUser(username, password, role, &identity)
+}
+
+func (s *BoltStore) insertUser(username string, password string, role Role, identity *OIDCIdentity) (*User, error) {
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, errors.New("failed to hash password")
+	}
+
+	var user *User
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		if boltFindUser(tx, username) != nil {
+			return conflictError("%s is already taken", username)
+		}
+		users := tx.Bucket(boltUsers)
+		id, err := nextID(users)
+		if err != nil {
+			return err
+		}
+		user = &User{
+			ID:        id,
+			Username:  username,
+			Password:  string(hashedBytes),
+			Role:      role,
+			CreatedAt: time.Now().UTC(),
+		}
+		if identity != nil {
+			identities := tx.Bucket(boltOIDCIdentities)
+			if identities.Get(boltOIDCIdentityKey(*identity)) != nil {
+				return errors.New("identity is already linked")
+			}
+			if err = identities.Put(boltOIDCIdentityKey(*identity), itob(id)); err != nil {
+				return err
+			}
+			user.OIDCIssuer, user.OIDCSubject = &identity.Issuer, &identity.Subject
+		}
+		if err = tx.Bucket(boltUsernames).Put([]byte(username), itob(id)); err != nil {
+			return err
+		}
+		return putRecord(users, itob(id), user)
+	})
+	if err != nil {
+		return nil, boltError(err, "failed to create new user")
+	}
+	return user, nil
+}
+
+func (s *BoltStore) RetrieveAllUsers(_ context.Context) ([]User, error) {
+	var users []User
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltUsers).ForEach(func(_, v []byte) error {
+			var user User
+			if err := json.Unmarshal(v, &user); err != nil {
+				return err
+			}
+			users = append(users, user)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.New("failed to retrieve users")
+	}
+	return users, nil
+}
+
+func (s *BoltStore) RetrieveUser(_ context.Context, username string) (*User, error) {
+	var user *User
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		user = boltFindUser(tx, username)
+		return nil
+	})
+	if user == nil {
+		return nil, notFoundError("failed to retrieve user")
+	}
+	return user, nil
+}
+
+func (s *BoltStore) RetrieveUserByOIDCIdentity(_ context.Context, identity OIDCIdentity) (*User, error) {
+	var user User
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		id := tx.Bucket(boltOIDCIdentities).Get(boltOIDCIdentityKey(identity))
+		if id == nil || !getRecord(tx.Bucket(boltUsers), id, &user) {
+			return notFoundError("failed to retrieve user")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, boltError(err, "failed to retrieve user")
+	}
+	return &user, nil
+}
+
+func (s *BoltStore) LinkOIDCIdentity(_ context.Context, username string, identity OIDCIdentity) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		user := boltFindUser(tx, username)
+		if user == nil || user.OIDCIssuer != nil {
+			return conflictError("%s is already linked to an identity", username)
+		}
+		identities := tx.Bucket(boltOIDCIdentities)
+		if identities.Get(boltOIDCIdentityKey(identity)) != nil {
+			return errors.New("identity is already linked")
+		}
+		if err := identities.Put(boltOIDCIdentityKey(identity), itob(user.ID)); err != nil {
+			return err
+		}
+		user.OIDCIssuer, user.OIDCSubject = &identity.Issuer, &identity.Subject
+		return putRecord(tx.Bucket(boltUsers), itob(user.ID), user)
+	})
+	if err != nil {
+		return boltError(err, "failed to link identity")
+	}
+	return nil
+}
+
+func (s *BoltStore) UpdateUsername(_ context.Context, username, newUsername string) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		if boltFindUser(tx, newUsername) != nil {
+			return conflictError("%s is already taken", newUsername)
+		}
+		user := boltFindUser(tx, username)
+		if user == nil {
+			return notFoundError("user not found")
+		}
+
+		usernames := tx.Bucket(boltUsernames)
+		if err := usernames.Delete([]byte(username)); err != nil {
+			return err
+		}
+		if err := usernames.Put([]byte(newUsername), itob(user.ID)); err != nil {
+			return err
+		}
+		user.Username = newUsername
+		return putRecord(tx.Bucket(boltUsers), itob(user.ID), user)
+	})
+	if err != nil {
+		return boltError(err, "failed to update username")
+	}
+	return nil
+}
+
+func (s *BoltStore) UpdatePassword(_ context.Context, username, newPassword string) error {
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.New("failed to hash password")
+	}
+
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		return boltUpdateUser(tx, username, func(user *User) { user.Password = string(hashedBytes) })
+	})
+	if err != nil {
+		return errors.New("failed to update password")
+	}
+	return nil
+}
+
+func (s *BoltStore) SetRole(_ context.Context, username string, role Role) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		user := boltFindUser(tx, username)
+		if user == nil {
+			return notFoundError("user not found")
+		}
+		user.Role = role
+		return putRecord(tx.Bucket(boltUsers), itob(user.ID), user)
+	})
+	if err != nil {
+		return boltError(err, "failed to update role")
+	}
+	return nil
+}
+
+func (s *BoltStore) DeleteUser(_ context.Context, username string) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		user := boltFindUser(tx, username)
+		if user == nil {
+			return notFoundError("user not found")
+		}
+		if count := len(boltIndexedIDs(tx.Bucket(boltUserLinks), user.ID)); count > 0 {
+			return conflictError("%s still owns %d links, reassign them first", username, count)
+		}
+
+		links := tx.Bucket(boltLinks)
+		var created []Link
+		err := links.ForEach(func(_, v []byte) error {
+			var link Link
+			if err := json.Unmarshal(v, &link); err != nil {
+				return err
+			}
+			if link.CreatedByID != nil && *link.CreatedByID == user.ID {
+				link.CreatedByID = nil
+				created = append(created, link)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i := range created {
+			if err = putRecord(links, itob(created[i].ID), &created[i]); err != nil {
+				return err
+			}
+		}
+
+		if _, err = boltDeleteKeysWhere(tx.Bucket(boltTeamMembers), func(k, _ []byte) bool {
+			return btoi(k[8:]) == user.ID
+		}); err != nil {
+			return err
+		}
+		var tokens []APIToken
+		if err = tx.Bucket(boltAPITokens).ForEach(func(_, v []byte) error {
+			var token APIToken
+			if err := json.Unmarshal(v, &token); err != nil {
+				return err
+			}
+			if token.UserID == user.ID {
+				tokens = append(tokens, token)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for i := range tokens {
+			if err = boltDeleteAPIToken(tx, &tokens[i]); err != nil {
+				return err
+			}
+		}
+		if _, err = boltDeleteKeysWhere(tx.Bucket(boltSessions), func(_, v []byte) bool {
+			var session Session
+			return json.Unmarshal(v, &session) == nil && session.UserID == user.ID
+		}); err != nil {
+			return err
+		}
+		if err = tx.Bucket(boltRecoveryCodes).Delete(itob(user.ID)); err != nil {
+			return err
+		}
+		if user.OIDCIssuer != nil {
+			identity := OIDCIdentity{Issuer: *user.OIDCIssuer, Subject: *user.OIDCSubject}
+			if err = tx.Bucket(boltOIDCIdentities).Delete(boltOIDCIdentityKey(identity)); err != nil {
+				return err
+			}
+		}
+		if err = tx.Bucket(boltUsernames).Delete([]byte(username)); err != nil {
+			return err
+		}
+		return tx.Bucket(boltUsers).Delete(itob(user.ID))
+	})
+	if err != nil {
+		return boltError(err, "failed to delete user")
+	}
+	return nil
+}
+
+func (s *BoltStore) RecordLoginFailure(_ context.Context, username string, maxAttempts uint, lockout time.Duration) (bool, error) {
+	if maxAttempts == 0 || lockout <= 0 {
+		return false, nil
+	}
+
+	var locked bool
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		return boltUpdateUser(tx, username, func(user *User) {
+			if user.IsLocked() {
+				locked = true
+			} else if user.FailedAttempts+1 > maxAttempts {
+				lockedUntil := time.Now().UTC().Add(lockout)
+				user.FailedAttempts = 0
+				user.LockedUntil = &lockedUntil
+				locked = true
+			} else {
+				user.FailedAttempts++
+			}
+		})
+	})
+	if err != nil {
+		return false, errors.New("failed to record login failure")
+	}
+	return locked, nil
+}
+
+func (s *BoltStore) RefundLoginFailure(_ context.Context, username string) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		return boltUpdateUser(tx, username, func(user *User) {
+			if user.FailedAttempts > 0 {
+				user.FailedAttempts--
+			}
+		})
+	})
+	if err != nil {
+		return errors.New("failed to refund login failure")
+	}
+	return nil
+}
+
+func (s *BoltStore) ResetLoginFailures(_ context.Context, username string) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		return boltUpdateUser(tx, username, func(user *User) { user.FailedAttempts = 0 })
+	})
+	if err != nil {
+		return errors.New("failed to reset login failures")
+	}
+	return nil
+}
+
+func (s *BoltStore) UnlockUser(_ context.Context, username string) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		return boltUpdateUser(tx, username, func(user *User) {
+			user.FailedAttempts = 0
+			user.LockedUntil = nil
+		})
+	})
+	if err != nil {
+		return errors.New("failed to unlock user")
+	}
+	return nil
+}
+
+func (s *BoltStore) CreateLoginEvent(_ context.Context, event *LoginEvent) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		events := tx.Bucket(boltLoginEvents)
+		id, err := nextID(events)
+		if err != nil {
+			return err
+		}
+		created := *event
+		created.ID = id
+		created.UserID = nil
+		if user := boltFindUser(tx, event.Username); user != nil {
+			created.UserID = &user.ID
+		}
+		created.CreatedAt = time.Now().UTC()
+		return putRecord(events, itob(id), &created)
+	})
+	if err != nil {
+		return errors.New("failed to record login event")
+	}
+	return nil
+}
+
+func (s *BoltStore) RetrieveLoginEvents(_ context.Context, username string, limit int, offset int) ([]LoginEvent, error) {
+	events := make([]LoginEvent, 0, limit)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		user := boltFindUser(tx, username)
+		if user == nil {
+			return nil
+		}
+		skipped := 0
+		c := tx.Bucket(boltLoginEvents).Cursor()
+		for k, v := c.Last(); k != nil && len(events) < limit; k, v = c.Prev() {
+			var event LoginEvent
+			if err := json.Unmarshal(v, &event); err != nil {
+				return err
+			}
+			if event.UserID == nil || *event.UserID != user.ID {
+				continue
+			}
+			if skipped < offset {
+				skipped++
+				continue
+			}
+			events = append(events, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("failed to fetch login events")
+	}
+	return events, nil
+}
+
+func (s *BoltStore) DeleteLoginEventsBefore(_ context.Context, before time.Time) (int64, error) {
+	var deleted int64
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		deleted, err = boltDeleteKeysWhere(tx.Bucket(boltLoginEvents), func(_, v []byte) bool {
+			var event LoginEvent
+			return json.Unmarshal(v, &event) == nil && event.CreatedAt.Before(before)
+		})
+		return err
+	})
+	if err != nil {
+		return 0, errors.New("failed to delete login events")
+	}
+	return deleted, nil
+}
+
+func (s *BoltStore) SetTOTPSecret(_ context.Context, username string, secret string) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		user := boltFindUser(tx, username)
+		if user == nil || user.TOTPEnabled {
+			return errors.New("two-factor authentication is already enabled")
+		}
+		user.TOTPSecret = secret
+		return putRecord(tx.Bucket(boltUsers), itob(user.ID), user)
+	})
+	if err != nil {
+		return errors.New("two-factor authentication is already enabled")
+	}
+	return nil
+}
+
+func (s *BoltStore) EnableTOTP(_ context.Context, username string, recoveryCodeHashes []string) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		user := boltFindUser(tx, username)
+		if user == nil {
+			return errors.New("user not found")
+		}
+		user.TOTPEnabled = true
+		if err := putRecord(tx.Bucket(boltUsers), itob(user.ID), user); err != nil {
+			return err
+		}
+		return putRecord(tx.Bucket(boltRecoveryCodes), itob(user.ID), recoveryCodeHashes)
+	})
+	if err != nil {
+		return errors.New("failed to enable two-factor authentication")
+	}
+	return nil
+}
+
+func (s *BoltStore) DisableTOTP(_ context.Context, username string) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		user := boltFindUser(tx, username)
+		if user == nil {
+			return errors.New("user not found")
+		}
+		user.TOTPEnabled = false
+		user.TOTPSecret = ""
+		if err := putRecord(tx.Bucket(boltUsers), itob(user.ID), user); err != nil {
+			return err
+		}
+		return tx.Bucket(boltRecoveryCodes).Delete(itob(user.ID))
+	})
+	if err != nil {
+		return errors.New("failed to disable two-factor authentication")
+	}
+	return nil
+}
+
+func (s *BoltStore) UseRecoveryCode(_ context.Context, username string, codeHash string) (bool, error) {
+	var used bool
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		userID := boltFindUserID(tx, username)
+		if userID == nil {
+			return nil
+		}
+		recoveryCodes := tx.Bucket(boltRecoveryCodes)
+		var codes []string
+		if !getRecord(recoveryCodes, itob(*userID), &codes) {
+			return nil
+		}
+		idx := slices.Index(codes, codeHash)
+		if idx < 0 {
+			return nil
+		}
+		used = true
+		return putRecord(recoveryCodes, itob(*userID), slices.Delete(codes, idx, idx+1))
+	})
+	if err != nil {
+		return false, errors.New("failed to check recovery code")
+	}
+	return used, nil
+}
+
+func (s *BoltStore) CreateAPIToken(_ context.Context, username string, name string, tokenHash string) (*APIToken, error) {
+	var token *APIToken
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		user := boltFindUser(tx, username)
+		if user == nil {
+			return errors.New("user not found")
+		}
+		hashes := tx.Bucket(boltAPITokenHashes)
+		if hashes.Get([]byte(tokenHash)) != nil {
+			return errors.New("duplicate token hash")
+		}
+		tokens := tx.Bucket(boltAPITokens)
+		id, err := nextID(tokens)
+		if err != nil {
+			return err
+		}
+		token = &APIToken{
+			ID:        id,
+			UserID:    user.ID,
+			Name:      name,
+			TokenHash: tokenHash,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err = hashes.Put([]byte(tokenHash), itob(id)); err != nil {
+			return err
+		}
+		if err = putRecord(tokens, itob(id), token); err != nil {
+			return err
+		}
+		token.Username = user.Username
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("failed to create api token")
+	}
+	return token, nil
+}
+
+func (s *BoltStore) RetrieveAPITokens(_ context.Context, username string) ([]APIToken, error) {
+	tokens := make([]APIToken, 0)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		userID := boltFindUserID(tx, username)
+		if userID == nil {
+			return nil
+		}
+		return tx.Bucket(boltAPITokens).ForEach(func(_, v []byte) error {
+			var token APIToken
+			if err := json.Unmarshal(v, &token); err != nil {
+				return err
+			}
+			if token.UserID == *userID {
+				token.Username = username
+				tokens = append(tokens, token)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.New("failed to retrieve api tokens")
+	}
+	return tokens, nil
+}
+
+func (s *BoltStore) RetrieveAPITokenByHash(_ context.Context, tokenHash string) (*APIToken, error) {
+	var token *APIToken
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		id := tx.Bucket(boltAPITokenHashes).Get([]byte(tokenHash))
+		if id == nil {
+			return nil
+		}
+		tokens := tx.Bucket(boltAPITokens)
+		var found APIToken
+		if !getRecord(tokens, id, &found) {
+			return nil
+		}
+		lastUsedAt := time.Now().UTC()
+		found.LastUsedAt = &lastUsedAt
+		if err := putRecord(tokens, id, &found); err != nil {
+			return err
+		}
+		found.Username = boltUsernameOf(tx, found.UserID)
+		token = &found
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("failed to retrieve api token")
+	}
+	if token == nil {
+		return nil, notFoundError("failed to retrieve api token")
+	}
+	return token, nil
+}
+
+func (s *BoltStore) DeleteAPIToken(_ context.Context, username string, id uint) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		var token APIToken
+		if !getRecord(tx.Bucket(boltAPITokens), itob(id), &token) || boltUsernameOf(tx, token.UserID) != username {
+			return notFoundError("api token not found")
+		}
+		return boltDeleteAPIToken(tx, &token)
+	})
+	if err != nil {
+		return boltError(err, "failed to delete api token")
+	}
+	return nil
+}
+
+func (s *BoltStore) CreateSession(_ context.Context, username string, tokenHash string, expiresAt time.Time) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		userID := boltFindUserID(tx, username)
+		if userID == nil {
+			return errors.New("user not found")
+		}
+		sessions := tx.Bucket(boltSessions)
+		if sessions.Get([]byte(tokenHash)) != nil {
+			return errors.New("duplicate session")
+		}
+		return putRecord(sessions, []byte(tokenHash), &Session{
+			TokenHash: tokenHash,
+			UserID:    *userID,
+			CreatedAt: time.Now().UTC(),
+			ExpiresAt: expiresAt.UTC(),
+		})
+	})
+	if err != nil {
+		return errors.New("failed to create session")
+	}
+	return nil
+}
+
+func (s *BoltStore) RetrieveSession(_ context.Context, tokenHash string) (*Session, error) {
+	var session *Session
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		var found Session
+		if getRecord(tx.Bucket(boltSessions), []byte(tokenHash), &found) && found.ExpiresAt.After(time.Now()) {
+			found.Username = boltUsernameOf(tx, found.UserID)
+			session = &found
+		}
+		return nil
+	})
+	if session == nil {
+		return nil, notFoundError("failed to retrieve session")
+	}
+	return session, nil
+}
+
+func (s *BoltStore) DeleteSession(_ context.Context, tokenHash string) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltSessions).Delete([]byte(tokenHash))
+	})
+	if err != nil {
+		return errors.New("failed to delete session")
+	}
+	return nil
+}
+
+func (s *BoltStore) DeleteSessionsForUser(_ context.Context, username string) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		userID := boltFindUserID(tx, username)
+		if userID == nil {
+			return nil
+		}
+		_, err := boltDeleteKeysWhere(tx.Bucket(boltSessions), func(_, v []byte) bool {
+			var session Session
+			return json.Unmarshal(v, &session) == nil && session.UserID == *userID
+		})
+		return err
+	})
+	if err != nil {
+		return errors.New("failed to delete sessions")
+	}
+	return nil
+}
+
+func (s *BoltStore) DeleteExpiredSessions(_ context.Context) (int64, error) {
+	var deleted int64
+	now := time.Now()
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		deleted, err = boltDeleteKeysWhere(tx.Bucket(boltSessions), func(_, v []byte) bool {
+			var session Session
+			return json.Unmarshal(v, &session) == nil && !session.ExpiresAt.After(now)
+		})
+		return err
+	})
+	if err != nil {
+		return 0, errors.New("failed to delete expired sessions")
+	}
+	return deleted, nil
+}
+
+func (s *BoltStore) createLink(url string, creatorUsername string, teamID *uint) (*Link, error) {
+	var link *Link
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		if teamID != nil && !boltTeamExists(tx, *teamID) {
+			return errors.New("team not found")
+		}
+		id, err := nextID(tx.Bucket(boltLinks))
+		if err != nil {
+			return err
+		}
+		link = &Link{
+			ID:          id,
+			URL:         url,
+			CreatedByID: boltFindUserID(tx, creatorUsername),
+			TeamID:      teamID,
+			CreatedAt:   time.Now().UTC(),
+		}
+		if err = boltPutLink(tx, link); err != nil {
+			return err
+		}
+		boltLinkView(tx, link)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("failed to create new link")
+	}
+	return link, nil
+}
+
+func (s *BoltStore) CreateLink(_ context.Context, url, creatorUsername string) (*Link, error) {
+	return s.createLink(url, creatorUsername, nil)
+}
+
+func (s *BoltStore) RetrieveLink(_ context.Context, id uint) (*Link, error) {
+	var link *Link
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		var found Link
+		if getRecord(tx.Bucket(boltLinks), itob(id), &found) {
+			link = boltLinkView(tx, &found)
+		}
+		return nil
+	})
+	if link == nil {
+		return nil, notFoundError("failed to retrieve link")
+	}
+	return link, nil
+}
+
+func (s *BoltStore) bumpVisits(id uint, count uint) (*Link, error) {
+	var link *Link
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		links := tx.Bucket(boltLinks)
+		var found Link
+		if !getRecord(links, itob(id), &found) {
+			return nil
+		}
+		found.Visits += count
+		if err := putRecord(links, itob(id), &found); err != nil {
+			return err
+		}
+		link = boltLinkView(tx, &found)
+		return nil
+	})
+	return link, err
+}
+
+func (s *BoltStore) IncrementVisits(_ context.Context, id uint, count uint) error {
+	link, err := s.bumpVisits(id, count)
+	if err != nil {
+		return errors.New("failed to increment visits")
+	}
+	if link == nil {
+		slog.Warn(fmt.Sprintf("failed to increment visits: ID=%d, count=%d, RowsAffected=%d", id, count, 0))
+	}
+	return nil
+}
+
+func (s *BoltStore) RetrieveLinkAndBumpVisits(_ context.Context, id uint) (*Link, error) {
+	link, err := s.bumpVisits(id, 1)
+	if err != nil {
+		return nil, errors.New("failed to retrieve link")
+	}
+	if link == nil {
+		return nil, notFoundError("failed to retrieve link")
+	}
+	return link, nil
+}
+
+func (s *BoltStore) DeleteLink(_ context.Context, id uint) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		links := tx.Bucket(boltLinks)
+		var link Link
+		if !getRecord(links, itob(id), &link) {
+			return nil
+		}
+		if err := boltDeleteLinkIndex(tx, &link); err != nil {
+			return err
+		}
+		return links.Delete(itob(id))
+	})
+	if err != nil {
+		return errors.New("failed to delete link")
+	}
+	return nil
+}
+
+func (s *BoltStore) GetLinkCountForUser(_ context.Context, username string) uint {
+	var count uint
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		if userID := boltFindUserID(tx, username); userID != nil {
+			count = uint(len(boltIndexedIDs(tx.Bucket(boltUserLinks), *userID)))
+		}
+		return nil
+	})
+	return count
+}
+
+func (s *BoltStore) RetrieveLinksForUser(_ context.Context, username string, limit int, offset int) ([]Link, error) {
+	links := []Link{}
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		if userID := boltFindUserID(tx, username); userID != nil {
+			links = boltPageLinks(tx, tx.Bucket(boltUserLinks), *userID, limit, offset)
+		}
+		return nil
+	})
+	return links, nil
+}
+
+func (s *BoltStore) CreateTeamLink(_ context.Context, url, creatorUsername string, teamID uint) (*Link, error) {
+	return s.createLink(url, creatorUsername, &teamID)
+}
+
+func (s *BoltStore) GetLinkCountForTeam(_ context.Context, teamID uint) uint {
+	var count uint
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		count = uint(len(boltIndexedIDs(tx.Bucket(boltTeamLinks), teamID)))
+		return nil
+	})
+	return count
+}
+
+func (s *BoltStore) RetrieveLinksForTeam(_ context.Context, teamID uint, limit int, offset int) ([]Link, error) {
+	var links []Link
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		links = boltPageLinks(tx, tx.Bucket(boltTeamLinks), teamID, limit, offset)
+		return nil
+	})
+	return links, nil
+}
+
+func boltTransferLink(tx *bbolt.Tx, link *Link, owner LinkOwner) error {
+	if err := boltDeleteLinkIndex(tx, link); err != nil {
+		return err
+	}
+	if owner.TeamID != 0 {
+		teamID := owner.TeamID
+		link.TeamID = &teamID
+	} else {
+		link.CreatedByID = boltFindUserID(tx, owner.Username)
+		link.TeamID = nil
+	}
+	return boltPutLink(tx, link)
+}
+
+func (s *BoltStore) TransferLink(_ context.Context, id uint, owner LinkOwner) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		var link Link
+		if !getRecord(tx.Bucket(boltLinks), itob(id), &link) {
+			return notFoundError("link not found")
+		}
+		if owner.TeamID != 0 && !boltTeamExists(tx, owner.TeamID) {
+			return errors.New("team not found")
+		}
+		return boltTransferLink(tx, &link, owner)
+	})
+	if err != nil {
+		return boltError(err, "failed to transfer link")
+	}
+	return nil
+}
+
+func (s *BoltStore) TransferUserLinks(_ context.Context, username string, owner LinkOwner) (int64, error) {
+	var moved int64
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		userID := boltFindUserID(tx, username)
+		if userID == nil {
+			return nil
+		}
+		if owner.TeamID != 0 && !boltTeamExists(tx, owner.TeamID) {
+			return errors.New("team not found")
+		}
+		for _, id := range boltIndexedIDs(tx.Bucket(boltUserLinks), *userID) {
+			var link Link
+			if !getRecord(tx.Bucket(boltLinks), itob(id), &link) {
+				continue
+			}
+			if err := boltTransferLink(tx, &link, owner); err != nil {
+				return err
+			}
+			moved++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.New("failed to transfer links")
+	}
+	return moved, nil
+}
+
+func (s *BoltStore) CreateTeam(_ context.Context, name string, ownerUsername string) (*Team, error) {
+	var team *Team
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		if boltFindTeam(tx, name) != nil {
+			return conflictError("%s is already taken", name)
+		}
+		ownerID := boltFindUserID(tx, ownerUsername)
+		if ownerID == nil {
+			return errors.New("user not found")
+		}
+		teams := tx.Bucket(boltTeams)
+		id, err := nextID(teams)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		team = &Team{ID: id, Name: name, CreatedAt: now}
+		if err = tx.Bucket(boltTeamNames).Put([]byte(name), itob(id)); err != nil {
+			return err
+		}
+		if err = putRecord(teams, itob(id), team); err != nil {
+			return err
+		}
+		member := &TeamMember{TeamID: id, UserID: *ownerID, Role: TeamRoleOwner, CreatedAt: now}
+		return putRecord(tx.Bucket(boltTeamMembers), pairKey(id, *ownerID), member)
+	})
+	if err != nil {
+		return nil, boltError(err, "failed to create new team")
+	}
+	return team, nil
+}
+
+func (s *BoltStore) RetrieveAllTeams(_ context.Context) ([]Team, error) {
+	var teams []Team
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltTeamNames).ForEach(func(_, id []byte) error {
+			var team Team
+			if getRecord(tx.Bucket(boltTeams), id, &team) {
+				teams = append(teams, team)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.New("failed to retrieve teams")
+	}
+	return teams, nil
+}
+
+func (s *BoltStore) RetrieveTeam(_ context.Context, name string) (*Team, error) {
+	var team *Team
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		team = boltFindTeam(tx, name)
+		return nil
+	})
+	if team == nil {
+		return nil, notFoundError("failed to retrieve team")
+	}
+	return team, nil
+}
+
+func (s *BoltStore) RetrieveTeamsForUser(_ context.Context, username string) ([]Team, error) {
+	var teams []Team
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		userID := boltFindUserID(tx, username)
+		if userID == nil {
+			return nil
+		}
+		return tx.Bucket(boltTeamMembers).ForEach(func(k, _ []byte) error {
+			var team Team
+			if btoi(k[8:]) == *userID && getRecord(tx.Bucket(boltTeams), k[:8], &team) {
+				teams = append(teams, team)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.New("failed to retrieve teams")
+	}
+	slices.SortFunc(teams, func(a, b Team) int { return cmp.Compare(a.Name, b.Name) })
+	return teams, nil
+}
+
+func (s *BoltStore) DeleteTeam(_ context.Context, id uint) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		if count := len(boltIndexedIDs(tx.Bucket(boltTeamLinks), id)); count > 0 {
+			return conflictError("team still owns %d links, reassign them first", count)
+		}
+		var team Team
+		if !getRecord(tx.Bucket(boltTeams), itob(id), &team) {
+			return nil
+		}
+		if _, err := boltDeleteKeysWhere(tx.Bucket(boltTeamMembers), func(k, _ []byte) bool {
+			return btoi(k[:8]) == id
+		}); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltTeamNames).Delete([]byte(team.Name)); err != nil {
+			return err
+		}
+		return tx.Bucket(boltTeams).Delete(itob(id))
+	})
+	if err != nil {
+		return boltError(err, "failed to delete team")
+	}
+	return nil
+}
+
+func (s *BoltStore) SetTeamMember(_ context.Context, teamID uint, username string, role TeamRole) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		userID := boltFindUserID(tx, username)
+		if userID == nil || !boltTeamExists(tx, teamID) {
+			return errors.New("team member not found")
+		}
+		members := tx.Bucket(boltTeamMembers)
+		member := TeamMember{TeamID: teamID, UserID: *userID, CreatedAt: time.Now().UTC()}
+		getRecord(members, pairKey(teamID, *userID), &member)
+		member.Role = role
+		return putRecord(members, pairKey(teamID, *userID), &member)
+	})
+	if err != nil {
+		return errors.New("failed to update team member")
+	}
+	return nil
+}
+
+func (s *BoltStore) RetrieveTeamMember(_ context.Context, teamID uint, username string) (*TeamMember, error) {
+	var member *TeamMember
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		userID := boltFindUserID(tx, username)
+		if userID == nil {
+			return nil
+		}
+		var found TeamMember
+		if getRecord(tx.Bucket(boltTeamMembers), pairKey(teamID, *userID), &found) {
+			member = boltMemberView(tx, &found)
+		}
+		return nil
+	})
+	if member == nil {
+		return nil, notFoundError("failed to retrieve team member")
+	}
+	return member, nil
+}
+
+func (s *BoltStore) RetrieveTeamMembers(_ context.Context, teamID uint) ([]TeamMember, error) {
+	var members []TeamMember
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		prefix := itob(teamID)
+		c := tx.Bucket(boltTeamMembers).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var member TeamMember
+			if err := json.Unmarshal(v, &member); err != nil {
+				return err
+			}
+			members = append(members, *boltMemberView(tx, &member))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("failed to retrieve team members")
+	}
+	slices.SortFunc(members, func(a, b TeamMember) int { return cmp.Compare(a.Username, b.Username) })
+	return members, nil
+}
+
+func (s *BoltStore) RemoveTeamMember(_ context.Context, teamID uint, username string) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		userID := boltFindUserID(tx, username)
+		if userID == nil {
+			return notFoundError("team member not found")
+		}
+		members := tx.Bucket(boltTeamMembers)
+		if members.Get(pairKey(teamID, *userID)) == nil {
+			return notFoundError("team member not found")
+		}
+		return members.Delete(pairKey(teamID, *userID))
+	})
+	if err != nil {
+		return boltError(err, "failed to remove team member")
+	}
+	return nil
+}
+
+func (s *BoltStore) Ping(_ context.Context) error {
+	if err := s.db.View(func(*bbolt.Tx) error { return nil }); err != nil {
+		return errors.New("failed to reach database")
+	}
+	return nil
+}
+
+func (s *BoltStore) SchemaVersion(_ context.Context) (uint, error) {
+	var version uint
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		value := tx.Bucket(boltMeta).Get(boltSchemaVersionKey)
+		if value == nil {
+			return errors.New("missing schema version")
+		}
+		version = btoi(value)
+		return nil
+	})
+	if err != nil {
+		return 0, errors.New("failed to retrieve schema version")
+	}
+	return version, nil
+}
+
+func (s *BoltStore) Close() {
+	if err := s.db.Close(); err != nil {
+		slog.Warn("failed to close database connection")
+	}
+}
@@ -0,0 +1,986 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+)
+
+const testPassword = "Passw0rd!xyz"
+
+func TestMemoryStoreConformance(t *testing.T) {
+	testStoreConformance(t, func(t *testing.T) Store {
+		store, err := NewMemoryStore("")
+		if err != nil {
+			t.Fatalf("failed to create memory store: %v", err)
+		}
+		return store
+	})
+}
+
+func TestSqliteStoreConformance(t *testing.T) {
+	testStoreConformance(t, func(t *testing.T) Store {
+		conf := &cfg.Config{}
+		conf.Database.Type = "sqlite3"
+		conf.Database.Name = filepath.Join(t.TempDir(), "test.sqlite3")
+		conf.Database.SQLite.JournalMode = "WAL"
+		conf.Database.SQLite.Synchronous = "NORMAL"
+		conf.Database.SQLite.BusyTimeout = 5 * time.Second
+		conf.Database.SQLite.MaxOpenConns = 4
+		return newTestStore(t, conf)
+	})
+}
+
+func TestBoltStoreConformance(t *testing.T) {
+	testStoreConformance(t, func(t *testing.T) Store {
+		conf := &cfg.Config{}
+		conf.Database.Type = "bolt"
+		conf.Database.Name = filepath.Join(t.TempDir(), "test.bolt")
+		return newTestStore(t, conf)
+	})
+}
+
+func TestPostgresStoreConformance(t *testing.T) {
+	rawURL := os.Getenv("SLS_TEST_POSTGRES_URL")
+	if rawURL == "" {
+		t.Skip("SLS_TEST_POSTGRES_URL is not set")
+	}
+	testStoreConformance(t, func(t *testing.T) Store {
+		conf := newTestConfigFromURL(t, "postgresql", rawURL)
+		resetDatabase(t, conf, "DROP TABLE IF EXISTS "+testTables+" CASCADE")
+		return newTestStore(t, conf)
+	})
+}
+
+func TestMysqlStoreConformance(t *testing.T) {
+	rawURL := os.Getenv("SLS_TEST_MYSQL_URL")
+	if rawURL == "" {
+		t.Skip("SLS_TEST_MYSQL_URL is not set")
+	}
+	testStoreConformance(t, func(t *testing.T) Store {
+		conf := newTestConfigFromURL(t, "mysql", rawURL)
+		resetDatabase(t, conf, "SET FOREIGN_KEY_CHECKS = 0; DROP TABLE IF EXISTS "+testTables+"; SET FOREIGN_KEY_CHECKS = 1")
+		return newTestStore(t, conf)
+	})
+}
+
+const testTables = "team_members, sessions, api_tokens, recovery_codes, login_events, links, teams, users, schema_version"
+
+func newTestConfigFromURL(t *testing.T, dbType string, rawURL string) *cfg.Config {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("invalid database url: %v", err)
+	}
+	port, err := strconv.ParseUint(u.Port(), 10, 16)
+	if err != nil {
+		t.Fatalf("invalid database port: %v", err)
+	}
+
+	conf := &cfg.Config{}
+	conf.Database.Type = dbType
+	conf.Database.Host = u.Hostname()
+	conf.Database.Port = uint16(port)
+	conf.Database.Username = u.User.Username()
+	conf.Database.Password, _ = u.User.Password()
+	conf.Database.Name = u.Path[1:]
+	if query := u.Query(); len(query) > 0 {
+		conf.Database.ExtraArgs = make(map[string]string)
+		for k := range query {
+			conf.Database.ExtraArgs[k] = query.Get(k)
+		}
+	}
+	return conf
+}
+
+func resetDatabase(t *testing.T, conf *cfg.Config, query string) {
+	t.Helper()
+
+	db, err := connect(conf)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if _, err = db.Exec(query); err != nil {
+		t.Fatalf("failed to reset database: %v", err)
+	}
+}
+
+func newTestStore(t *testing.T, conf *cfg.Config) Store {
+	t.Helper()
+
+	store, err := NewStore(conf)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	return store
+}
+
+func testStoreConformance(t *testing.T, newStore func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s Store)
+	}{
+		{"Schema", testSchema},
+		{"Users", testUsers},
+		{"Links", testLinks},
+		{"Pagination", testPagination},
+		{"ConcurrentVisits", testConcurrentVisits},
+		{"Teams", testTeams},
+		{"Credentials", testCredentials},
+		{"Sessions", testSessions},
+		{"LoginTracking", testLoginTracking},
+		{"OIDCIdentities", testOIDCIdentities},
+		{"Conflicts", testConflicts},
+		{"NotFound", testNotFound},
+		{"Timestamps", testTimestamps},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStore(t)
+			t.Cleanup(s.Close)
+			tt.fn(t, s)
+		})
+	}
+}
+
+func mustCreateUser(t *testing.T, s Store, username string) *User {
+	t.Helper()
+
+	user, err := s.CreateUser(context.Background(), username, testPassword, DefaultRole)
+	if err != nil {
+		t.Fatalf("failed to create user %s: %v", username, err)
+	}
+	return user
+}
+
+func mustCreateLink(t *testing.T, s Store, url string, username string) *Link {
+	t.Helper()
+
+	link, err := s.CreateLink(context.Background(), url, username)
+	if err != nil {
+		t.Fatalf("failed to create link: %v", err)
+	}
+	return link
+}
+
+func mustCreateTeam(t *testing.T, s Store, name string, owner string) *Team {
+	t.Helper()
+
+	team, err := s.CreateTeam(context.Background(), name, owner)
+	if err != nil {
+		t.Fatalf("failed to create team %s: %v", name, err)
+	}
+	return team
+}
+
+func linkIDs(links []Link) []uint {
+	ids := make([]uint, len(links))
+	for i, link := range links {
+		ids[i] = link.ID
+	}
+	return ids
+}
+
+func equalIDs(a []uint, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func expectKind(t *testing.T, err error, kind error, operation string) {
+	t.Helper()
+
+	if !errors.Is(err, kind) {
+		t.Errorf("%s: expected %v error, got %v", operation, kind, err)
+	}
+}
+
+func expectWithin(t *testing.T, got time.Time, want time.Time, tolerance time.Duration, field string) {
+	t.Helper()
+
+	if diff := got.Sub(want).Abs(); diff > tolerance {
+		t.Errorf("%s: expected %s, got %s", field, want, got)
+	}
+}
+
+func testSchema(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	if err := s.Ping(ctx); err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+	version, err := s.SchemaVersion(ctx)
+	if err != nil {
+		t.Fatalf("failed to retrieve schema version: %v", err)
+	}
+	if version != CurrentSchemaVersion {
+		t.Errorf("expected schema version %d, got %d", CurrentSchemaVersion, version)
+	}
+}
+
+func testUsers(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	alice := mustCreateUser(t, s, "alice")
+	bob := mustCreateUser(t, s, "bob")
+	if alice.ID == 0 || bob.ID == 0 || alice.ID == bob.ID {
+		t.Fatalf("expected distinct user ids, got %d and %d", alice.ID, bob.ID)
+	}
+	if alice.Username != "alice" || alice.Role != DefaultRole {
+		t.Errorf("unexpected user: %+v", alice)
+	}
+	if alice.Password == testPassword || bcrypt.CompareHashAndPassword([]byte(alice.Password), []byte(testPassword)) != nil {
+		t.Error("password is not stored as a bcrypt hash")
+	}
+
+	carol, err := s.CreateUser(ctx, "carol", testPassword, RoleViewer)
+	if err != nil {
+		t.Fatalf("failed to create user with a role: %v", err)
+	}
+	if carol.Role != RoleViewer {
+		t.Errorf("expected role %s, got %+v", RoleViewer, carol)
+	}
+
+	users, err := s.RetrieveAllUsers(ctx)
+	if err != nil {
+		t.Fatalf("failed to retrieve users: %v", err)
+	}
+	if len(users) != 3 || users[0].Username != "alice" || users[1].Username != "bob" || users[2].Role != RoleViewer {
+		t.Errorf("expected alice, bob and carol, got %+v", users)
+	}
+
+	if err = s.UpdatePassword(ctx, "alice", "an0ther!Password"); err != nil {
+		t.Fatalf("failed to update password: %v", err)
+	}
+	if err = s.SetRole(ctx, "alice", RoleAdmin); err != nil {
+		t.Fatalf("failed to set role: %v", err)
+	}
+	if err = s.CreateLoginEvent(ctx, &LoginEvent{Username: "alice", Success: true, Method: "password"}); err != nil {
+		t.Fatalf("failed to record login event: %v", err)
+	}
+	if err = s.UpdateUsername(ctx, "alice", "alicia"); err != nil {
+		t.Fatalf("failed to rename user: %v", err)
+	}
+	events, err := s.RetrieveLoginEvents(ctx, "alicia", 10, 0)
+	if err != nil {
+		t.Fatalf("failed to retrieve login events: %v", err)
+	}
+	if len(events) != 1 || events[0].Username != "alice" || events[0].UserID == nil || *events[0].UserID != alice.ID {
+		t.Errorf("expected the login event to keep its username and follow the user, got %+v", events)
+	}
+
+	renamed, err := s.RetrieveUser(ctx, "alicia")
+	if err != nil {
+		t.Fatalf("failed to retrieve renamed user: %v", err)
+	}
+	if renamed.ID != alice.ID || renamed.Role != RoleAdmin {
+		t.Errorf("unexpected renamed user: %+v", renamed)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(renamed.Password), []byte("an0ther!Password")) != nil {
+		t.Error("password was not updated")
+	}
+	if _, err = s.RetrieveUser(ctx, "alice"); err == nil {
+		t.Error("old username still resolves after rename")
+	}
+
+	if err = s.DeleteUser(ctx, "bob"); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+	if _, err = s.RetrieveUser(ctx, "bob"); err == nil {
+		t.Error("deleted user still exists")
+	}
+
+	if err = s.CreateLoginEvent(ctx, &LoginEvent{Username: "bob", Method: "password", Reason: "unknown_user"}); err != nil {
+		t.Fatalf("failed to record login event: %v", err)
+	}
+	mustCreateUser(t, s, "bob")
+	if events, _ = s.RetrieveLoginEvents(ctx, "bob", 10, 0); len(events) != 0 {
+		t.Errorf("login events of an unknown username were attributed to a new user: %+v", events)
+	}
+}
+
+func testLinks(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	alice := mustCreateUser(t, s, "alice")
+	mustCreateUser(t, s, "bob")
+
+	link := mustCreateLink(t, s, "https://example.com/a", "alice")
+	if link.ID == 0 || link.URL != "https://example.com/a" || link.Visits != 0 || link.TeamID != nil {
+		t.Errorf("unexpected link: %+v", link)
+	}
+	if link.CreatedByID == nil || *link.CreatedByID != alice.ID || link.CreatedBy == nil || *link.CreatedBy != "alice" {
+		t.Errorf("link creator not recorded: %+v", link)
+	}
+
+	found, err := s.RetrieveLink(ctx, link.ID)
+	if err != nil {
+		t.Fatalf("failed to retrieve link: %v", err)
+	}
+	if found.URL != link.URL || found.CreatedBy == nil || *found.CreatedBy != "alice" {
+		t.Errorf("unexpected link: %+v", found)
+	}
+
+	if err = s.TransferLink(ctx, link.ID, LinkOwner{Username: "bob"}); err != nil {
+		t.Fatalf("failed to transfer link: %v", err)
+	}
+	if s.GetLinkCountForUser(ctx, "alice") != 0 || s.GetLinkCountForUser(ctx, "bob") != 1 {
+		t.Error("link count not updated after transfer")
+	}
+
+	mustCreateLink(t, s, "https://example.com/b", "alice")
+	mustCreateLink(t, s, "https://example.com/c", "alice")
+	moved, err := s.TransferUserLinks(ctx, "alice", LinkOwner{Username: "bob"})
+	if err != nil {
+		t.Fatalf("failed to transfer user links: %v", err)
+	}
+	if moved != 2 || s.GetLinkCountForUser(ctx, "bob") != 3 {
+		t.Errorf("expected 2 links moved to bob, got %d", moved)
+	}
+
+	if err = s.DeleteLink(ctx, link.ID); err != nil {
+		t.Fatalf("failed to delete link: %v", err)
+	}
+	if _, err = s.RetrieveLink(ctx, link.ID); err == nil {
+		t.Error("deleted link still exists")
+	}
+	if s.GetLinkCountForUser(ctx, "bob") != 2 {
+		t.Error("link count not updated after delete")
+	}
+
+	expectKind(t, s.DeleteUser(ctx, "bob"), ErrConflict, "delete user who still owns links")
+}
+
+func testPagination(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	mustCreateUser(t, s, "alice")
+	mustCreateUser(t, s, "bob")
+	team := mustCreateTeam(t, s, "ops", "alice")
+
+	var userLinks, teamLinks []uint
+	for i := 0; i < 5; i++ {
+		userLinks = append([]uint{mustCreateLink(t, s, "https://example.com/u"+strconv.Itoa(i), "alice").ID}, userLinks...)
+		mustCreateLink(t, s, "https://example.com/b"+strconv.Itoa(i), "bob")
+		link, err := s.CreateTeamLink(ctx, "https://example.com/t"+strconv.Itoa(i), "alice", team.ID)
+		if err != nil {
+			t.Fatalf("failed to create team link: %v", err)
+		}
+		teamLinks = append([]uint{link.ID}, teamLinks...)
+	}
+
+	if count := s.GetLinkCountForUser(ctx, "alice"); count != 5 {
+		t.Errorf("expected 5 personal links, got %d", count)
+	}
+	if count := s.GetLinkCountForTeam(ctx, team.ID); count != 5 {
+		t.Errorf("expected 5 team links, got %d", count)
+	}
+
+	pages := []struct {
+		limit  int
+		offset int
+		from   int
+		to     int
+	}{
+		{2, 0, 0, 2},
+		{2, 2, 2, 4},
+		{2, 4, 4, 5},
+		{2, 6, 5, 5},
+		{10, 0, 0, 5},
+	}
+	for _, page := range pages {
+		links, err := s.RetrieveLinksForUser(ctx, "alice", page.limit, page.offset)
+		if err != nil {
+			t.Fatalf("failed to retrieve user links: %v", err)
+		}
+		if got, want := linkIDs(links), userLinks[page.from:page.to]; !equalIDs(got, want) {
+			t.Errorf("user links limit=%d offset=%d: expected %v, got %v", page.limit, page.offset, want, got)
+		}
+
+		links, err = s.RetrieveLinksForTeam(ctx, team.ID, page.limit, page.offset)
+		if err != nil {
+			t.Fatalf("failed to retrieve team links: %v", err)
+		}
+		if got, want := linkIDs(links), teamLinks[page.from:page.to]; !equalIDs(got, want) {
+			t.Errorf("team links limit=%d offset=%d: expected %v, got %v", page.limit, page.offset, want, got)
+		}
+	}
+}
+
+func testConcurrentVisits(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	mustCreateUser(t, s, "alice")
+	link := mustCreateLink(t, s, "https://example.com", "alice")
+
+	const workers, rounds = 8, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*rounds*2)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				if err := s.IncrementVisits(ctx, link.ID, 2); err != nil {
+					errs <- err
+				}
+				if _, err := s.RetrieveLinkAndBumpVisits(ctx, link.ID); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent visit update failed: %v", err)
+	}
+
+	found, err := s.RetrieveLink(ctx, link.ID)
+	if err != nil {
+		t.Fatalf("failed to retrieve link: %v", err)
+	}
+	if want := uint(workers * rounds * 3); found.Visits != want {
+		t.Errorf("expected %d visits, got %d", want, found.Visits)
+	}
+
+	bumped, err := s.RetrieveLinkAndBumpVisits(ctx, link.ID)
+	if err != nil {
+		t.Fatalf("failed to bump visits: %v", err)
+	}
+	if bumped.Visits != found.Visits+1 || bumped.URL != link.URL {
+		t.Errorf("unexpected bumped link: %+v", bumped)
+	}
+}
+
+func testTeams(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	mustCreateUser(t, s, "alice")
+	mustCreateUser(t, s, "bob")
+	mustCreateUser(t, s, "carol")
+
+	ops := mustCreateTeam(t, s, "ops", "alice")
+	dev := mustCreateTeam(t, s, "dev", "bob")
+	if ops.ID == 0 || ops.Name != "ops" {
+		t.Errorf("unexpected team: %+v", ops)
+	}
+
+	owner, err := s.RetrieveTeamMember(ctx, ops.ID, "alice")
+	if err != nil {
+		t.Fatalf("failed to retrieve team owner: %v", err)
+	}
+	if owner.Role != TeamRoleOwner || owner.Username != "alice" {
+		t.Errorf("unexpected team owner: %+v", owner)
+	}
+
+	if err = s.SetTeamMember(ctx, ops.ID, "carol", TeamRoleViewer); err != nil {
+		t.Fatalf("failed to add team member: %v", err)
+	}
+	if err = s.SetTeamMember(ctx, ops.ID, "carol", TeamRoleEditor); err != nil {
+		t.Fatalf("failed to update team member: %v", err)
+	}
+	if err = s.SetTeamMember(ctx, ops.ID, "bob", TeamRoleViewer); err != nil {
+		t.Fatalf("failed to add team member: %v", err)
+	}
+
+	members, err := s.RetrieveTeamMembers(ctx, ops.ID)
+	if err != nil {
+		t.Fatalf("failed to retrieve team members: %v", err)
+	}
+	if len(members) != 3 || members[0].Username != "alice" || members[1].Username != "bob" || members[2].Username != "carol" {
+		t.Fatalf("expected members ordered by username, got %+v", members)
+	}
+	if members[2].Role != TeamRoleEditor {
+		t.Errorf("expected carol to be an editor, got %s", members[2].Role)
+	}
+
+	teams, err := s.RetrieveAllTeams(ctx)
+	if err != nil {
+		t.Fatalf("failed to retrieve teams: %v", err)
+	}
+	if len(teams) != 2 || teams[0].ID != dev.ID || teams[1].ID != ops.ID {
+		t.Errorf("expected teams ordered by name, got %+v", teams)
+	}
+
+	teams, err = s.RetrieveTeamsForUser(ctx, "bob")
+	if err != nil {
+		t.Fatalf("failed to retrieve teams for user: %v", err)
+	}
+	if len(teams) != 2 {
+		t.Errorf("expected bob in 2 teams, got %+v", teams)
+	}
+
+	if err = s.RemoveTeamMember(ctx, ops.ID, "bob"); err != nil {
+		t.Fatalf("failed to remove team member: %v", err)
+	}
+	if _, err = s.RetrieveTeamMember(ctx, ops.ID, "bob"); err == nil {
+		t.Error("removed member still exists")
+	}
+
+	link, err := s.CreateTeamLink(ctx, "https://example.com", "carol", ops.ID)
+	if err != nil {
+		t.Fatalf("failed to create team link: %v", err)
+	}
+	if link.TeamID == nil || *link.TeamID != ops.ID {
+		t.Errorf("team link not assigned to team: %+v", link)
+	}
+	expectKind(t, s.DeleteTeam(ctx, ops.ID), ErrConflict, "delete team that still owns links")
+	if err = s.TransferLink(ctx, link.ID, LinkOwner{Username: "carol"}); err != nil {
+		t.Fatalf("failed to transfer link: %v", err)
+	}
+	if err = s.DeleteTeam(ctx, ops.ID); err != nil {
+		t.Fatalf("failed to delete team: %v", err)
+	}
+	if _, err = s.RetrieveTeam(ctx, "ops"); err == nil {
+		t.Error("deleted team still exists")
+	}
+	if _, err = s.RetrieveTeamMember(ctx, ops.ID, "alice"); err == nil {
+		t.Error("members of deleted team still exist")
+	}
+
+	if err = s.DeleteUser(ctx, "bob"); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+	members, err = s.RetrieveTeamMembers(ctx, dev.ID)
+	if err != nil {
+		t.Fatalf("failed to retrieve team members: %v", err)
+	}
+	if len(members) != 0 {
+		t.Errorf("memberships of deleted user still exist: %+v", members)
+	}
+}
+
+func testCredentials(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	alice := mustCreateUser(t, s, "alice")
+	mustCreateUser(t, s, "bob")
+
+	if err := s.SetTOTPSecret(ctx, "alice", "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatalf("failed to set totp secret: %v", err)
+	}
+	if err := s.EnableTOTP(ctx, "alice", []string{"code-1", "code-2"}); err != nil {
+		t.Fatalf("failed to enable totp: %v", err)
+	}
+	user, err := s.RetrieveUser(ctx, "alice")
+	if err != nil {
+		t.Fatalf("failed to retrieve user: %v", err)
+	}
+	if !user.TOTPEnabled || user.TOTPSecret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("totp not enabled: %+v", user)
+	}
+	if used, _ := s.UseRecoveryCode(ctx, "bob", "code-1"); used {
+		t.Error("recovery code accepted for another user")
+	}
+	if used, _ := s.UseRecoveryCode(ctx, "alice", "code-1"); !used {
+		t.Error("valid recovery code rejected")
+	}
+	if used, _ := s.UseRecoveryCode(ctx, "alice", "code-1"); used {
+		t.Error("recovery code accepted twice")
+	}
+	if err = s.DisableTOTP(ctx, "alice"); err != nil {
+		t.Fatalf("failed to disable totp: %v", err)
+	}
+	if used, _ := s.UseRecoveryCode(ctx, "alice", "code-2"); used {
+		t.Error("recovery code survived disabling totp")
+	}
+
+	first, err := s.CreateAPIToken(ctx, "alice", "ci", "hash-1")
+	if err != nil {
+		t.Fatalf("failed to create api token: %v", err)
+	}
+	if first.ID == 0 || first.UserID != alice.ID || first.Username != "alice" || first.LastUsedAt != nil {
+		t.Errorf("unexpected api token: %+v", first)
+	}
+	second, err := s.CreateAPIToken(ctx, "alice", "deploy", "hash-2")
+	if err != nil {
+		t.Fatalf("failed to create api token: %v", err)
+	}
+
+	tokens, err := s.RetrieveAPITokens(ctx, "alice")
+	if err != nil {
+		t.Fatalf("failed to retrieve api tokens: %v", err)
+	}
+	if len(tokens) != 2 || tokens[0].ID != first.ID || tokens[1].ID != second.ID {
+		t.Errorf("expected tokens in creation order, got %+v", tokens)
+	}
+
+	token, err := s.RetrieveAPITokenByHash(ctx, "hash-1")
+	if err != nil {
+		t.Fatalf("failed to retrieve api token: %v", err)
+	}
+	if token.ID != first.ID || token.Username != "alice" || token.LastUsedAt == nil {
+		t.Errorf("api token lookup did not record usage: %+v", token)
+	}
+
+	if err = s.DeleteAPIToken(ctx, "bob", first.ID); err == nil {
+		t.Error("deleted another user's api token")
+	}
+	if err = s.DeleteAPIToken(ctx, "alice", first.ID); err != nil {
+		t.Fatalf("failed to delete api token: %v", err)
+	}
+	if _, err = s.RetrieveAPITokenByHash(ctx, "hash-1"); err == nil {
+		t.Error("deleted api token still resolves")
+	}
+}
+
+func testSessions(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	alice := mustCreateUser(t, s, "alice")
+	mustCreateUser(t, s, "bob")
+
+	if err := s.CreateSession(ctx, "alice", "session-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	if err := s.CreateSession(ctx, "alice", "session-2", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	if err := s.CreateSession(ctx, "bob", "session-3", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	session, err := s.RetrieveSession(ctx, "session-1")
+	if err != nil {
+		t.Fatalf("failed to retrieve session: %v", err)
+	}
+	if session.UserID != alice.ID || session.Username != "alice" {
+		t.Errorf("unexpected session: %+v", session)
+	}
+	if _, err = s.RetrieveSession(ctx, "session-3"); err == nil {
+		t.Error("expired session still resolves")
+	}
+
+	removed, err := s.DeleteExpiredSessions(ctx)
+	if err != nil {
+		t.Fatalf("failed to delete expired sessions: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 expired session removed, got %d", removed)
+	}
+
+	if err = s.DeleteSession(ctx, "session-1"); err != nil {
+		t.Fatalf("failed to delete session: %v", err)
+	}
+	if _, err = s.RetrieveSession(ctx, "session-1"); err == nil {
+		t.Error("deleted session still resolves")
+	}
+	if err = s.DeleteSessionsForUser(ctx, "alice"); err != nil {
+		t.Fatalf("failed to delete sessions: %v", err)
+	}
+	if _, err = s.RetrieveSession(ctx, "session-2"); err == nil {
+		t.Error("session survived deleting all sessions of its user")
+	}
+
+	if err = s.CreateSession(ctx, "bob", "session-4", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	if err = s.DeleteUser(ctx, "bob"); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+	if _, err = s.RetrieveSession(ctx, "session-4"); err == nil {
+		t.Error("session survived deleting its user")
+	}
+}
+
+func testOIDCIdentities(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	identity := OIDCIdentity{Issuer: "https://idp.example", Subject: "1001"}
+	if _, err := s.RetrieveUserByOIDCIdentity(ctx, identity); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	user, err := s.CreateOIDCUser(ctx, "alice", testPassword, RoleAdmin, identity)
+	if err != nil {
+		t.Fatalf("failed to create oidc user: %v", err)
+	}
+	if user.Role != RoleAdmin || user.OIDCIssuer == nil || *user.OIDCIssuer != identity.Issuer || *user.OIDCSubject != identity.Subject {
+		t.Errorf("unexpected user %+v", user)
+	}
+	if _, err = s.CreateOIDCUser(ctx, "alice2", testPassword, DefaultRole, identity); err == nil {
+		t.Error("created a second user with the same identity")
+	}
+
+	found, err := s.RetrieveUserByOIDCIdentity(ctx, identity)
+	if err != nil || found.ID != user.ID {
+		t.Fatalf("failed to retrieve user by identity: %+v, %v", found, err)
+	}
+	if _, err = s.RetrieveUserByOIDCIdentity(ctx, OIDCIdentity{Issuer: "https://other.example", Subject: "1001"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("identity matched a different issuer: %v", err)
+	}
+
+	bob := mustCreateUser(t, s, "bob")
+	if bob.OIDCIssuer != nil {
+		t.Errorf("password user has an identity: %+v", bob)
+	}
+	if err = s.LinkOIDCIdentity(ctx, "bob", identity); err == nil {
+		t.Error("linked an identity that belongs to another user")
+	}
+	other := OIDCIdentity{Issuer: "https://idp.example", Subject: "1002"}
+	if err = s.LinkOIDCIdentity(ctx, "bob", other); err != nil {
+		t.Fatalf("failed to link identity: %v", err)
+	}
+	if err = s.LinkOIDCIdentity(ctx, "bob", OIDCIdentity{Issuer: "https://idp.example", Subject: "1003"}); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected ErrConflict relinking a linked user, got %v", err)
+	}
+	if found, err = s.RetrieveUserByOIDCIdentity(ctx, other); err != nil || found.Username != "bob" {
+		t.Fatalf("failed to retrieve linked user: %+v, %v", found, err)
+	}
+
+	if err = s.DeleteUser(ctx, "bob"); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+	if _, err = s.RetrieveUserByOIDCIdentity(ctx, other); !errors.Is(err, ErrNotFound) {
+		t.Errorf("identity survived deleting its user: %v", err)
+	}
+	if _, err = s.CreateOIDCUser(ctx, "bob", testPassword, DefaultRole, other); err != nil {
+		t.Errorf("failed to reuse the identity of a deleted user: %v", err)
+	}
+}
+
+func testLoginTracking(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	mustCreateUser(t, s, "alice")
+
+	for i := 0; i < 2; i++ {
+		if locked, err := s.RecordLoginFailure(ctx, "alice", 3, time.Minute); err != nil || locked {
+			t.Fatalf("failed to record login failure: locked=%v, %v", locked, err)
+		}
+	}
+	user, _ := s.RetrieveUser(ctx, "alice")
+	if user.FailedAttempts != 2 || user.IsLocked() {
+		t.Errorf("expected 2 failed attempts and no lock, got %+v", user)
+	}
+	if err := s.RefundLoginFailure(ctx, "alice"); err != nil {
+		t.Fatalf("failed to refund login failure: %v", err)
+	}
+	user, _ = s.RetrieveUser(ctx, "alice")
+	if user.FailedAttempts != 1 {
+		t.Errorf("expected 1 failed attempt after a refund, got %+v", user)
+	}
+	if err := s.ResetLoginFailures(ctx, "alice"); err != nil {
+		t.Fatalf("failed to reset login failures: %v", err)
+	}
+	user, _ = s.RetrieveUser(ctx, "alice")
+	if user.FailedAttempts != 0 {
+		t.Errorf("failed attempts not reset: %+v", user)
+	}
+
+	for i := 0; i < 3; i++ {
+		if locked, err := s.RecordLoginFailure(ctx, "alice", 3, time.Minute); err != nil || locked {
+			t.Fatalf("attempt %d: locked=%v, %v", i+1, locked, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if locked, err := s.RecordLoginFailure(ctx, "alice", 3, time.Minute); err != nil || !locked {
+			t.Fatalf("expected attempts beyond the limit to be locked: locked=%v, %v", locked, err)
+		}
+	}
+	user, _ = s.RetrieveUser(ctx, "alice")
+	if !user.IsLocked() || user.FailedAttempts != 0 {
+		t.Errorf("expected user to be locked, got %+v", user)
+	}
+	if err := s.UnlockUser(ctx, "alice"); err != nil {
+		t.Fatalf("failed to unlock user: %v", err)
+	}
+	user, _ = s.RetrieveUser(ctx, "alice")
+	if user.IsLocked() {
+		t.Errorf("user still locked: %+v", user)
+	}
+
+	for _, tt := range []struct {
+		maxAttempts uint
+		lockout     time.Duration
+	}{{0, time.Minute}, {3, 0}} {
+		if locked, err := s.RecordLoginFailure(ctx, "alice", tt.maxAttempts, tt.lockout); err != nil || locked {
+			t.Fatalf("failed to record login failure: locked=%v, %v", locked, err)
+		}
+	}
+	user, _ = s.RetrieveUser(ctx, "alice")
+	if user.FailedAttempts != 0 {
+		t.Errorf("failures counted with lockout disabled: %+v", user)
+	}
+
+	for _, reason := range []string{"bad_password", "bad_totp", ""} {
+		event := &LoginEvent{Username: "alice", Success: reason == "", Method: "password", Reason: reason, IP: "127.0.0.1", UserAgent: "test"}
+		if err := s.CreateLoginEvent(ctx, event); err != nil {
+			t.Fatalf("failed to record login event: %v", err)
+		}
+	}
+	events, err := s.RetrieveLoginEvents(ctx, "alice", 2, 0)
+	if err != nil {
+		t.Fatalf("failed to retrieve login events: %v", err)
+	}
+	if len(events) != 2 || !events[0].Success || events[1].Reason != "bad_totp" {
+		t.Errorf("expected newest login events first, got %+v", events)
+	}
+	events, _ = s.RetrieveLoginEvents(ctx, "alice", 2, 2)
+	if len(events) != 1 || events[0].Reason != "bad_password" {
+		t.Errorf("unexpected second page of login events: %+v", events)
+	}
+	events, _ = s.RetrieveLoginEvents(ctx, "bob", 10, 0)
+	if len(events) != 0 {
+		t.Errorf("expected no login events for bob, got %+v", events)
+	}
+}
+
+func testConflicts(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	mustCreateUser(t, s, "alice")
+	mustCreateUser(t, s, "bob")
+	mustCreateTeam(t, s, "ops", "alice")
+
+	_, err := s.CreateUser(ctx, "alice", testPassword, DefaultRole)
+	expectKind(t, err, ErrConflict, "create duplicate user")
+
+	err = s.UpdateUsername(ctx, "bob", "alice")
+	expectKind(t, err, ErrConflict, "rename to taken username")
+	if _, err = s.RetrieveUser(ctx, "bob"); err != nil {
+		t.Errorf("failed rename changed the user: %v", err)
+	}
+
+	_, err = s.CreateTeam(ctx, "ops", "bob")
+	expectKind(t, err, ErrConflict, "create duplicate team")
+
+	if _, err = s.CreateAPIToken(ctx, "alice", "ci", "hash-1"); err != nil {
+		t.Fatalf("failed to create api token: %v", err)
+	}
+	if _, err = s.CreateAPIToken(ctx, "bob", "ci", "hash-1"); err == nil {
+		t.Error("created api token with duplicate hash")
+	}
+
+	if err = s.CreateSession(ctx, "alice", "session-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	if err = s.CreateSession(ctx, "bob", "session-1", time.Now().Add(time.Hour)); err == nil {
+		t.Error("created session with duplicate hash")
+	}
+}
+
+func testNotFound(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	mustCreateUser(t, s, "alice")
+	team := mustCreateTeam(t, s, "ops", "alice")
+
+	_, err := s.RetrieveUser(ctx, "nobody")
+	expectKind(t, err, ErrNotFound, "retrieve user")
+	expectKind(t, s.UpdateUsername(ctx, "nobody", "somebody"), ErrNotFound, "rename user")
+	expectKind(t, s.SetRole(ctx, "nobody", RoleAdmin), ErrNotFound, "set role")
+	expectKind(t, s.DeleteUser(ctx, "nobody"), ErrNotFound, "delete user")
+
+	_, err = s.RetrieveLink(ctx, 999)
+	expectKind(t, err, ErrNotFound, "retrieve link")
+	_, err = s.RetrieveLinkAndBumpVisits(ctx, 999)
+	expectKind(t, err, ErrNotFound, "bump visits")
+	expectKind(t, s.TransferLink(ctx, 999, LinkOwner{Username: "alice"}), ErrNotFound, "transfer link")
+
+	_, err = s.RetrieveTeam(ctx, "nobody")
+	expectKind(t, err, ErrNotFound, "retrieve team")
+	_, err = s.RetrieveTeamMember(ctx, team.ID, "nobody")
+	expectKind(t, err, ErrNotFound, "retrieve team member")
+	expectKind(t, s.RemoveTeamMember(ctx, team.ID, "nobody"), ErrNotFound, "remove team member")
+
+	_, err = s.RetrieveAPITokenByHash(ctx, "missing")
+	expectKind(t, err, ErrNotFound, "retrieve api token")
+	expectKind(t, s.DeleteAPIToken(ctx, "alice", 999), ErrNotFound, "delete api token")
+	_, err = s.RetrieveSession(ctx, "missing")
+	expectKind(t, err, ErrNotFound, "retrieve session")
+
+	if errors.Is(err, ErrConflict) {
+		t.Error("not found error also reports a conflict")
+	}
+}
+
+func testTimestamps(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	before := time.Now().Add(-time.Second)
+	user := mustCreateUser(t, s, "alice")
+	link := mustCreateLink(t, s, "https://example.com", "alice")
+	team := mustCreateTeam(t, s, "ops", "alice")
+	after := time.Now().Add(time.Second)
+
+	for field, ts := range map[string]time.Time{"user": user.CreatedAt, "link": link.CreatedAt, "team": team.CreatedAt} {
+		if ts.Before(before) || ts.After(after) {
+			t.Errorf("%s created_at %s outside of [%s, %s]", field, ts, before, after)
+		}
+	}
+
+	zone := time.FixedZone("UTC+9", 9*60*60)
+	expiresAt := time.Now().Add(2 * time.Hour).In(zone)
+	if err := s.CreateSession(ctx, "alice", "session-1", expiresAt); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	session, err := s.RetrieveSession(ctx, "session-1")
+	if err != nil {
+		t.Fatalf("failed to retrieve session created in another time zone: %v", err)
+	}
+	expectWithin(t, session.ExpiresAt, expiresAt, time.Millisecond, "session expires_at")
+
+	if err = s.CreateSession(ctx, "alice", "session-2", time.Now().Add(-time.Minute).In(zone)); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	if _, err = s.RetrieveSession(ctx, "session-2"); err == nil {
+		t.Error("expired session created in another time zone still resolves")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err = s.RecordLoginFailure(ctx, "alice", 1, time.Hour); err != nil {
+			t.Fatalf("failed to record login failure: %v", err)
+		}
+	}
+	user, _ = s.RetrieveUser(ctx, "alice")
+	if user.LockedUntil == nil {
+		t.Fatal("expected user to be locked")
+	}
+	expectWithin(t, *user.LockedUntil, time.Now().Add(time.Hour), 5*time.Second, "locked_until")
+
+	if err = s.CreateLoginEvent(ctx, &LoginEvent{Username: "alice", Method: "password", UserAgent: "test"}); err != nil {
+		t.Fatalf("failed to record login event: %v", err)
+	}
+	events, _ := s.RetrieveLoginEvents(ctx, "alice", 10, 0)
+	if len(events) != 1 {
+		t.Fatalf("expected 1 login event, got %d", len(events))
+	}
+	expectWithin(t, events[0].CreatedAt, time.Now(), 5*time.Second, "login event created_at")
+
+	removed, err := s.DeleteLoginEventsBefore(ctx, time.Now().Add(-time.Hour).In(zone))
+	if err != nil {
+		t.Fatalf("failed to delete login events: %v", err)
+	}
+	if removed != 0 {
+		t.Errorf("deleted %d login events newer than the cutoff", removed)
+	}
+	removed, err = s.DeleteLoginEventsBefore(ctx, time.Now().Add(time.Hour).In(zone))
+	if err != nil {
+		t.Fatalf("failed to delete login events: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 login event deleted, got %d", removed)
+	}
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+)
+
+func postgresDSN(conf *cfg.Config, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errors.New("invalid postgresql url")
+	}
+
+	if u.Scheme == "" {
+		u.Scheme = "postgresql"
+	} else if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return "", errors.New("postgresql url must use the postgres:// or postgresql:// scheme")
+	}
+
+	query := u.Query()
+
+	if u.Host == "" && query.Get("host") == "" {
+		port := ""
+		if conf.Database.Port > 0 {
+			port = strconv.Itoa(int(conf.Database.Port))
+		}
+
+		if isSocketPath(conf.Database.Host) {
+			query.Set("host", conf.Database.Host)
+			if port != "" {
+				u.Host = ":" + port
+			}
+		} else if port != "" {
+			u.Host = net.JoinHostPort(conf.Database.Host, port)
+		} else {
+			u.Host = conf.Database.Host
+		}
+	}
+
+	username, password := conf.Database.Username, conf.Database.Password
+	if u.User != nil {
+		username = u.User.Username()
+		if urlPassword, ok := u.User.Password(); ok {
+			password = urlPassword
+		}
+	}
+	if username != "" && password != "" {
+		u.User = url.UserPassword(username, password)
+	} else if username != "" {
+		u.User = url.User(username)
+	}
+
+	if strings.Trim(u.Path, "/") == "" {
+		u.Path = "/" + conf.Database.Name
+	}
+
+	setDefaultArg(query, "sslmode", conf.Database.SSLMode)
+	setDefaultArg(query, "sslrootcert", conf.Database.SSLRootCert)
+	setDefaultArg(query, "sslcert", conf.Database.SSLCert)
+	setDefaultArg(query, "sslkey", conf.Database.SSLKey)
+	for k, v := range conf.Database.ExtraArgs {
+		setDefaultArg(query, k, v)
+	}
+	if conf.Database.StatementTimeout > 0 {
+		setDefaultArg(query, "statement_timeout", strconv.FormatInt(conf.Database.StatementTimeout.Milliseconds(), 10))
+	}
+
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+func mysqlDSN(conf *cfg.Config) (string, error) {
+	dsnConf := mysql.NewConfig()
+
+	if conf.Database.URL != "" {
+		parsed, err := mysql.ParseDSN(conf.Database.URL)
+		if err != nil {
+			return "", errors.New("invalid mysql dsn")
+		}
+		dsnConf = parsed
+	} else if isSocketPath(conf.Database.Host) {
+		dsnConf.Net = "unix"
+		dsnConf.Addr = conf.Database.Host
+	} else {
+		dsnConf.Net = "tcp"
+		dsnConf.Addr = net.JoinHostPort(conf.Database.Host, strconv.Itoa(int(conf.Database.Port)))
+	}
+
+	if dsnConf.User == "" {
+		dsnConf.User = conf.Database.Username
+	}
+	if dsnConf.Passwd == "" {
+		dsnConf.Passwd = conf.Database.Password
+	}
+	if dsnConf.DBName == "" {
+		dsnConf.DBName = conf.Database.Name
+	}
+
+	dsnConf.Loc = time.UTC
+	dsnConf.ParseTime = true
+	dsnConf.MultiStatements = true
+	dsnConf.ClientFoundRows = true
+	if dsnConf.Params == nil {
+		dsnConf.Params = make(map[string]string)
+	}
+	dsnConf.Params["time_zone"] = "'+00:00'"
+
+	dsn := dsnConf.FormatDSN()
+	if len(conf.Database.ExtraArgs) > 0 {
+		args := url.Values{}
+		for k, v := range conf.Database.ExtraArgs {
+			args.Set(k, v)
+		}
+		dsn += "&" + args.Encode()
+	}
+
+	return dsn, nil
+}
+
+func setDefaultArg(query url.Values, key, value string) {
+	if value != "" && !query.Has(key) {
+		query.Set(key, value)
+	}
+}
+
+func isSocketPath(host string) bool {
+	return strings.HasPrefix(host, "/")
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+)
+
+func TestPostgresDSN(t *testing.T) {
+	conf := &cfg.Config{}
+	conf.Database.Host = "db.example.com"
+	conf.Database.Port = 5432
+	conf.Database.Username = "app"
+	conf.Database.Password = "p@ss:w/rd?#"
+	conf.Database.Name = "links"
+	conf.Database.ExtraArgs = map[string]string{"application_name": "sls & co", "search_path": "public"}
+	conf.Database.StatementTimeout = 5 * time.Second
+
+	dsn, err := postgresDSN(conf, "")
+	if err != nil {
+		t.Fatalf("postgresDSN: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if again, _ := postgresDSN(conf, ""); again != dsn {
+			t.Fatalf("dsn is not deterministic: %q != %q", again, dsn)
+		}
+	}
+
+	parsed, err := pgx.ParseURI(dsn)
+	if err != nil {
+		t.Fatalf("ParseURI(%q): %v", dsn, err)
+	}
+	if parsed.Host != "db.example.com" || parsed.Port != 5432 || parsed.Database != "links" {
+		t.Errorf("unexpected address in %q", dsn)
+	}
+	if parsed.User != "app" || parsed.Password != "p@ss:w/rd?#" {
+		t.Errorf("credentials not preserved in %q", dsn)
+	}
+	if parsed.RuntimeParams["application_name"] != "sls & co" || parsed.RuntimeParams["statement_timeout"] != "5000" {
+		t.Errorf("unexpected runtime params %v", parsed.RuntimeParams)
+	}
+}
+
+func TestPostgresDSNSocketHost(t *testing.T) {
+	conf := &cfg.Config{}
+	conf.Database.Host = "/var/run/postgresql"
+	conf.Database.Username = "app"
+	conf.Database.Name = "links"
+	conf.Database.SSLMode = "disable"
+
+	dsn, err := postgresDSN(conf, "")
+	if err != nil {
+		t.Fatalf("postgresDSN: %v", err)
+	}
+
+	parsed, err := pgx.ParseURI(dsn)
+	if err != nil {
+		t.Fatalf("ParseURI(%q): %v", dsn, err)
+	}
+	if parsed.Host != "/var/run/postgresql" || parsed.User != "app" || parsed.Database != "links" {
+		t.Errorf("unexpected config from %q: %+v", dsn, parsed)
+	}
+	if parsed.TLSConfig != nil {
+		t.Errorf("ssl_mode disable not applied in %q", dsn)
+	}
+}
+
+func TestPostgresDSNFromURL(t *testing.T) {
+	conf := &cfg.Config{}
+	conf.Database.Password = "from-file"
+	conf.Database.SSLMode = "require"
+	conf.Database.ExtraArgs = map[string]string{"sslmode": "verify-full", "application_name": "sls"}
+
+	dsn, err := postgresDSN(conf, "postgres://app@db.internal:6432/links?sslmode=disable")
+	if err != nil {
+		t.Fatalf("postgresDSN: %v", err)
+	}
+
+	parsed, err := pgx.ParseURI(dsn)
+	if err != nil {
+		t.Fatalf("ParseURI(%q): %v", dsn, err)
+	}
+	if parsed.Host != "db.internal" || parsed.Port != 6432 || parsed.Database != "links" {
+		t.Errorf("unexpected address in %q", dsn)
+	}
+	if parsed.User != "app" || parsed.Password != "from-file" {
+		t.Errorf("credentials not merged in %q", dsn)
+	}
+	if !strings.Contains(dsn, "sslmode=disable") || parsed.RuntimeParams["application_name"] != "sls" {
+		t.Errorf("url parameters should take precedence in %q", dsn)
+	}
+
+	if _, err := postgresDSN(conf, "mysql://app@db.internal/links"); err == nil {
+		t.Error("expected an error for a non-postgres url")
+	}
+}
+
+func TestMysqlDSN(t *testing.T) {
+	conf := &cfg.Config{}
+	conf.Database.Host = "db.example.com"
+	conf.Database.Port = 3306
+	conf.Database.Username = "app"
+	conf.Database.Password = "p@ss:w/rd?#"
+	conf.Database.Name = "links"
+
+	dsn, err := mysqlDSN(conf)
+	if err != nil {
+		t.Fatalf("mysqlDSN: %v", err)
+	}
+	if !strings.HasPrefix(dsn, "app:p@ss:w/rd?#@tcp(db.example.com:3306)/links?") {
+		t.Errorf("unexpected dsn %q", dsn)
+	}
+
+	conf.Database.Host = "/run/mysqld/mysqld.sock"
+	if dsn, _ = mysqlDSN(conf); !strings.Contains(dsn, "@unix(/run/mysqld/mysqld.sock)/links?") {
+		t.Errorf("unexpected socket dsn %q", dsn)
+	}
+
+	conf.Database.URL = "other:secret@tcp(10.0.0.5:3307)/shortener"
+	if dsn, _ = mysqlDSN(conf); !strings.HasPrefix(dsn, "other:secret@tcp(10.0.0.5:3307)/shortener?") || !strings.Contains(dsn, "parseTime=true") {
+		t.Errorf("unexpected url dsn %q", dsn)
+	}
+}
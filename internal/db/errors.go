@@ -0,0 +1,40 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+)
+
+type storeError struct {
+	message string
+	kind    error
+}
+
+func (e *storeError) Error() string {
+	return e.message
+}
+
+func (e *storeError) Unwrap() error {
+	return e.kind
+}
+
+func notFoundError(message string) error {
+	return &storeError{message: message, kind: ErrNotFound}
+}
+
+func conflictError(format string, args ...any) error {
+	return &storeError{message: fmt.Sprintf(format, args...), kind: ErrConflict}
+}
+
+func retrieveError(err error, message string) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFoundError(message)
+	}
+	return errors.New(message)
+}
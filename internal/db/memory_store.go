@@ -0,0 +1,977 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type memoryData struct {
+	Users         map[uint]*User
+	Links         map[uint]*Link
+	Teams         map[uint]*Team
+	TeamMembers   map[uint]map[uint]*TeamMember
+	LoginEvents   []LoginEvent
+	RecoveryCodes map[uint][]string
+	APITokens     map[uint]*APIToken
+	Sessions      map[string]*Session
+
+	LastUserID       uint
+	LastLinkID       uint
+	LastTeamID       uint
+	LastLoginEventID uint
+	LastAPITokenID   uint
+}
+
+type MemoryStore struct {
+	mu           sync.RWMutex
+	data         memoryData
+	snapshotPath string
+}
+
+func NewMemoryStore(snapshotPath string) (*MemoryStore, error) {
+	s := &MemoryStore{
+		data: memoryData{
+			Users:         make(map[uint]*User),
+			Links:         make(map[uint]*Link),
+			Teams:         make(map[uint]*Team),
+			TeamMembers:   make(map[uint]map[uint]*TeamMember),
+			RecoveryCodes: make(map[uint][]string),
+			APITokens:     make(map[uint]*APIToken),
+			Sessions:      make(map[string]*Session),
+		},
+		snapshotPath: snapshotPath,
+	}
+
+	if snapshotPath == "" {
+		return s, nil
+	}
+
+	content, err := os.ReadFile(snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if err = json.Unmarshal(content, &s.data); err != nil {
+		return nil, fmt.Errorf("failed to load snapshot: %w", err)
+	}
+	for teamID := range s.data.Teams {
+		if s.data.TeamMembers[teamID] == nil {
+			s.data.TeamMembers[teamID] = make(map[uint]*TeamMember)
+		}
+	}
+	for i := range s.data.LoginEvents {
+		if s.data.LoginEvents[i].UserID == nil {
+			s.data.LoginEvents[i].UserID = s.findUserID(s.data.LoginEvents[i].Username)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *MemoryStore) findUser(username string) *User {
+	for _, user := range s.data.Users {
+		if user.Username == username {
+			return user
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) findUserByOIDCIdentity(identity OIDCIdentity) *User {
+	for _, user := range s.data.Users {
+		if user.OIDCIssuer != nil && *user.OIDCIssuer == identity.Issuer && *user.OIDCSubject == identity.Subject {
+			return user
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) findUserID(username string) *uint {
+	if user := s.findUser(username); user != nil {
+		id := user.ID
+		return &id
+	}
+	return nil
+}
+
+func (s *MemoryStore) findTeam(name string) *Team {
+	for _, team := range s.data.Teams {
+		if team.Name == name {
+			return team
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) usernameOf(userID uint) string {
+	if user, ok := s.data.Users[userID]; ok {
+		return user.Username
+	}
+	return ""
+}
+
+func (s *MemoryStore) linkView(link *Link) *Link {
+	view := *link
+	view.CreatedBy = nil
+	if link.CreatedByID != nil {
+		if user, ok := s.data.Users[*link.CreatedByID]; ok {
+			username := user.Username
+			view.CreatedBy = &username
+		}
+	}
+	return &view
+}
+
+func (s *MemoryStore) memberView(member *TeamMember) TeamMember {
+	view := *member
+	view.Username = s.usernameOf(member.UserID)
+	return view
+}
+
+func (s *MemoryStore) filterLinks(match func(*Link) bool) []*Link {
+	var links []*Link
+	for _, link := range s.data.Links {
+		if match(link) {
+			links = append(links, link)
+		}
+	}
+	slices.SortFunc(links, func(a, b *Link) int { return cmp.Compare(b.ID, a.ID) })
+	return links
+}
+
+func (s *MemoryStore) pageLinks(links []*Link, limit int, offset int) []Link {
+	page := make([]Link, 0, limit)
+	for i := offset; i < len(links) && len(page) < limit; i++ {
+		page = append(page, *s.linkView(links[i]))
+	}
+	return page
+}
+
+func isPersonalLinkOf(userID uint) func(*Link) bool {
+	return func(link *Link) bool {
+		return link.TeamID == nil && link.CreatedByID != nil && *link.CreatedByID == userID
+	}
+}
+
+func (s *MemoryStore) CreateUser(_ context.Context, username string, password string, role Role) (*User, error) {
+	return s.insertUser(username, password, role, nil)
+}
+
+func (s *MemoryStore) CreateOIDCUser(_ context.Context, username string, password string, role Role, identity OIDCIdentity) (*User, error) {
+	return s.insertUser(username, password, role, &identity)
+}
+
+func (s *MemoryStore) insertUser(username string, password string, role Role, identity *OIDCIdentity) (*User, error) {
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, errors.New("failed to hash password")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findUser(username) != nil {
+		return nil, conflictError("%s is already taken", username)
+	}
+
+	s.data.LastUserID++
+	user := &User{
+		ID:        s.data.LastUserID,
+		Username:  username,
+		Password:  string(hashedBytes),
+		Role:      role,
+		CreatedAt: time.Now().UTC(),
+	}
+	if identity != nil {
+		if s.findUserByOIDCIdentity(*identity) != nil {
+			return nil, errors.New("failed to create new user")
+		}
+		user.OIDCIssuer, user.OIDCSubject = &identity.Issuer, &identity.Subject
+	}
+	s.data.Users[user.ID] = user
+
+	created := *user
+	return &created, nil
+}
+
+func (s *MemoryStore) RetrieveAllUsers(_ context.Context) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]User, 0, len(s.data.Users))
+	for _, user := range s.data.Users {
+		users = append(users, *user)
+	}
+	slices.SortFunc(users, func(a, b User) int { return cmp.Compare(a.ID, b.ID) })
+	return users, nil
+}
+
+func (s *MemoryStore) RetrieveUser(_ context.Context, username string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user := s.findUser(username)
+	if user == nil {
+		return nil, notFoundError("failed to retrieve user")
+	}
+	found := *user
+	return &found, nil
+}
+
+func (s *MemoryStore) RetrieveUserByOIDCIdentity(_ context.Context, identity OIDCIdentity) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user := s.findUserByOIDCIdentity(identity)
+	if user == nil {
+		return nil, notFoundError("failed to retrieve user")
+	}
+	found := *user
+	return &found, nil
+}
+
+func (s *MemoryStore) LinkOIDCIdentity(_ context.Context, username string, identity OIDCIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(username)
+	if user == nil || user.OIDCIssuer != nil {
+		return conflictError("%s is already linked to an identity", username)
+	}
+	if s.findUserByOIDCIdentity(identity) != nil {
+		return errors.New("failed to link identity")
+	}
+	user.OIDCIssuer, user.OIDCSubject = &identity.Issuer, &identity.Subject
+	return nil
+}
+
+func (s *MemoryStore) UpdateUsername(_ context.Context, username, newUsername string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findUser(newUsername) != nil {
+		return conflictError("%s is already taken", newUsername)
+	}
+	user := s.findUser(username)
+	if user == nil {
+		return notFoundError("user not found")
+	}
+	user.Username = newUsername
+	return nil
+}
+
+func (s *MemoryStore) UpdatePassword(_ context.Context, username, newPassword string) error {
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.New("failed to hash password")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user := s.findUser(username); user != nil {
+		user.Password = string(hashedBytes)
+	}
+	return nil
+}
+
+func (s *MemoryStore) SetRole(_ context.Context, username string, role Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(username)
+	if user == nil {
+		return notFoundError("user not found")
+	}
+	user.Role = role
+	return nil
+}
+
+func (s *MemoryStore) DeleteUser(_ context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(username)
+	if user == nil {
+		return notFoundError("user not found")
+	}
+	if count := len(s.filterLinks(isPersonalLinkOf(user.ID))); count > 0 {
+		return conflictError("%s still owns %d links, reassign them first", username, count)
+	}
+
+	for _, link := range s.data.Links {
+		if link.CreatedByID != nil && *link.CreatedByID == user.ID {
+			link.CreatedByID = nil
+		}
+	}
+	for _, members := range s.data.TeamMembers {
+		delete(members, user.ID)
+	}
+	for id, token := range s.data.APITokens {
+		if token.UserID == user.ID {
+			delete(s.data.APITokens, id)
+		}
+	}
+	for hash, session := range s.data.Sessions {
+		if session.UserID == user.ID {
+			delete(s.data.Sessions, hash)
+		}
+	}
+	delete(s.data.RecoveryCodes, user.ID)
+	delete(s.data.Users, user.ID)
+	return nil
+}
+
+func (s *MemoryStore) RecordLoginFailure(_ context.Context, username string, maxAttempts uint, lockout time.Duration) (bool, error) {
+	if maxAttempts == 0 || lockout <= 0 {
+		return false, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(username)
+	if user == nil {
+		return false, nil
+	}
+	if user.IsLocked() {
+		return true, nil
+	}
+	if user.FailedAttempts+1 > maxAttempts {
+		lockedUntil := time.Now().UTC().Add(lockout)
+		user.FailedAttempts = 0
+		user.LockedUntil = &lockedUntil
+		return true, nil
+	}
+	user.FailedAttempts++
+	return false, nil
+}
+
+func (s *MemoryStore) RefundLoginFailure(_ context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user := s.findUser(username); user != nil && user.FailedAttempts > 0 {
+		user.FailedAttempts--
+	}
+	return nil
+}
+
+func (s *MemoryStore) ResetLoginFailures(_ context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user := s.findUser(username); user != nil {
+		user.FailedAttempts = 0
+	}
+	return nil
+}
+
+func (s *MemoryStore) UnlockUser(_ context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user := s.findUser(username); user != nil {
+		user.FailedAttempts = 0
+		user.LockedUntil = nil
+	}
+	return nil
+}
+
+func (s *MemoryStore) CreateLoginEvent(_ context.Context, event *LoginEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.LastLoginEventID++
+	created := *event
+	created.ID = s.data.LastLoginEventID
+	created.UserID = s.findUserID(event.Username)
+	created.CreatedAt = time.Now().UTC()
+	s.data.LoginEvents = append(s.data.LoginEvents, created)
+	return nil
+}
+
+func (s *MemoryStore) RetrieveLoginEvents(_ context.Context, username string, limit int, offset int) ([]LoginEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := make([]LoginEvent, 0, limit)
+	userID := s.findUserID(username)
+	if userID == nil {
+		return events, nil
+	}
+	skipped := 0
+	for i := len(s.data.LoginEvents) - 1; i >= 0 && len(events) < limit; i-- {
+		if eventUserID := s.data.LoginEvents[i].UserID; eventUserID == nil || *eventUserID != *userID {
+			continue
+		}
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		events = append(events, s.data.LoginEvents[i])
+	}
+	return events, nil
+}
+
+func (s *MemoryStore) DeleteLoginEventsBefore(_ context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := len(s.data.LoginEvents)
+	s.data.LoginEvents = slices.DeleteFunc(s.data.LoginEvents, func(event LoginEvent) bool {
+		return event.CreatedAt.Before(before)
+	})
+	return int64(count - len(s.data.LoginEvents)), nil
+}
+
+func (s *MemoryStore) SetTOTPSecret(_ context.Context, username string, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(username)
+	if user == nil || user.TOTPEnabled {
+		return errors.New("two-factor authentication is already enabled")
+	}
+	user.TOTPSecret = secret
+	return nil
+}
+
+func (s *MemoryStore) EnableTOTP(_ context.Context, username string, recoveryCodeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(username)
+	if user == nil {
+		return errors.New("failed to enable two-factor authentication")
+	}
+	user.TOTPEnabled = true
+	s.data.RecoveryCodes[user.ID] = slices.Clone(recoveryCodeHashes)
+	return nil
+}
+
+func (s *MemoryStore) DisableTOTP(_ context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(username)
+	if user == nil {
+		return errors.New("failed to disable two-factor authentication")
+	}
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	delete(s.data.RecoveryCodes, user.ID)
+	return nil
+}
+
+func (s *MemoryStore) UseRecoveryCode(_ context.Context, username string, codeHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(username)
+	if user == nil {
+		return false, nil
+	}
+	codes := s.data.RecoveryCodes[user.ID]
+	idx := slices.Index(codes, codeHash)
+	if idx < 0 {
+		return false, nil
+	}
+	s.data.RecoveryCodes[user.ID] = slices.Delete(codes, idx, idx+1)
+	return true, nil
+}
+
+func (s *MemoryStore) CreateAPIToken(_ context.Context, username string, name string, tokenHash string) (*APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(username)
+	if user == nil {
+		return nil, errors.New("failed to create api token")
+	}
+	for _, token := range s.data.APITokens {
+		if token.TokenHash == tokenHash {
+			return nil, errors.New("failed to create api token")
+		}
+	}
+
+	s.data.LastAPITokenID++
+	token := &APIToken{
+		ID:        s.data.LastAPITokenID,
+		UserID:    user.ID,
+		Name:      name,
+		TokenHash: tokenHash,
+		CreatedAt: time.Now().UTC(),
+	}
+	s.data.APITokens[token.ID] = token
+
+	created := *token
+	created.Username = user.Username
+	return &created, nil
+}
+
+func (s *MemoryStore) RetrieveAPITokens(_ context.Context, username string) ([]APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := make([]APIToken, 0)
+	user := s.findUser(username)
+	if user == nil {
+		return tokens, nil
+	}
+	for _, token := range s.data.APITokens {
+		if token.UserID == user.ID {
+			found := *token
+			found.Username = user.Username
+			tokens = append(tokens, found)
+		}
+	}
+	slices.SortFunc(tokens, func(a, b APIToken) int { return cmp.Compare(a.ID, b.ID) })
+	return tokens, nil
+}
+
+func (s *MemoryStore) RetrieveAPITokenByHash(_ context.Context, tokenHash string) (*APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, token := range s.data.APITokens {
+		if token.TokenHash == tokenHash {
+			lastUsedAt := time.Now().UTC()
+			token.LastUsedAt = &lastUsedAt
+			found := *token
+			found.Username = s.usernameOf(token.UserID)
+			return &found, nil
+		}
+	}
+	return nil, notFoundError("failed to retrieve api token")
+}
+
+func (s *MemoryStore) DeleteAPIToken(_ context.Context, username string, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.data.APITokens[id]
+	if !ok || s.usernameOf(token.UserID) != username {
+		return notFoundError("api token not found")
+	}
+	delete(s.data.APITokens, id)
+	return nil
+}
+
+func (s *MemoryStore) CreateSession(_ context.Context, username string, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(username)
+	if user == nil {
+		return errors.New("failed to create session")
+	}
+	if _, ok := s.data.Sessions[tokenHash]; ok {
+		return errors.New("failed to create session")
+	}
+	s.data.Sessions[tokenHash] = &Session{
+		TokenHash: tokenHash,
+		UserID:    user.ID,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt.UTC(),
+	}
+	return nil
+}
+
+func (s *MemoryStore) RetrieveSession(_ context.Context, tokenHash string) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.data.Sessions[tokenHash]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return nil, notFoundError("failed to retrieve session")
+	}
+	found := *session
+	found.Username = s.usernameOf(session.UserID)
+	return &found, nil
+}
+
+func (s *MemoryStore) DeleteSession(_ context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.data.Sessions, tokenHash)
+	return nil
+}
+
+func (s *MemoryStore) DeleteSessionsForUser(_ context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(username)
+	if user == nil {
+		return nil
+	}
+	for hash, session := range s.data.Sessions {
+		if session.UserID == user.ID {
+			delete(s.data.Sessions, hash)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteExpiredSessions(_ context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	now := time.Now()
+	for hash, session := range s.data.Sessions {
+		if !session.ExpiresAt.After(now) {
+			delete(s.data.Sessions, hash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemoryStore) createLink(url string, creatorUsername string, teamID *uint) *Link {
+	s.data.LastLinkID++
+	link := &Link{
+		ID:          s.data.LastLinkID,
+		URL:         url,
+		CreatedByID: s.findUserID(creatorUsername),
+		TeamID:      teamID,
+		CreatedAt:   time.Now().UTC(),
+	}
+	s.data.Links[link.ID] = link
+	return s.linkView(link)
+}
+
+func (s *MemoryStore) CreateLink(_ context.Context, url, creatorUsername string) (*Link, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createLink(url, creatorUsername, nil), nil
+}
+
+func (s *MemoryStore) RetrieveLink(_ context.Context, id uint) (*Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	link, ok := s.data.Links[id]
+	if !ok {
+		return nil, notFoundError("failed to retrieve link")
+	}
+	return s.linkView(link), nil
+}
+
+func (s *MemoryStore) IncrementVisits(_ context.Context, id uint, count uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.data.Links[id]
+	if !ok {
+		slog.Warn(fmt.Sprintf("failed to increment visits: ID=%d, count=%d, RowsAffected=%d", id, count, 0))
+		return nil
+	}
+	link.Visits += count
+	return nil
+}
+
+func (s *MemoryStore) RetrieveLinkAndBumpVisits(_ context.Context, id uint) (*Link, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.data.Links[id]
+	if !ok {
+		return nil, notFoundError("failed to retrieve link")
+	}
+	link.Visits++
+	return s.linkView(link), nil
+}
+
+func (s *MemoryStore) DeleteLink(_ context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.data.Links, id)
+	return nil
+}
+
+func (s *MemoryStore) GetLinkCountForUser(_ context.Context, username string) uint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user := s.findUser(username)
+	if user == nil {
+		return 0
+	}
+	return uint(len(s.filterLinks(isPersonalLinkOf(user.ID))))
+}
+
+func (s *MemoryStore) RetrieveLinksForUser(_ context.Context, username string, limit int, offset int) ([]Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user := s.findUser(username)
+	if user == nil {
+		return []Link{}, nil
+	}
+	return s.pageLinks(s.filterLinks(isPersonalLinkOf(user.ID)), limit, offset), nil
+}
+
+func (s *MemoryStore) CreateTeamLink(_ context.Context, url, creatorUsername string, teamID uint) (*Link, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data.Teams[teamID]; !ok {
+		return nil, errors.New("failed to create new link")
+	}
+	return s.createLink(url, creatorUsername, &teamID), nil
+}
+
+func (s *MemoryStore) GetLinkCountForTeam(_ context.Context, teamID uint) uint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return uint(len(s.filterLinks(func(link *Link) bool { return link.TeamID != nil && *link.TeamID == teamID })))
+}
+
+func (s *MemoryStore) RetrieveLinksForTeam(_ context.Context, teamID uint, limit int, offset int) ([]Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	links := s.filterLinks(func(link *Link) bool { return link.TeamID != nil && *link.TeamID == teamID })
+	return s.pageLinks(links, limit, offset), nil
+}
+
+func (s *MemoryStore) TransferLink(_ context.Context, id uint, owner LinkOwner) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.data.Links[id]
+	if !ok {
+		return notFoundError("link not found")
+	}
+	if owner.TeamID != 0 {
+		if _, ok := s.data.Teams[owner.TeamID]; !ok {
+			return errors.New("failed to transfer link")
+		}
+		teamID := owner.TeamID
+		link.TeamID = &teamID
+	} else {
+		link.CreatedByID = s.findUserID(owner.Username)
+		link.TeamID = nil
+	}
+	return nil
+}
+
+func (s *MemoryStore) TransferUserLinks(_ context.Context, username string, owner LinkOwner) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(username)
+	if user == nil {
+		return 0, nil
+	}
+	if owner.TeamID != 0 {
+		if _, ok := s.data.Teams[owner.TeamID]; !ok {
+			return 0, errors.New("failed to transfer links")
+		}
+	}
+
+	links := s.filterLinks(isPersonalLinkOf(user.ID))
+	for _, link := range links {
+		if owner.TeamID != 0 {
+			teamID := owner.TeamID
+			link.TeamID = &teamID
+		} else {
+			link.CreatedByID = s.findUserID(owner.Username)
+		}
+	}
+	return int64(len(links)), nil
+}
+
+func (s *MemoryStore) CreateTeam(_ context.Context, name string, ownerUsername string) (*Team, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findTeam(name) != nil {
+		return nil, conflictError("%s is already taken", name)
+	}
+	owner := s.findUser(ownerUsername)
+	if owner == nil {
+		return nil, errors.New("failed to create new team")
+	}
+
+	s.data.LastTeamID++
+	now := time.Now().UTC()
+	team := &Team{ID: s.data.LastTeamID, Name: name, CreatedAt: now}
+	s.data.Teams[team.ID] = team
+	s.data.TeamMembers[team.ID] = map[uint]*TeamMember{
+		owner.ID: {TeamID: team.ID, UserID: owner.ID, Role: TeamRoleOwner, CreatedAt: now},
+	}
+
+	created := *team
+	return &created, nil
+}
+
+func (s *MemoryStore) RetrieveAllTeams(_ context.Context) ([]Team, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var teams []Team
+	for _, team := range s.data.Teams {
+		teams = append(teams, *team)
+	}
+	slices.SortFunc(teams, func(a, b Team) int { return cmp.Compare(a.Name, b.Name) })
+	return teams, nil
+}
+
+func (s *MemoryStore) RetrieveTeam(_ context.Context, name string) (*Team, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	team := s.findTeam(name)
+	if team == nil {
+		return nil, notFoundError("failed to retrieve team")
+	}
+	found := *team
+	return &found, nil
+}
+
+func (s *MemoryStore) RetrieveTeamsForUser(_ context.Context, username string) ([]Team, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var teams []Team
+	user := s.findUser(username)
+	if user == nil {
+		return teams, nil
+	}
+	for teamID, members := range s.data.TeamMembers {
+		if _, ok := members[user.ID]; ok {
+			teams = append(teams, *s.data.Teams[teamID])
+		}
+	}
+	slices.SortFunc(teams, func(a, b Team) int { return cmp.Compare(a.Name, b.Name) })
+	return teams, nil
+}
+
+func (s *MemoryStore) DeleteTeam(_ context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	links := s.filterLinks(func(link *Link) bool { return link.TeamID != nil && *link.TeamID == id })
+	if count := len(links); count > 0 {
+		return conflictError("team still owns %d links, reassign them first", count)
+	}
+	delete(s.data.TeamMembers, id)
+	delete(s.data.Teams, id)
+	return nil
+}
+
+func (s *MemoryStore) SetTeamMember(_ context.Context, teamID uint, username string, role TeamRole) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(username)
+	members, ok := s.data.TeamMembers[teamID]
+	if user == nil || !ok {
+		return errors.New("failed to update team member")
+	}
+	if member, ok := members[user.ID]; ok {
+		member.Role = role
+		return nil
+	}
+	members[user.ID] = &TeamMember{TeamID: teamID, UserID: user.ID, Role: role, CreatedAt: time.Now().UTC()}
+	return nil
+}
+
+func (s *MemoryStore) RetrieveTeamMember(_ context.Context, teamID uint, username string) (*TeamMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user := s.findUser(username)
+	if user == nil {
+		return nil, notFoundError("failed to retrieve team member")
+	}
+	member, ok := s.data.TeamMembers[teamID][user.ID]
+	if !ok {
+		return nil, notFoundError("failed to retrieve team member")
+	}
+	found := s.memberView(member)
+	return &found, nil
+}
+
+func (s *MemoryStore) RetrieveTeamMembers(_ context.Context, teamID uint) ([]TeamMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var members []TeamMember
+	for _, member := range s.data.TeamMembers[teamID] {
+		members = append(members, s.memberView(member))
+	}
+	slices.SortFunc(members, func(a, b TeamMember) int { return cmp.Compare(a.Username, b.Username) })
+	return members, nil
+}
+
+func (s *MemoryStore) RemoveTeamMember(_ context.Context, teamID uint, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(username)
+	if user == nil {
+		return notFoundError("team member not found")
+	}
+	if _, ok := s.data.TeamMembers[teamID][user.ID]; !ok {
+		return notFoundError("team member not found")
+	}
+	delete(s.data.TeamMembers[teamID], user.ID)
+	return nil
+}
+
+func (s *MemoryStore) Ping(_ context.Context) error {
+	return nil
+}
+
+func (s *MemoryStore) SchemaVersion(_ context.Context) (uint, error) {
+	return CurrentSchemaVersion, nil
+}
+
+func (s *MemoryStore) Snapshot() error {
+	s.mu.RLock()
+	content, err := json.Marshal(&s.data)
+	s.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	tmpPath := s.snapshotPath + ".tmp"
+	if err = os.WriteFile(tmpPath, content, 0600); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err = os.Rename(tmpPath, s.snapshotPath); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() {
+	if s.snapshotPath == "" {
+		return
+	}
+	if err := s.Snapshot(); err != nil {
+		slog.Warn(err.Error())
+		return
+	}
+	slog.Info("saved memory store snapshot", "path", s.snapshotPath)
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+)
+
+func TestSqliteMigrationFromVersion5(t *testing.T) {
+	conf := &cfg.Config{}
+	conf.Database.Type = "sqlite3"
+	conf.Database.Name = filepath.Join(t.TempDir(), "test.sqlite3")
+	testMigrationFromVersion5(t, conf, sqliteSetupSQL, sqliteMigrations)
+}
+
+func TestPostgresMigrationFromVersion5(t *testing.T) {
+	rawURL := os.Getenv("SLS_TEST_POSTGRES_URL")
+	if rawURL == "" {
+		t.Skip("SLS_TEST_POSTGRES_URL is not set")
+	}
+	conf := newTestConfigFromURL(t, "postgresql", rawURL)
+	resetDatabase(t, conf, "DROP TABLE IF EXISTS "+testTables+" CASCADE")
+	testMigrationFromVersion5(t, conf, postgresSetupSQL, postgresMigrations)
+}
+
+func testMigrationFromVersion5(t *testing.T, conf *cfg.Config, setupSQL string, migrations []string) {
+	ctx := context.Background()
+
+	db, err := connect(conf)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	db.MustExec(setupSQL)
+	db.MustExec(strings.Join(migrations[:4], ";"))
+	db.MustExec("INSERT INTO schema_version (version) VALUES (5)")
+
+	expiresAt := time.Now().Add(time.Hour).UTC()
+	for _, seed := range []struct {
+		query string
+		args  []any
+	}{
+		{"INSERT INTO users (username, password, role) VALUES (?, ?, ?)", []any{"alice", "hash", RoleAdmin}},
+		{"INSERT INTO users (username, password, role) VALUES (?, ?, ?)", []any{"bob", "hash", RoleCreator}},
+		{"INSERT INTO teams (name) VALUES (?)", []any{"ops"}},
+		{"INSERT INTO team_members (team_id, username, role) VALUES ((SELECT id FROM teams WHERE name = ?), ?, ?)", []any{"ops", "alice", TeamRoleOwner}},
+		{"INSERT INTO team_members (team_id, username, role) VALUES ((SELECT id FROM teams WHERE name = ?), ?, ?)", []any{"ops", "bob", TeamRoleEditor}},
+		{"INSERT INTO links (url, created_by) VALUES (?, ?)", []any{"https://example.com/a", "alice"}},
+		{"INSERT INTO links (url, created_by, team_id) VALUES (?, ?, (SELECT id FROM teams WHERE name = ?))", []any{"https://example.com/b", "bob", "ops"}},
+		{"INSERT INTO recovery_codes (username, code_hash) VALUES (?, ?)", []any{"alice", "code-1"}},
+		{"INSERT INTO api_tokens (username, name, token_hash) VALUES (?, ?, ?)", []any{"alice", "ci", "token-1"}},
+		{"INSERT INTO sessions (token_hash, username, expires_at) VALUES (?, ?, ?)", []any{"session-1", "bob", expiresAt}},
+		{"INSERT INTO login_events (username, success, method) VALUES (?, ?, ?)", []any{"alice", true, "password"}},
+		{"INSERT INTO login_events (username, success, method, reason) VALUES (?, ?, ?, ?)", []any{"ghost", false, "password", "unknown_user"}},
+	} {
+		if _, err = db.Exec(db.Rebind(seed.query), seed.args...); err != nil {
+			t.Fatalf("failed to seed %q: %v", seed.query, err)
+		}
+	}
+	_ = db.Close()
+
+	s := newTestStore(t, conf)
+	defer s.Close()
+
+	if version, err := s.SchemaVersion(ctx); err != nil || version != CurrentSchemaVersion {
+		t.Fatalf("expected schema version %d, got %d (%v)", CurrentSchemaVersion, version, err)
+	}
+
+	alice, err := s.RetrieveUser(ctx, "alice")
+	if err != nil {
+		t.Fatalf("failed to retrieve migrated user: %v", err)
+	}
+	if alice.ID == 0 || alice.Role != RoleAdmin {
+		t.Errorf("unexpected migrated user: %+v", alice)
+	}
+
+	if count := s.GetLinkCountForUser(ctx, "alice"); count != 1 {
+		t.Errorf("expected alice to own 1 link, got %d", count)
+	}
+	team, err := s.RetrieveTeam(ctx, "ops")
+	if err != nil {
+		t.Fatalf("failed to retrieve migrated team: %v", err)
+	}
+	links, err := s.RetrieveLinksForTeam(ctx, team.ID, 10, 0)
+	if err != nil || len(links) != 1 || links[0].CreatedBy == nil || *links[0].CreatedBy != "bob" {
+		t.Errorf("unexpected migrated team links: %+v (%v)", links, err)
+	}
+	if member, err := s.RetrieveTeamMember(ctx, team.ID, "alice"); err != nil || member.Role != TeamRoleOwner {
+		t.Errorf("unexpected migrated team member: %+v (%v)", member, err)
+	}
+
+	if ok, err := s.UseRecoveryCode(ctx, "alice", "code-1"); err != nil || !ok {
+		t.Errorf("recovery code was not migrated: %v", err)
+	}
+	if token, err := s.RetrieveAPITokenByHash(ctx, "token-1"); err != nil || token.Username != "alice" {
+		t.Errorf("unexpected migrated api token: %+v (%v)", token, err)
+	}
+	if session, err := s.RetrieveSession(ctx, "session-1"); err != nil || session.Username != "bob" {
+		t.Errorf("unexpected migrated session: %+v (%v)", session, err)
+	}
+
+	if err = s.UpdateUsername(ctx, "alice", "alicia"); err != nil {
+		t.Fatalf("failed to rename migrated user: %v", err)
+	}
+	events, err := s.RetrieveLoginEvents(ctx, "alicia", 10, 0)
+	if err != nil {
+		t.Fatalf("failed to retrieve login events: %v", err)
+	}
+	if len(events) != 1 || events[0].Username != "alice" || events[0].UserID == nil || *events[0].UserID != alice.ID {
+		t.Errorf("expected the login event to be linked to alice, got %+v", events)
+	}
+}
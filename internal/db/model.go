@@ -3,16 +3,87 @@ package db
 import "time"
 
 type Link struct {
+	ID          uint      `db:"id"`
+	URL         string    `db:"url"`
+	Visits      uint      `db:"visits"`
+	CreatedByID *uint     `db:"created_by_id"`
+	CreatedBy   *string   `db:"created_by"`
+	TeamID      *uint     `db:"team_id"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+type LinkOwner struct {
+	Username string
+	TeamID   uint
+}
+
+type Team struct {
 	ID        uint      `db:"id"`
-	URL       string    `db:"url"`
-	Visits    uint      `db:"visits"`
-	CreatedBy string    `db:"created_by"`
+	Name      string    `db:"name"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type TeamMember struct {
+	TeamID    uint      `db:"team_id"`
+	UserID    uint      `db:"user_id"`
+	Username  string    `db:"username"`
+	Role      TeamRole  `db:"role"`
 	CreatedAt time.Time `db:"created_at"`
 }
 
 type User struct {
+	ID             uint       `db:"id"`
+	Username       string     `db:"username"`
+	Password       string     `db:"password"`
+	Role           Role       `db:"role"`
+	CreatedAt      time.Time  `db:"created_at"`
+	FailedAttempts uint       `db:"failed_attempts"`
+	LockedUntil    *time.Time `db:"locked_until"`
+	TOTPSecret     string     `db:"totp_secret"`
+	TOTPEnabled    bool       `db:"totp_enabled"`
+	OIDCIssuer     *string    `db:"oidc_issuer"`
+	OIDCSubject    *string    `db:"oidc_subject"`
+}
+
+type OIDCIdentity struct {
+	Issuer  string
+	Subject string
+}
+
+func (u *User) IsLocked() bool {
+	return u.LockedUntil != nil && u.LockedUntil.After(time.Now())
+}
+
+func (u *User) Can(permission Permission) bool {
+	return u.Role.Can(permission)
+}
+
+type APIToken struct {
+	ID         uint       `db:"id"`
+	UserID     uint       `db:"user_id"`
+	Username   string     `db:"username"`
+	Name       string     `db:"name"`
+	TokenHash  string     `db:"token_hash"`
+	CreatedAt  time.Time  `db:"created_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+}
+
+type Session struct {
+	TokenHash string    `db:"token_hash"`
+	UserID    uint      `db:"user_id"`
+	Username  string    `db:"username"`
+	CreatedAt time.Time `db:"created_at"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+type LoginEvent struct {
+	ID        uint      `db:"id"`
+	UserID    *uint     `db:"user_id"`
 	Username  string    `db:"username"`
-	Password  string    `db:"password"`
-	IsAdmin   bool      `db:"is_admin"`
+	Success   bool      `db:"success"`
+	Method    string    `db:"method"`
+	Reason    string    `db:"reason"`
+	IP        string    `db:"ip"`
+	UserAgent string    `db:"user_agent"`
 	CreatedAt time.Time `db:"created_at"`
 }
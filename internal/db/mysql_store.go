@@ -0,0 +1,274 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const mysqlSetupSQL = `
+CREATE TABLE IF NOT EXISTS users (
+	id BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT NOT NULL,
+	username VARCHAR(32) UNIQUE NOT NULL,
+	password VARCHAR(255) NOT NULL,
+	role VARCHAR(16) DEFAULT 'creator' NOT NULL,
+	created_at DATETIME(6) DEFAULT CURRENT_TIMESTAMP(6) NOT NULL,
+	failed_attempts INTEGER DEFAULT 0 NOT NULL,
+	locked_until DATETIME(6) NULL,
+	totp_secret VARCHAR(64) DEFAULT '' NOT NULL,
+	totp_enabled BOOLEAN DEFAULT FALSE NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE IF NOT EXISTS teams (
+	id BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT NOT NULL,
+	name VARCHAR(32) UNIQUE NOT NULL,
+	created_at DATETIME(6) DEFAULT CURRENT_TIMESTAMP(6) NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE IF NOT EXISTS links (
+	id BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT NOT NULL,
+	url TEXT NOT NULL,
+	visits BIGINT UNSIGNED DEFAULT 0 NOT NULL,
+	created_by_id BIGINT UNSIGNED NULL,
+	team_id BIGINT UNSIGNED NULL,
+	created_at DATETIME(6) DEFAULT CURRENT_TIMESTAMP(6) NOT NULL,
+	INDEX links_created_by_id_idx (created_by_id),
+	INDEX links_team_id_idx (team_id),
+	FOREIGN KEY (created_by_id) REFERENCES users(id) ON DELETE SET NULL,
+	FOREIGN KEY (team_id) REFERENCES teams(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE IF NOT EXISTS login_events (
+	id BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT NOT NULL,
+	username VARCHAR(32) NOT NULL,
+	success BOOLEAN NOT NULL,
+	method VARCHAR(16) NOT NULL,
+	reason VARCHAR(32) DEFAULT '' NOT NULL,
+	ip VARCHAR(64) DEFAULT '' NOT NULL,
+	user_agent TEXT NOT NULL,
+	created_at DATETIME(6) DEFAULT CURRENT_TIMESTAMP(6) NOT NULL,
+	INDEX login_events_username_idx (username, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	id BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT NOT NULL,
+	user_id BIGINT UNSIGNED NOT NULL,
+	code_hash CHAR(64) NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT NOT NULL,
+	user_id BIGINT UNSIGNED NOT NULL,
+	name VARCHAR(64) NOT NULL,
+	token_hash CHAR(64) UNIQUE NOT NULL,
+	created_at DATETIME(6) DEFAULT CURRENT_TIMESTAMP(6) NOT NULL,
+	last_used_at DATETIME(6) NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE IF NOT EXISTS sessions (
+	token_hash CHAR(64) PRIMARY KEY NOT NULL,
+	user_id BIGINT UNSIGNED NOT NULL,
+	created_at DATETIME(6) DEFAULT CURRENT_TIMESTAMP(6) NOT NULL,
+	expires_at DATETIME(6) NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE IF NOT EXISTS team_members (
+	team_id BIGINT UNSIGNED NOT NULL,
+	user_id BIGINT UNSIGNED NOT NULL,
+	role VARCHAR(16) DEFAULT 'editor' NOT NULL,
+	created_at DATETIME(6) DEFAULT CURRENT_TIMESTAMP(6) NOT NULL,
+	PRIMARY KEY (team_id, user_id),
+	INDEX team_members_user_id_idx (user_id),
+	FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE IF NOT EXISTS schema_version (
+	version INTEGER NOT NULL
+) ENGINE=InnoDB;
+INSERT INTO schema_version (version) SELECT 6 FROM DUAL WHERE NOT EXISTS (SELECT 1 FROM schema_version);
+`
+
+var mysqlMigrations = []string{
+	5: `
+	ALTER TABLE users
+		ADD COLUMN oidc_issuer VARCHAR(255) NULL,
+		ADD COLUMN oidc_subject VARCHAR(255) NULL,
+		ADD UNIQUE INDEX users_oidc_identity_idx (oidc_issuer, oidc_subject);
+	`,
+	`
+	ALTER TABLE login_events
+		ADD COLUMN user_id BIGINT UNSIGNED NULL,
+		ADD INDEX login_events_user_id_idx (user_id, id),
+		ADD FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+	UPDATE login_events JOIN users ON users.username = login_events.username SET login_events.user_id = users.id;
+	`,
+}
+
+type MysqlStore struct {
+	PostgresStore
+}
+
+func (s MysqlStore) CreateUser(ctx context.Context, username string, password string, role Role) (*User, error) {
+	return s.insertUser(ctx, username, password, role, nil)
+}
+
+func (s MysqlStore) CreateOIDCUser(ctx context.Context, username string, password string, role Role, identity OIDCIdentity) (*User, error) {
+	return s.insertUser(ctx, username, password, role, &identity)
+}
+
+func (s MysqlStore) insertUser(ctx context.Context, username string, password string, role Role, identity *OIDCIdentity) (*User, error) {
+	var count uint
+	q1 := s.db.Rebind("SELECT count(*) FROM users where username = ?")
+	err := s.db.GetContext(ctx, &count, q1, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check username: %w", err)
+	}
+	if count > 0 {
+		return nil, conflictError("%s is already taken", username)
+	}
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, errors.New("failed to hash password")
+	}
+	var issuer, subject *string
+	if identity != nil {
+		issuer, subject = &identity.Issuer, &identity.Subject
+	}
+	q2 := s.db.Rebind("INSERT INTO users (username, password, role, oidc_issuer, oidc_subject) VALUES (?, ?, ?, ?, ?)")
+	if _, err = s.db.ExecContext(ctx, q2, username, string(hashedBytes), role, issuer, subject); err != nil {
+		return nil, errors.New("failed to create new user")
+	}
+	return s.RetrieveUser(ctx, username)
+}
+
+func (s MysqlStore) RecordLoginFailure(ctx context.Context, username string, maxAttempts uint, lockout time.Duration) (bool, error) {
+	if maxAttempts == 0 || lockout <= 0 {
+		return false, nil
+	}
+	now := time.Now().UTC()
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, errors.New("failed to record login failure")
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	q1 := tx.Rebind(`
+		UPDATE users SET
+			locked_until = CASE WHEN failed_attempts + 1 > ? THEN ? ELSE locked_until END,
+			failed_attempts = CASE WHEN failed_attempts + 1 > ? THEN 0 ELSE failed_attempts + 1 END
+		WHERE username = ? AND (locked_until IS NULL OR locked_until <= ?)`)
+	if _, err = tx.ExecContext(ctx, q1, maxAttempts, now.Add(lockout), maxAttempts, username, now); err != nil {
+		return false, errors.New("failed to record login failure")
+	}
+	var lockedUntil sql.NullTime
+	q2 := tx.Rebind("SELECT locked_until FROM users WHERE username = ?")
+	if err = tx.GetContext(ctx, &lockedUntil, q2, username); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, errors.New("failed to record login failure")
+	}
+	if err = tx.Commit(); err != nil {
+		return false, errors.New("failed to record login failure")
+	}
+	return lockedUntil.Valid && lockedUntil.Time.After(now), nil
+}
+
+func (s MysqlStore) CreateAPIToken(ctx context.Context, username string, name string, tokenHash string) (*APIToken, error) {
+	q1 := s.db.Rebind("INSERT INTO api_tokens (user_id, name, token_hash) VALUES (" + userIDSubquery + ", ?, ?)")
+	r, err := s.db.ExecContext(ctx, q1, username, name, tokenHash)
+	if err != nil {
+		return nil, errors.New("failed to create api token")
+	}
+	id, err := r.LastInsertId()
+	if err != nil {
+		return nil, errors.New("failed to create api token")
+	}
+	var token APIToken
+	q2 := s.db.Rebind(selectAPITokens + " WHERE api_tokens.id = ?")
+	if err = s.db.GetContext(ctx, &token, q2, id); err != nil {
+		return nil, errors.New("failed to create api token")
+	}
+	return &token, nil
+}
+
+func (s MysqlStore) CreateLink(ctx context.Context, url, creatorUsername string) (*Link, error) {
+	q := s.db.Rebind("INSERT INTO links (url, created_by_id) VALUES (?, " + userIDSubquery + ")")
+	r, err := s.db.ExecContext(ctx, q, url, creatorUsername)
+	if err != nil {
+		return nil, errors.New("failed to create new link")
+	}
+	id, err := r.LastInsertId()
+	if err != nil {
+		return nil, errors.New("failed to create new link")
+	}
+	return s.RetrieveLink(ctx, uint(id))
+}
+
+func (s MysqlStore) RetrieveLinkAndBumpVisits(ctx context.Context, id uint) (*Link, error) {
+	r, err := s.db.ExecContext(ctx, s.db.Rebind("UPDATE links SET visits = visits + 1 WHERE id = ?"), id)
+	if err != nil {
+		return nil, errors.New("failed to retrieve link")
+	}
+	if a, err := r.RowsAffected(); err != nil || a != 1 {
+		return nil, notFoundError("failed to retrieve link")
+	}
+	return s.RetrieveLink(ctx, id)
+}
+
+func (s MysqlStore) CreateTeamLink(ctx context.Context, url, creatorUsername string, teamID uint) (*Link, error) {
+	q := s.db.Rebind("INSERT INTO links (url, created_by_id, team_id) VALUES (?, " + userIDSubquery + ", ?)")
+	r, err := s.db.ExecContext(ctx, q, url, creatorUsername, teamID)
+	if err != nil {
+		return nil, errors.New("failed to create new link")
+	}
+	id, err := r.LastInsertId()
+	if err != nil {
+		return nil, errors.New("failed to create new link")
+	}
+	return s.RetrieveLink(ctx, uint(id))
+}
+
+func (s MysqlStore) CreateTeam(ctx context.Context, name string, ownerUsername string) (*Team, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.New("failed to create new team")
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var count uint
+	if err = tx.GetContext(ctx, &count, tx.Rebind("SELECT count(*) FROM teams WHERE name = ?"), name); err != nil {
+		return nil, fmt.Errorf("failed to check team name: %w", err)
+	}
+	if count > 0 {
+		return nil, conflictError("%s is already taken", name)
+	}
+
+	r, err := tx.ExecContext(ctx, tx.Rebind("INSERT INTO teams (name) VALUES (?)"), name)
+	if err != nil {
+		return nil, errors.New("failed to create new team")
+	}
+	id, err := r.LastInsertId()
+	if err != nil {
+		return nil, errors.New("failed to create new team")
+	}
+	q := tx.Rebind("INSERT INTO team_members (team_id, user_id, role) VALUES (?, " + userIDSubquery + ", ?)")
+	if _, err = tx.ExecContext(ctx, q, id, ownerUsername, TeamRoleOwner); err != nil {
+		return nil, errors.New("failed to create new team")
+	}
+	var team Team
+	if err = tx.GetContext(ctx, &team, tx.Rebind("SELECT * FROM teams WHERE id = ?"), id); err != nil {
+		return nil, errors.New("failed to create new team")
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, errors.New("failed to create new team")
+	}
+	return &team, nil
+}
+
+func (s MysqlStore) SetTeamMember(ctx context.Context, teamID uint, username string, role TeamRole) error {
+	q := s.db.Rebind(`INSERT INTO team_members (team_id, user_id, role) VALUES (?, ` + userIDSubquery + `, ?)
+		ON DUPLICATE KEY UPDATE role = VALUES(role)`)
+	_, err := s.db.ExecContext(ctx, q, teamID, username, role)
+	if err != nil {
+		return errors.New("failed to update team member")
+	}
+	return nil
+}
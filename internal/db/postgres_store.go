@@ -2,9 +2,11 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"golang.org/x/crypto/bcrypt"
@@ -25,13 +27,155 @@ CREATE TABLE IF NOT EXISTS links (
 	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
 	FOREIGN KEY (created_by) REFERENCES users(username)
 );
+CREATE TABLE IF NOT EXISTS schema_version (
+	version INTEGER NOT NULL
+);
 `
 
+var postgresMigrations = []string{
+	`
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_attempts INTEGER DEFAULT 0 NOT NULL;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP NULL;
+	CREATE TABLE IF NOT EXISTS login_events (
+		id BIGSERIAL PRIMARY KEY NOT NULL,
+		username VARCHAR(32) NOT NULL,
+		success BOOLEAN NOT NULL,
+		method VARCHAR(16) NOT NULL,
+		reason VARCHAR(32) DEFAULT '' NOT NULL,
+		ip VARCHAR(64) DEFAULT '' NOT NULL,
+		user_agent TEXT DEFAULT '' NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS login_events_username_idx ON login_events (username, created_at);
+	`,
+	`
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(64) DEFAULT '' NOT NULL;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN DEFAULT FALSE NOT NULL;
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		id BIGSERIAL PRIMARY KEY NOT NULL,
+		username VARCHAR(32) NOT NULL,
+		code_hash CHAR(64) NOT NULL,
+		FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id BIGSERIAL PRIMARY KEY NOT NULL,
+		username VARCHAR(32) NOT NULL,
+		name VARCHAR(64) NOT NULL,
+		token_hash CHAR(64) UNIQUE NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+		last_used_at TIMESTAMP NULL,
+		FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS sessions (
+		token_hash CHAR(64) PRIMARY KEY NOT NULL,
+		username VARCHAR(32) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+	);
+	`,
+	`
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(16) DEFAULT 'creator' NOT NULL;
+	UPDATE users SET role = 'admin' WHERE is_admin;
+	ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
+	`,
+	`
+	CREATE TABLE IF NOT EXISTS teams (
+		id BIGSERIAL PRIMARY KEY NOT NULL,
+		name VARCHAR(32) UNIQUE NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS team_members (
+		team_id BIGINT NOT NULL,
+		username VARCHAR(32) NOT NULL,
+		role VARCHAR(16) DEFAULT 'editor' NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+		PRIMARY KEY (team_id, username),
+		FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE,
+		FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS team_members_username_idx ON team_members (username);
+	ALTER TABLE links ADD COLUMN IF NOT EXISTS team_id BIGINT NULL REFERENCES teams(id);
+	ALTER TABLE links ALTER COLUMN created_by DROP NOT NULL;
+	ALTER TABLE links DROP CONSTRAINT IF EXISTS links_created_by_fkey;
+	ALTER TABLE links ADD CONSTRAINT links_created_by_fkey FOREIGN KEY (created_by) REFERENCES users(username) ON DELETE SET NULL;
+	CREATE INDEX IF NOT EXISTS links_created_by_idx ON links (created_by);
+	CREATE INDEX IF NOT EXISTS links_team_id_idx ON links (team_id);
+	`,
+	`
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS id BIGSERIAL NOT NULL;
+	ALTER TABLE links ADD COLUMN IF NOT EXISTS created_by_id BIGINT NULL;
+	UPDATE links SET created_by_id = users.id FROM users WHERE users.username = links.created_by;
+	ALTER TABLE links DROP COLUMN created_by;
+	ALTER TABLE recovery_codes ADD COLUMN IF NOT EXISTS user_id BIGINT NULL;
+	UPDATE recovery_codes SET user_id = users.id FROM users WHERE users.username = recovery_codes.username;
+	DELETE FROM recovery_codes WHERE user_id IS NULL;
+	ALTER TABLE recovery_codes DROP COLUMN username;
+	ALTER TABLE recovery_codes ALTER COLUMN user_id SET NOT NULL;
+	ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS user_id BIGINT NULL;
+	UPDATE api_tokens SET user_id = users.id FROM users WHERE users.username = api_tokens.username;
+	DELETE FROM api_tokens WHERE user_id IS NULL;
+	ALTER TABLE api_tokens DROP COLUMN username;
+	ALTER TABLE api_tokens ALTER COLUMN user_id SET NOT NULL;
+	ALTER TABLE sessions ADD COLUMN IF NOT EXISTS user_id BIGINT NULL;
+	UPDATE sessions SET user_id = users.id FROM users WHERE users.username = sessions.username;
+	DELETE FROM sessions WHERE user_id IS NULL;
+	ALTER TABLE sessions DROP COLUMN username;
+	ALTER TABLE sessions ALTER COLUMN user_id SET NOT NULL;
+	ALTER TABLE team_members ADD COLUMN IF NOT EXISTS user_id BIGINT NULL;
+	UPDATE team_members SET user_id = users.id FROM users WHERE users.username = team_members.username;
+	DELETE FROM team_members WHERE user_id IS NULL;
+	ALTER TABLE team_members DROP COLUMN username;
+	ALTER TABLE team_members ALTER COLUMN user_id SET NOT NULL;
+	ALTER TABLE team_members ADD PRIMARY KEY (team_id, user_id);
+	ALTER TABLE users DROP CONSTRAINT users_pkey;
+	ALTER TABLE users ADD PRIMARY KEY (id);
+	ALTER TABLE users ADD CONSTRAINT users_username_key UNIQUE (username);
+	ALTER TABLE links ADD CONSTRAINT links_created_by_id_fkey FOREIGN KEY (created_by_id) REFERENCES users(id) ON DELETE SET NULL;
+	ALTER TABLE recovery_codes ADD CONSTRAINT recovery_codes_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+	ALTER TABLE api_tokens ADD CONSTRAINT api_tokens_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+	ALTER TABLE sessions ADD CONSTRAINT sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+	ALTER TABLE team_members ADD CONSTRAINT team_members_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+	CREATE INDEX IF NOT EXISTS links_created_by_id_idx ON links (created_by_id);
+	CREATE INDEX IF NOT EXISTS recovery_codes_user_id_idx ON recovery_codes (user_id);
+	CREATE INDEX IF NOT EXISTS api_tokens_user_id_idx ON api_tokens (user_id);
+	CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+	CREATE INDEX IF NOT EXISTS team_members_user_id_idx ON team_members (user_id);
+	`,
+	`
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_issuer VARCHAR(255) NULL;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_subject VARCHAR(255) NULL;
+	CREATE UNIQUE INDEX IF NOT EXISTS users_oidc_identity_idx ON users (oidc_issuer, oidc_subject);
+	`,
+	`
+	ALTER TABLE login_events ADD COLUMN IF NOT EXISTS user_id BIGINT NULL REFERENCES users(id) ON DELETE SET NULL;
+	UPDATE login_events SET user_id = users.id FROM users WHERE users.username = login_events.username;
+	CREATE INDEX IF NOT EXISTS login_events_user_id_idx ON login_events (user_id, id);
+	`,
+}
+
+const (
+	userIDSubquery    = "(SELECT id FROM users WHERE username = ?)"
+	selectLinks       = "SELECT links.*, users.username AS created_by FROM links LEFT JOIN users ON users.id = links.created_by_id"
+	selectAPITokens   = "SELECT api_tokens.*, users.username FROM api_tokens JOIN users ON users.id = api_tokens.user_id"
+	selectTeamMembers = "SELECT team_members.*, users.username FROM team_members JOIN users ON users.id = team_members.user_id"
+)
+
 type PostgresStore struct {
-	db *sqlx.DB
+	db       *sqlx.DB
+	reader   *sqlx.DB
+	replicas *replicaSet
+}
+
+func (s PostgresStore) CreateUser(ctx context.Context, username string, password string, role Role) (*User, error) {
+	return s.insertUser(ctx, username, password, role, nil)
+}
+
+func (s PostgresStore) CreateOIDCUser(ctx context.Context, username string, password string, role Role, identity OIDCIdentity) (*User, error) {
+	return s.insertUser(ctx, username, password, role, &identity)
 }
 
-func (s PostgresStore) CreateUser(ctx context.Context, username string, password string) (*User, error) {
+func (s PostgresStore) insertUser(ctx context.Context, username string, password string, role Role, identity *OIDCIdentity) (*User, error) {
 	var count uint
 	q1 := s.db.Rebind("SELECT count(*) FROM users where username = ?")
 	err := s.db.GetContext(ctx, &count, q1, username)
@@ -39,15 +183,19 @@ func (s PostgresStore) CreateUser(ctx context.Context, username string, password
 		return nil, fmt.Errorf("failed to check username: %w", err)
 	}
 	if count > 0 {
-		return nil, fmt.Errorf("%s is already taken", username)
+		return nil, conflictError("%s is already taken", username)
 	}
 	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, errors.New("failed to hash password")
 	}
+	var issuer, subject *string
+	if identity != nil {
+		issuer, subject = &identity.Issuer, &identity.Subject
+	}
 	var user User
-	q2 := s.db.Rebind("INSERT INTO users (username, password) VALUES (?, ?) RETURNING *")
-	err = s.db.GetContext(ctx, &user, q2, username, string(hashedBytes))
+	q2 := s.db.Rebind("INSERT INTO users (username, password, role, oidc_issuer, oidc_subject) VALUES (?, ?, ?, ?, ?) RETURNING *")
+	err = s.db.GetContext(ctx, &user, q2, username, string(hashedBytes), role, issuer, subject)
 	if err != nil {
 		return nil, errors.New("failed to create new user")
 	}
@@ -56,7 +204,7 @@ func (s PostgresStore) CreateUser(ctx context.Context, username string, password
 
 func (s PostgresStore) RetrieveAllUsers(ctx context.Context) ([]User, error) {
 	var users []User
-	err := s.db.SelectContext(ctx, &users, "SELECT * FROM users")
+	err := s.reader.SelectContext(ctx, &users, "SELECT * FROM users ORDER BY id")
 	if err != nil {
 		return nil, errors.New("failed to retrieve users")
 	}
@@ -65,20 +213,61 @@ func (s PostgresStore) RetrieveAllUsers(ctx context.Context) ([]User, error) {
 
 func (s PostgresStore) RetrieveUser(ctx context.Context, username string) (*User, error) {
 	var user User
-	q := s.db.Rebind("SELECT * FROM users WHERE username = ?")
-	err := s.db.GetContext(ctx, &user, q, username)
+	q := s.reader.Rebind("SELECT * FROM users WHERE username = ?")
+	err := s.reader.GetContext(ctx, &user, q, username)
 	if err != nil {
-		return nil, errors.New("failed to retrieve user")
+		return nil, retrieveError(err, "failed to retrieve user")
 	}
 	return &user, nil
 }
 
+func (s PostgresStore) RetrieveUserByOIDCIdentity(ctx context.Context, identity OIDCIdentity) (*User, error) {
+	var user User
+	q := s.reader.Rebind("SELECT * FROM users WHERE oidc_issuer = ? AND oidc_subject = ?")
+	err := s.reader.GetContext(ctx, &user, q, identity.Issuer, identity.Subject)
+	if err != nil {
+		return nil, retrieveError(err, "failed to retrieve user")
+	}
+	return &user, nil
+}
+
+func (s PostgresStore) LinkOIDCIdentity(ctx context.Context, username string, identity OIDCIdentity) error {
+	q := s.db.Rebind("UPDATE users SET oidc_issuer = ?, oidc_subject = ? WHERE username = ? AND oidc_issuer IS NULL")
+	r, err := s.db.ExecContext(ctx, q, identity.Issuer, identity.Subject, username)
+	if err != nil {
+		return errors.New("failed to link identity")
+	}
+	if a, err := r.RowsAffected(); err != nil || a != 1 {
+		return conflictError("%s is already linked to an identity", username)
+	}
+	return nil
+}
+
 func (s PostgresStore) UpdateUsername(ctx context.Context, username, newUsername string) error {
-	q := s.db.Rebind("UPDATE users SET username = ? WHERE username = ?")
-	_, err := s.db.ExecContext(ctx, q, newUsername, username)
+	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return errors.New("failed to update username")
 	}
+	defer func() { _ = tx.Rollback() }()
+
+	var count uint
+	if err = tx.GetContext(ctx, &count, tx.Rebind("SELECT count(*) FROM users WHERE username = ?"), newUsername); err != nil {
+		return fmt.Errorf("failed to check username: %w", err)
+	}
+	if count > 0 {
+		return conflictError("%s is already taken", newUsername)
+	}
+
+	r, err := tx.ExecContext(ctx, tx.Rebind("UPDATE users SET username = ? WHERE username = ?"), newUsername, username)
+	if err != nil {
+		return errors.New("failed to update username")
+	}
+	if a, err := r.RowsAffected(); err != nil || a != 1 {
+		return notFoundError("user not found")
+	}
+	if err = tx.Commit(); err != nil {
+		return errors.New("failed to update username")
+	}
 	return nil
 }
 
@@ -95,39 +284,324 @@ func (s PostgresStore) UpdatePassword(ctx context.Context, username, newPassword
 	return nil
 }
 
-func (s PostgresStore) ToggleAdmin(ctx context.Context, username string) error {
-	q := s.db.Rebind("UPDATE users SET is_admin = NOT is_admin WHERE username = ?")
-	_, err := s.db.ExecContext(ctx, q, username)
+func (s PostgresStore) SetRole(ctx context.Context, username string, role Role) error {
+	q := s.db.Rebind("UPDATE users SET role = ? WHERE username = ?")
+	r, err := s.db.ExecContext(ctx, q, role, username)
 	if err != nil {
-		return errors.New("failed to update admin status")
+		return errors.New("failed to update role")
+	}
+	if a, err := r.RowsAffected(); err != nil || a != 1 {
+		return notFoundError("user not found")
 	}
 	return nil
 }
 
 func (s PostgresStore) DeleteUser(ctx context.Context, username string) error {
-	q := s.db.Rebind("DELETE from users WHERE username = ?")
-	_, err := s.db.ExecContext(ctx, q, username)
+	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return errors.New("failed to delete user")
 	}
+	defer func() { _ = tx.Rollback() }()
+
+	var userID uint
+	if err = tx.GetContext(ctx, &userID, tx.Rebind("SELECT id FROM users WHERE username = ?"), username); err != nil {
+		return notFoundError("user not found")
+	}
+
+	var count uint
+	q1 := tx.Rebind("SELECT count(*) FROM links WHERE created_by_id = ? AND team_id IS NULL")
+	if err = tx.GetContext(ctx, &count, q1, userID); err != nil {
+		return errors.New("failed to delete user")
+	}
+	if count > 0 {
+		return conflictError("%s still owns %d links, reassign them first", username, count)
+	}
+
+	q2 := tx.Rebind("UPDATE links SET created_by_id = NULL WHERE created_by_id = ?")
+	if _, err = tx.ExecContext(ctx, q2, userID); err != nil {
+		return errors.New("failed to delete user")
+	}
+	if _, err = tx.ExecContext(ctx, tx.Rebind("DELETE from users WHERE id = ?"), userID); err != nil {
+		return errors.New("failed to delete user")
+	}
+	if err = tx.Commit(); err != nil {
+		return errors.New("failed to delete user")
+	}
+	return nil
+}
+
+func (s PostgresStore) RecordLoginFailure(ctx context.Context, username string, maxAttempts uint, lockout time.Duration) (bool, error) {
+	if maxAttempts == 0 || lockout <= 0 {
+		return false, nil
+	}
+	now := time.Now().UTC()
+	q := s.db.Rebind(`
+		UPDATE users SET
+			failed_attempts = CASE WHEN failed_attempts + 1 > ? THEN 0 ELSE failed_attempts + 1 END,
+			locked_until = CASE WHEN failed_attempts + 1 > ? THEN ? ELSE locked_until END
+		WHERE username = ? AND (locked_until IS NULL OR locked_until <= ?)
+		RETURNING locked_until`)
+	var lockedUntil sql.NullTime
+	err := s.db.GetContext(ctx, &lockedUntil, q, maxAttempts, maxAttempts, now.Add(lockout), username, now)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, errors.New("failed to record login failure")
+	}
+	return lockedUntil.Valid && lockedUntil.Time.After(now), nil
+}
+
+func (s PostgresStore) RefundLoginFailure(ctx context.Context, username string) error {
+	q := s.db.Rebind("UPDATE users SET failed_attempts = failed_attempts - 1 WHERE username = ? AND failed_attempts > 0")
+	_, err := s.db.ExecContext(ctx, q, username)
+	if err != nil {
+		return errors.New("failed to refund login failure")
+	}
+	return nil
+}
+
+func (s PostgresStore) ResetLoginFailures(ctx context.Context, username string) error {
+	q := s.db.Rebind("UPDATE users SET failed_attempts = 0 WHERE username = ? AND failed_attempts > 0")
+	_, err := s.db.ExecContext(ctx, q, username)
+	if err != nil {
+		return errors.New("failed to reset login failures")
+	}
+	return nil
+}
+
+func (s PostgresStore) UnlockUser(ctx context.Context, username string) error {
+	q := s.db.Rebind("UPDATE users SET failed_attempts = 0, locked_until = NULL WHERE username = ?")
+	_, err := s.db.ExecContext(ctx, q, username)
+	if err != nil {
+		return errors.New("failed to unlock user")
+	}
+	return nil
+}
+
+func (s PostgresStore) CreateLoginEvent(ctx context.Context, event *LoginEvent) error {
+	q := s.db.Rebind(`
+		INSERT INTO login_events (user_id, username, success, method, reason, ip, user_agent, created_at)
+		VALUES (` + userIDSubquery + `, ?, ?, ?, ?, ?, ?, ?)`)
+	_, err := s.db.ExecContext(ctx, q, event.Username, event.Username, event.Success, event.Method, event.Reason,
+		event.IP, event.UserAgent, time.Now().UTC())
+	if err != nil {
+		return errors.New("failed to record login event")
+	}
+	return nil
+}
+
+func (s PostgresStore) RetrieveLoginEvents(ctx context.Context, username string, limit int, offset int) ([]LoginEvent, error) {
+	events := make([]LoginEvent, 0, limit)
+	q := s.reader.Rebind("SELECT * FROM login_events WHERE user_id = " + userIDSubquery + " ORDER BY id DESC LIMIT ? OFFSET ?")
+	err := s.reader.SelectContext(ctx, &events, q, username, limit, offset)
+	if err != nil {
+		return nil, errors.New("failed to fetch login events")
+	}
+	return events, nil
+}
+
+func (s PostgresStore) DeleteLoginEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	q := s.db.Rebind("DELETE FROM login_events WHERE created_at < ?")
+	r, err := s.db.ExecContext(ctx, q, before.UTC())
+	if err != nil {
+		return 0, errors.New("failed to delete login events")
+	}
+	deleted, _ := r.RowsAffected()
+	return deleted, nil
+}
+
+func (s PostgresStore) SetTOTPSecret(ctx context.Context, username string, secret string) error {
+	q := s.db.Rebind("UPDATE users SET totp_secret = ? WHERE username = ? AND totp_enabled = ?")
+	r, err := s.db.ExecContext(ctx, q, secret, username, false)
+	if err != nil {
+		return errors.New("failed to save totp secret")
+	}
+	if a, err := r.RowsAffected(); err != nil || a != 1 {
+		return errors.New("two-factor authentication is already enabled")
+	}
+	return nil
+}
+
+func (s PostgresStore) EnableTOTP(ctx context.Context, username string, recoveryCodeHashes []string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.New("failed to enable two-factor authentication")
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err = tx.ExecContext(ctx, tx.Rebind("UPDATE users SET totp_enabled = ? WHERE username = ?"), true, username); err != nil {
+		return errors.New("failed to enable two-factor authentication")
+	}
+	if err = replaceRecoveryCodes(ctx, tx, username, recoveryCodeHashes); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return errors.New("failed to enable two-factor authentication")
+	}
+	return nil
+}
+
+func (s PostgresStore) DisableTOTP(ctx context.Context, username string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.New("failed to disable two-factor authentication")
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	q := tx.Rebind("UPDATE users SET totp_enabled = ?, totp_secret = '' WHERE username = ?")
+	if _, err = tx.ExecContext(ctx, q, false, username); err != nil {
+		return errors.New("failed to disable two-factor authentication")
+	}
+	if err = replaceRecoveryCodes(ctx, tx, username, nil); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return errors.New("failed to disable two-factor authentication")
+	}
+	return nil
+}
+
+func (s PostgresStore) UseRecoveryCode(ctx context.Context, username string, codeHash string) (bool, error) {
+	q := s.db.Rebind("DELETE FROM recovery_codes WHERE user_id = " + userIDSubquery + " AND code_hash = ?")
+	r, err := s.db.ExecContext(ctx, q, username, codeHash)
+	if err != nil {
+		return false, errors.New("failed to check recovery code")
+	}
+	a, err := r.RowsAffected()
+	return err == nil && a > 0, nil
+}
+
+func (s PostgresStore) CreateAPIToken(ctx context.Context, username string, name string, tokenHash string) (*APIToken, error) {
+	var token APIToken
+	q := s.db.Rebind("INSERT INTO api_tokens (user_id, name, token_hash) VALUES (" + userIDSubquery + ", ?, ?) RETURNING *")
+	err := s.db.GetContext(ctx, &token, q, username, name, tokenHash)
+	if err != nil {
+		return nil, errors.New("failed to create api token")
+	}
+	token.Username = username
+	return &token, nil
+}
+
+func (s PostgresStore) RetrieveAPITokens(ctx context.Context, username string) ([]APIToken, error) {
+	tokens := make([]APIToken, 0)
+	q := s.reader.Rebind(selectAPITokens + " WHERE users.username = ? ORDER BY api_tokens.id")
+	err := s.reader.SelectContext(ctx, &tokens, q, username)
+	if err != nil {
+		return nil, errors.New("failed to fetch api tokens")
+	}
+	return tokens, nil
+}
+
+func (s PostgresStore) RetrieveAPITokenByHash(ctx context.Context, tokenHash string) (*APIToken, error) {
+	q1 := s.db.Rebind("UPDATE api_tokens SET last_used_at = ? WHERE token_hash = ?")
+	r, err := s.db.ExecContext(ctx, q1, time.Now().UTC(), tokenHash)
+	if err != nil {
+		return nil, errors.New("failed to retrieve api token")
+	}
+	if a, err := r.RowsAffected(); err != nil || a != 1 {
+		return nil, notFoundError("failed to retrieve api token")
+	}
+
+	var token APIToken
+	q2 := s.db.Rebind(selectAPITokens + " WHERE api_tokens.token_hash = ?")
+	if err = s.db.GetContext(ctx, &token, q2, tokenHash); err != nil {
+		return nil, retrieveError(err, "failed to retrieve api token")
+	}
+	return &token, nil
+}
+
+func (s PostgresStore) DeleteAPIToken(ctx context.Context, username string, id uint) error {
+	q := s.db.Rebind("DELETE FROM api_tokens WHERE user_id = " + userIDSubquery + " AND id = ?")
+	r, err := s.db.ExecContext(ctx, q, username, id)
+	if err != nil {
+		return errors.New("failed to delete api token")
+	}
+	if a, err := r.RowsAffected(); err != nil || a != 1 {
+		return notFoundError("api token not found")
+	}
+	return nil
+}
+
+func (s PostgresStore) CreateSession(ctx context.Context, username string, tokenHash string, expiresAt time.Time) error {
+	q := s.db.Rebind("INSERT INTO sessions (token_hash, user_id, expires_at) VALUES (?, " + userIDSubquery + ", ?)")
+	_, err := s.db.ExecContext(ctx, q, tokenHash, username, expiresAt.UTC())
+	if err != nil {
+		return errors.New("failed to create session")
+	}
+	return nil
+}
+
+func (s PostgresStore) RetrieveSession(ctx context.Context, tokenHash string) (*Session, error) {
+	var session Session
+	q := s.reader.Rebind(`SELECT sessions.*, users.username FROM sessions
+		JOIN users ON users.id = sessions.user_id
+		WHERE sessions.token_hash = ? AND sessions.expires_at > ?`)
+	err := s.reader.GetContext(ctx, &session, q, tokenHash, time.Now().UTC())
+	if err != nil {
+		return nil, retrieveError(err, "failed to retrieve session")
+	}
+	return &session, nil
+}
+
+func (s PostgresStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	_, err := s.db.ExecContext(ctx, s.db.Rebind("DELETE FROM sessions WHERE token_hash = ?"), tokenHash)
+	if err != nil {
+		return errors.New("failed to delete session")
+	}
+	return nil
+}
+
+func (s PostgresStore) DeleteSessionsForUser(ctx context.Context, username string) error {
+	_, err := s.db.ExecContext(ctx, s.db.Rebind("DELETE FROM sessions WHERE user_id = "+userIDSubquery), username)
+	if err != nil {
+		return errors.New("failed to delete sessions")
+	}
+	return nil
+}
+
+func (s PostgresStore) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	r, err := s.db.ExecContext(ctx, s.db.Rebind("DELETE FROM sessions WHERE expires_at <= ?"), time.Now().UTC())
+	if err != nil {
+		return 0, errors.New("failed to delete expired sessions")
+	}
+	deleted, _ := r.RowsAffected()
+	return deleted, nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sqlx.Tx, username string, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, tx.Rebind("DELETE FROM recovery_codes WHERE user_id = "+userIDSubquery), username); err != nil {
+		return errors.New("failed to replace recovery codes")
+	}
+	q := tx.Rebind("INSERT INTO recovery_codes (user_id, code_hash) VALUES (" + userIDSubquery + ", ?)")
+	for _, codeHash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, q, username, codeHash); err != nil {
+			return errors.New("failed to replace recovery codes")
+		}
+	}
 	return nil
 }
 
 func (s PostgresStore) CreateLink(ctx context.Context, url, creatorUsername string) (*Link, error) {
 	var link Link
-	q := s.db.Rebind(`INSERT INTO links (url, created_by) VALUES (?, ?) RETURNING *`)
+	q := s.db.Rebind("INSERT INTO links (url, created_by_id) VALUES (?, " + userIDSubquery + ") RETURNING *")
 	err := s.db.GetContext(ctx, &link, q, url, creatorUsername)
 	if err != nil {
 		return nil, errors.New("failed to create new link")
 	}
+	link.CreatedBy = &creatorUsername
 	return &link, err
 }
 
 func (s PostgresStore) RetrieveLink(ctx context.Context, id uint) (*Link, error) {
+	reader := s.linkReader(ctx)
 	var link Link
-	err := s.db.GetContext(ctx, &link, s.db.Rebind("SELECT * FROM links WHERE id = ?"), id)
+	err := reader.GetContext(ctx, &link, reader.Rebind(selectLinks+" WHERE links.id = ?"), id)
+	if errors.Is(err, sql.ErrNoRows) && reader != s.reader {
+		return s.RetrieveLink(WithPrimary(ctx), id)
+	}
 	if err != nil {
-		return nil, errors.New("failed to retrieve link")
+		return nil, retrieveError(err, "failed to retrieve link")
 	}
 	return &link, nil
 }
@@ -149,7 +623,7 @@ func (s PostgresStore) RetrieveLinkAndBumpVisits(ctx context.Context, id uint) (
 	q := s.db.Rebind("UPDATE links SET visits = visits + 1 WHERE id = ? RETURNING *")
 	err := s.db.GetContext(ctx, &link, q, id)
 	if err != nil {
-		return nil, errors.New("failed to retrieve link")
+		return nil, retrieveError(err, "failed to retrieve link")
 	}
 	return &link, nil
 }
@@ -163,22 +637,255 @@ func (s PostgresStore) DeleteLink(ctx context.Context, id uint) error {
 }
 
 func (s PostgresStore) GetLinkCountForUser(ctx context.Context, username string) uint {
+	reader := s.linkReader(ctx)
 	var count uint
-	_ = s.db.GetContext(ctx, &count, s.db.Rebind("SELECT count(*) FROM links where created_by = ?"), username)
+	q := reader.Rebind("SELECT count(*) FROM links where created_by_id = " + userIDSubquery + " AND team_id IS NULL")
+	_ = reader.GetContext(ctx, &count, q, username)
 	return count
 }
 
 func (s PostgresStore) RetrieveLinksForUser(ctx context.Context, username string, limit int, offset int) ([]Link, error) {
+	reader := s.linkReader(ctx)
+	links := make([]Link, limit)
+	q := reader.Rebind(selectLinks + " WHERE users.username = ? AND links.team_id IS NULL ORDER BY links.id DESC LIMIT ? OFFSET ?")
+	err := reader.SelectContext(ctx, &links, q, username, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch links")
+	}
+	return links, nil
+}
+
+func (s PostgresStore) CreateTeamLink(ctx context.Context, url, creatorUsername string, teamID uint) (*Link, error) {
+	var link Link
+	q := s.db.Rebind("INSERT INTO links (url, created_by_id, team_id) VALUES (?, " + userIDSubquery + ", ?) RETURNING *")
+	err := s.db.GetContext(ctx, &link, q, url, creatorUsername, teamID)
+	if err != nil {
+		return nil, errors.New("failed to create new link")
+	}
+	link.CreatedBy = &creatorUsername
+	return &link, err
+}
+
+func (s PostgresStore) GetLinkCountForTeam(ctx context.Context, teamID uint) uint {
+	reader := s.linkReader(ctx)
+	var count uint
+	_ = reader.GetContext(ctx, &count, reader.Rebind("SELECT count(*) FROM links where team_id = ?"), teamID)
+	return count
+}
+
+func (s PostgresStore) RetrieveLinksForTeam(ctx context.Context, teamID uint, limit int, offset int) ([]Link, error) {
+	reader := s.linkReader(ctx)
 	links := make([]Link, limit)
-	q := s.db.Rebind("SELECT * FROM links WHERE created_by = ? ORDER BY id DESC LIMIT ? OFFSET ?")
-	err := s.db.SelectContext(ctx, &links, q, username, limit, offset)
+	q := reader.Rebind(selectLinks + " WHERE links.team_id = ? ORDER BY links.id DESC LIMIT ? OFFSET ?")
+	err := reader.SelectContext(ctx, &links, q, teamID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch links")
 	}
 	return links, nil
 }
 
+func (s PostgresStore) TransferLink(ctx context.Context, id uint, owner LinkOwner) error {
+	var r sql.Result
+	var err error
+	if owner.TeamID != 0 {
+		r, err = s.db.ExecContext(ctx, s.db.Rebind("UPDATE links SET team_id = ? WHERE id = ?"), owner.TeamID, id)
+	} else {
+		q := s.db.Rebind("UPDATE links SET created_by_id = " + userIDSubquery + ", team_id = NULL WHERE id = ?")
+		r, err = s.db.ExecContext(ctx, q, owner.Username, id)
+	}
+	if err != nil {
+		return errors.New("failed to transfer link")
+	}
+	if a, err := r.RowsAffected(); err != nil || a != 1 {
+		return notFoundError("link not found")
+	}
+	return nil
+}
+
+func (s PostgresStore) TransferUserLinks(ctx context.Context, username string, owner LinkOwner) (int64, error) {
+	var r sql.Result
+	var err error
+	if owner.TeamID != 0 {
+		q := s.db.Rebind("UPDATE links SET team_id = ? WHERE created_by_id = " + userIDSubquery + " AND team_id IS NULL")
+		r, err = s.db.ExecContext(ctx, q, owner.TeamID, username)
+	} else {
+		q := s.db.Rebind("UPDATE links SET created_by_id = " + userIDSubquery +
+			" WHERE created_by_id = " + userIDSubquery + " AND team_id IS NULL")
+		r, err = s.db.ExecContext(ctx, q, owner.Username, username)
+	}
+	if err != nil {
+		return 0, errors.New("failed to transfer links")
+	}
+	return r.RowsAffected()
+}
+
+func (s PostgresStore) CreateTeam(ctx context.Context, name string, ownerUsername string) (*Team, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.New("failed to create new team")
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var count uint
+	if err = tx.GetContext(ctx, &count, tx.Rebind("SELECT count(*) FROM teams WHERE name = ?"), name); err != nil {
+		return nil, fmt.Errorf("failed to check team name: %w", err)
+	}
+	if count > 0 {
+		return nil, conflictError("%s is already taken", name)
+	}
+
+	var team Team
+	if err = tx.GetContext(ctx, &team, tx.Rebind("INSERT INTO teams (name) VALUES (?) RETURNING *"), name); err != nil {
+		return nil, errors.New("failed to create new team")
+	}
+	q := tx.Rebind("INSERT INTO team_members (team_id, user_id, role) VALUES (?, " + userIDSubquery + ", ?)")
+	if _, err = tx.ExecContext(ctx, q, team.ID, ownerUsername, TeamRoleOwner); err != nil {
+		return nil, errors.New("failed to create new team")
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, errors.New("failed to create new team")
+	}
+	return &team, nil
+}
+
+func (s PostgresStore) RetrieveAllTeams(ctx context.Context) ([]Team, error) {
+	var teams []Team
+	err := s.reader.SelectContext(ctx, &teams, "SELECT * FROM teams ORDER BY name")
+	if err != nil {
+		return nil, errors.New("failed to retrieve teams")
+	}
+	return teams, nil
+}
+
+func (s PostgresStore) RetrieveTeam(ctx context.Context, name string) (*Team, error) {
+	var team Team
+	err := s.reader.GetContext(ctx, &team, s.reader.Rebind("SELECT * FROM teams WHERE name = ?"), name)
+	if err != nil {
+		return nil, retrieveError(err, "failed to retrieve team")
+	}
+	return &team, nil
+}
+
+func (s PostgresStore) RetrieveTeamsForUser(ctx context.Context, username string) ([]Team, error) {
+	var teams []Team
+	q := s.reader.Rebind(`SELECT teams.* FROM teams
+		JOIN team_members ON team_members.team_id = teams.id
+		JOIN users ON users.id = team_members.user_id
+		WHERE users.username = ? ORDER BY teams.name`)
+	err := s.reader.SelectContext(ctx, &teams, q, username)
+	if err != nil {
+		return nil, errors.New("failed to retrieve teams")
+	}
+	return teams, nil
+}
+
+func (s PostgresStore) DeleteTeam(ctx context.Context, id uint) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.New("failed to delete team")
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var count uint
+	if err = tx.GetContext(ctx, &count, tx.Rebind("SELECT count(*) FROM links WHERE team_id = ?"), id); err != nil {
+		return errors.New("failed to delete team")
+	}
+	if count > 0 {
+		return conflictError("team still owns %d links, reassign them first", count)
+	}
+
+	if _, err = tx.ExecContext(ctx, tx.Rebind("DELETE FROM team_members WHERE team_id = ?"), id); err != nil {
+		return errors.New("failed to delete team")
+	}
+	if _, err = tx.ExecContext(ctx, tx.Rebind("DELETE FROM teams WHERE id = ?"), id); err != nil {
+		return errors.New("failed to delete team")
+	}
+	if err = tx.Commit(); err != nil {
+		return errors.New("failed to delete team")
+	}
+	return nil
+}
+
+func (s PostgresStore) SetTeamMember(ctx context.Context, teamID uint, username string, role TeamRole) error {
+	q := s.db.Rebind(`INSERT INTO team_members (team_id, user_id, role) VALUES (?, ` + userIDSubquery + `, ?)
+		ON CONFLICT (team_id, user_id) DO UPDATE SET role = excluded.role`)
+	_, err := s.db.ExecContext(ctx, q, teamID, username, role)
+	if err != nil {
+		return errors.New("failed to update team member")
+	}
+	return nil
+}
+
+func (s PostgresStore) RetrieveTeamMember(ctx context.Context, teamID uint, username string) (*TeamMember, error) {
+	var member TeamMember
+	q := s.reader.Rebind(selectTeamMembers + " WHERE team_members.team_id = ? AND users.username = ?")
+	err := s.reader.GetContext(ctx, &member, q, teamID, username)
+	if err != nil {
+		return nil, retrieveError(err, "failed to retrieve team member")
+	}
+	return &member, nil
+}
+
+func (s PostgresStore) RetrieveTeamMembers(ctx context.Context, teamID uint) ([]TeamMember, error) {
+	var members []TeamMember
+	q := s.reader.Rebind(selectTeamMembers + " WHERE team_members.team_id = ? ORDER BY users.username")
+	err := s.reader.SelectContext(ctx, &members, q, teamID)
+	if err != nil {
+		return nil, errors.New("failed to retrieve team members")
+	}
+	return members, nil
+}
+
+func (s PostgresStore) RemoveTeamMember(ctx context.Context, teamID uint, username string) error {
+	q := s.db.Rebind("DELETE FROM team_members WHERE team_id = ? AND user_id = " + userIDSubquery)
+	r, err := s.db.ExecContext(ctx, q, teamID, username)
+	if err != nil {
+		return errors.New("failed to remove team member")
+	}
+	if a, err := r.RowsAffected(); err != nil || a != 1 {
+		return notFoundError("team member not found")
+	}
+	return nil
+}
+
+func (s PostgresStore) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return errors.New("failed to reach database")
+	}
+	return nil
+}
+
+func (s PostgresStore) SchemaVersion(ctx context.Context) (uint, error) {
+	var version uint
+	err := s.reader.GetContext(ctx, &version, "SELECT max(version) FROM schema_version")
+	if err != nil {
+		return 0, errors.New("failed to retrieve schema version")
+	}
+	return version, nil
+}
+
+func (s PostgresStore) Stats() sql.DBStats {
+	return s.db.Stats()
+}
+
+func (s PostgresStore) linkReader(ctx context.Context) *sqlx.DB {
+	if s.replicas != nil && !usesPrimary(ctx) {
+		if db := s.replicas.pick(); db != nil {
+			return db
+		}
+	}
+	return s.reader
+}
+
 func (s PostgresStore) Close() {
+	if s.replicas != nil {
+		s.replicas.close()
+	}
+	if s.reader != s.db {
+		if err := s.reader.Close(); err != nil {
+			slog.Warn("failed to close database connection")
+		}
+	}
 	if err := s.db.Close(); err != nil {
 		slog.Warn("failed to close database connection")
 	}
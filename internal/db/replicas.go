@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+)
+
+const (
+	replicaCheckInterval = 5 * time.Second
+	replicaCheckTimeout  = 2 * time.Second
+)
+
+const replicaLagQuery = `SELECT CASE
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END::float8`
+
+type primaryContextKey struct{}
+
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+func usesPrimary(ctx context.Context) bool {
+	forced, _ := ctx.Value(primaryContextKey{}).(bool)
+	return forced
+}
+
+type replica struct {
+	db      *sqlx.DB
+	name    string
+	healthy atomic.Bool
+}
+
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+	maxLag   time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func openReplicas(conf *cfg.Config) (*replicaSet, error) {
+	set := &replicaSet{
+		maxLag: conf.Database.ReplicaMaxLag,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	for _, rawURL := range conf.Database.Replicas {
+		dsn, err := postgresDSN(conf, rawURL)
+		if err != nil {
+			set.closeAll()
+			return nil, err
+		}
+
+		db, err := sqlx.Open("pgx", dsn)
+		if err != nil {
+			set.closeAll()
+			return nil, err
+		}
+		configurePool(db, conf)
+
+		r := &replica{db: db, name: replicaName(dsn)}
+		r.healthy.Store(true)
+		set.replicas = append(set.replicas, r)
+	}
+
+	set.checkAll()
+	go set.monitor()
+
+	return set, nil
+}
+
+func (s *replicaSet) pick() *sqlx.DB {
+	n := uint64(len(s.replicas))
+	start := s.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if r := s.replicas[(start+i)%n]; r.healthy.Load() {
+			return r.db
+		}
+	}
+	return nil
+}
+
+func (s *replicaSet) monitor() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.checkAll()
+		}
+	}
+}
+
+func (s *replicaSet) checkAll() {
+	for _, r := range s.replicas {
+		s.check(r)
+	}
+}
+
+func (s *replicaSet) check(r *replica) {
+	ctx, cancel := context.WithTimeout(context.Background(), replicaCheckTimeout)
+	defer cancel()
+
+	var seconds float64
+	err := r.db.GetContext(ctx, &seconds, replicaLagQuery)
+	lag := time.Duration(seconds * float64(time.Second))
+
+	healthy := err == nil && (s.maxLag <= 0 || lag <= s.maxLag)
+	if r.healthy.Swap(healthy) == healthy {
+		return
+	}
+
+	if healthy {
+		slog.Info("database replica recovered", "replica", r.name)
+	} else if err != nil {
+		slog.Warn("database replica unreachable, reading from primary", "replica", r.name, "error", err)
+	} else {
+		slog.Warn("database replica lagging, reading from primary", "replica", r.name, "lag", lag.String())
+	}
+}
+
+func (s *replicaSet) close() {
+	close(s.stop)
+	<-s.done
+	s.closeAll()
+}
+
+func (s *replicaSet) closeAll() {
+	for _, r := range s.replicas {
+		if err := r.db.Close(); err != nil {
+			slog.Warn("failed to close database connection")
+		}
+	}
+}
+
+func replicaName(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return ""
+	}
+	if host := u.Query().Get("host"); host != "" {
+		return host
+	}
+	return u.Host
+}
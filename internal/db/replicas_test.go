@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+)
+
+func TestReplicaFailover(t *testing.T) {
+	conf := &cfg.Config{}
+	conf.Database.Username = "app"
+	conf.Database.Name = "links"
+	conf.Database.Replicas = []string{
+		"postgres://127.0.0.1:1?connect_timeout=1",
+		"postgres://127.0.0.1:2?connect_timeout=1",
+	}
+
+	replicas, err := openReplicas(conf)
+	if err != nil {
+		t.Fatalf("openReplicas: %v", err)
+	}
+
+	primary, err := sqlx.Open("pgx", "postgres://127.0.0.1:3/links")
+	if err != nil {
+		t.Fatalf("sqlx.Open: %v", err)
+	}
+	store := PostgresStore{db: primary, reader: primary, replicas: replicas}
+	defer store.Close()
+
+	ctx := context.Background()
+	if store.linkReader(ctx) != primary {
+		t.Error("unreachable replicas should fall back to the primary")
+	}
+
+	replicas.replicas[1].healthy.Store(true)
+	for i := 0; i < 4; i++ {
+		if store.linkReader(ctx) != replicas.replicas[1].db {
+			t.Fatal("reads should go to the healthy replica")
+		}
+	}
+	if store.linkReader(WithPrimary(ctx)) != primary {
+		t.Error("WithPrimary should force the primary")
+	}
+
+	replicas.replicas[0].healthy.Store(true)
+	seen := map[*sqlx.DB]bool{}
+	for i := 0; i < 4; i++ {
+		seen[store.linkReader(ctx)] = true
+	}
+	if len(seen) != 2 || seen[primary] {
+		t.Errorf("reads should be spread over both replicas, got %d targets", len(seen))
+	}
+
+	replicas.checkAll()
+	if store.linkReader(ctx) != primary {
+		t.Error("failed health checks should fall back to the primary")
+	}
+}
+
+func TestReplicaMissFallsBackToPrimary(t *testing.T) {
+	newSqliteStore := func(name string) *SqliteStore {
+		conf := &cfg.Config{}
+		conf.Database.Type = "sqlite3"
+		conf.Database.Name = filepath.Join(t.TempDir(), name)
+		store := newTestStore(t, conf).(*SqliteStore)
+		t.Cleanup(store.Close)
+		return store
+	}
+	primary := newSqliteStore("primary.sqlite3")
+	lagging := newSqliteStore("replica.sqlite3")
+
+	r := &replica{db: lagging.db, name: "lagging"}
+	r.healthy.Store(true)
+	store := PostgresStore{db: primary.db, reader: primary.reader, replicas: &replicaSet{replicas: []*replica{r}}}
+
+	ctx := context.Background()
+	mustCreateUser(t, store, "alice")
+	link, err := store.CreateLink(ctx, "https://example.com", "alice")
+	if err != nil {
+		t.Fatalf("failed to create link: %v", err)
+	}
+
+	found, err := store.RetrieveLink(ctx, link.ID)
+	if err != nil || found.URL != link.URL {
+		t.Errorf("a link missing on the replica should be read from the primary, got %+v (%v)", found, err)
+	}
+
+	_, err = store.RetrieveLink(ctx, link.ID+1)
+	expectKind(t, err, ErrNotFound, "retrieve missing link")
+}
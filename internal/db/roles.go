@@ -0,0 +1,100 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type Role string
+
+const (
+	RoleViewer    Role = "viewer"
+	RoleCreator   Role = "creator"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+const DefaultRole = RoleCreator
+
+type Permission string
+
+const (
+	PermissionViewLinks     Permission = "links:view"
+	PermissionCreateLinks   Permission = "links:create"
+	PermissionDeleteLinks   Permission = "links:delete"
+	PermissionModerateLinks Permission = "links:moderate"
+	PermissionManageTeams   Permission = "teams:manage"
+	PermissionManageUsers   Permission = "users:manage"
+)
+
+var Roles = []Role{RoleViewer, RoleCreator, RoleModerator, RoleAdmin}
+
+var rolePermissions = map[Role][]Permission{
+	RoleViewer: {
+		PermissionViewLinks,
+	},
+	RoleCreator: {
+		PermissionViewLinks,
+		PermissionCreateLinks,
+		PermissionDeleteLinks,
+		PermissionManageTeams,
+	},
+	RoleModerator: {
+		PermissionViewLinks,
+		PermissionCreateLinks,
+		PermissionDeleteLinks,
+		PermissionModerateLinks,
+		PermissionManageTeams,
+	},
+	RoleAdmin: {
+		PermissionViewLinks,
+		PermissionCreateLinks,
+		PermissionDeleteLinks,
+		PermissionModerateLinks,
+		PermissionManageTeams,
+		PermissionManageUsers,
+	},
+}
+
+func (r Role) Can(permission Permission) bool {
+	return slices.Contains(rolePermissions[r], permission)
+}
+
+func (r Role) Permissions() []Permission {
+	return slices.Clone(rolePermissions[r])
+}
+
+func ParseRole(value string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(value)))
+	if !slices.Contains(Roles, role) {
+		return "", fmt.Errorf("unknown role '%s' (valid roles: viewer, creator, moderator, admin)", value)
+	}
+	return role, nil
+}
+
+type TeamRole string
+
+const (
+	TeamRoleViewer TeamRole = "viewer"
+	TeamRoleEditor TeamRole = "editor"
+	TeamRoleOwner  TeamRole = "owner"
+)
+
+var TeamRoles = []TeamRole{TeamRoleViewer, TeamRoleEditor, TeamRoleOwner}
+
+func (r TeamRole) CanEditLinks() bool {
+	return r == TeamRoleEditor || r == TeamRoleOwner
+}
+
+func (r TeamRole) CanManageTeam() bool {
+	return r == TeamRoleOwner
+}
+
+func ParseTeamRole(value string) (TeamRole, error) {
+	role := TeamRole(strings.ToLower(strings.TrimSpace(value)))
+	if !slices.Contains(TeamRoles, role) {
+		return "", fmt.Errorf("unknown team role '%s' (valid roles: viewer, editor, owner)", value)
+	}
+	return role, nil
+}
@@ -0,0 +1,19 @@
+//go:build cgo && !purego
+
+package db
+
+import (
+	"database/sql/driver"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const sqliteDriverName = "mattn/go-sqlite3"
+
+func newSqliteDriver() driver.Driver {
+	return &sqlite3.SQLiteDriver{}
+}
+
+func sqliteDSN(path string) string {
+	return path
+}
@@ -0,0 +1,19 @@
+//go:build !cgo || purego
+
+package db
+
+import (
+	"database/sql/driver"
+
+	"modernc.org/sqlite"
+)
+
+const sqliteDriverName = "modernc.org/sqlite"
+
+func newSqliteDriver() driver.Driver {
+	return &sqlite.Driver{}
+}
+
+func sqliteDSN(path string) string {
+	return path + "?_time_format=sqlite"
+}
@@ -1,5 +1,18 @@
 package db
 
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+)
+
 const sqliteSetupSQL = `
 CREATE TABLE IF NOT EXISTS users (
 	username TEXT PRIMARY KEY NOT NULL,
@@ -15,8 +28,272 @@ CREATE TABLE IF NOT EXISTS links (
 	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
 	FOREIGN KEY (created_by) REFERENCES users(username)
 );
+CREATE TABLE IF NOT EXISTS schema_version (
+	version INTEGER NOT NULL
+);
 `
 
+var sqliteMigrations = []string{
+	`
+	ALTER TABLE users ADD COLUMN failed_attempts INTEGER DEFAULT 0 NOT NULL;
+	ALTER TABLE users ADD COLUMN locked_until TIMESTAMP NULL;
+	CREATE TABLE IF NOT EXISTS login_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+		username TEXT NOT NULL,
+		success INTEGER NOT NULL,
+		method TEXT NOT NULL,
+		reason TEXT DEFAULT '' NOT NULL,
+		ip TEXT DEFAULT '' NOT NULL,
+		user_agent TEXT DEFAULT '' NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS login_events_username_idx ON login_events (username, created_at);
+	`,
+	`
+	ALTER TABLE users ADD COLUMN totp_secret TEXT DEFAULT '' NOT NULL;
+	ALTER TABLE users ADD COLUMN totp_enabled INTEGER DEFAULT 0 NOT NULL;
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+		username TEXT NOT NULL,
+		code_hash TEXT NOT NULL,
+		FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+		username TEXT NOT NULL,
+		name TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+		last_used_at TIMESTAMP NULL,
+		FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS sessions (
+		token_hash TEXT PRIMARY KEY NOT NULL,
+		username TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+	);
+	`,
+	`
+	ALTER TABLE users ADD COLUMN role TEXT DEFAULT 'creator' NOT NULL;
+	UPDATE users SET role = 'admin' WHERE is_admin = 1;
+	ALTER TABLE users DROP COLUMN is_admin;
+	`,
+	`
+	CREATE TABLE IF NOT EXISTS teams (
+		id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+		name TEXT UNIQUE NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS team_members (
+		team_id INTEGER NOT NULL,
+		username TEXT NOT NULL,
+		role TEXT DEFAULT 'editor' NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+		PRIMARY KEY (team_id, username),
+		FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE,
+		FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS team_members_username_idx ON team_members (username);
+	CREATE TABLE links_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+		url TEXT NOT NULL,
+		visits INTEGER DEFAULT 0 NOT NULL,
+		created_by TEXT NULL,
+		team_id INTEGER NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+		FOREIGN KEY (created_by) REFERENCES users(username) ON DELETE SET NULL,
+		FOREIGN KEY (team_id) REFERENCES teams(id)
+	);
+	INSERT INTO links_new (id, url, visits, created_by, created_at)
+		SELECT id, url, visits, created_by, created_at FROM links;
+	DELETE FROM sqlite_sequence WHERE name = 'links_new';
+	INSERT INTO sqlite_sequence (name, seq) SELECT 'links_new', seq FROM sqlite_sequence WHERE name = 'links';
+	DROP TABLE links;
+	ALTER TABLE links_new RENAME TO links;
+	CREATE INDEX IF NOT EXISTS links_created_by_idx ON links (created_by);
+	CREATE INDEX IF NOT EXISTS links_team_id_idx ON links (team_id);
+	`,
+	`
+	CREATE TABLE users_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+		username TEXT UNIQUE NOT NULL,
+		password TEXT NOT NULL,
+		role TEXT DEFAULT 'creator' NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+		failed_attempts INTEGER DEFAULT 0 NOT NULL,
+		locked_until TIMESTAMP NULL,
+		totp_secret TEXT DEFAULT '' NOT NULL,
+		totp_enabled INTEGER DEFAULT 0 NOT NULL
+	);
+	INSERT INTO users_new (username, password, role, created_at, failed_attempts, locked_until, totp_secret, totp_enabled)
+		SELECT username, password, role, created_at, failed_attempts, locked_until, totp_secret, totp_enabled
+		FROM users ORDER BY created_at, username;
+	CREATE TABLE links_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+		url TEXT NOT NULL,
+		visits INTEGER DEFAULT 0 NOT NULL,
+		created_by_id INTEGER NULL,
+		team_id INTEGER NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+		FOREIGN KEY (created_by_id) REFERENCES users(id) ON DELETE SET NULL,
+		FOREIGN KEY (team_id) REFERENCES teams(id)
+	);
+	INSERT INTO links_new (id, url, visits, created_by_id, team_id, created_at)
+		SELECT links.id, links.url, links.visits, users_new.id, links.team_id, links.created_at
+		FROM links LEFT JOIN users_new ON users_new.username = links.created_by;
+	CREATE TABLE recovery_codes_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+		user_id INTEGER NOT NULL,
+		code_hash TEXT NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO recovery_codes_new (id, user_id, code_hash)
+		SELECT recovery_codes.id, users_new.id, recovery_codes.code_hash
+		FROM recovery_codes JOIN users_new ON users_new.username = recovery_codes.username;
+	CREATE TABLE api_tokens_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+		last_used_at TIMESTAMP NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO api_tokens_new (id, user_id, name, token_hash, created_at, last_used_at)
+		SELECT api_tokens.id, users_new.id, api_tokens.name, api_tokens.token_hash, api_tokens.created_at, api_tokens.last_used_at
+		FROM api_tokens JOIN users_new ON users_new.username = api_tokens.username;
+	CREATE TABLE sessions_new (
+		token_hash TEXT PRIMARY KEY NOT NULL,
+		user_id INTEGER NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO sessions_new (token_hash, user_id, created_at, expires_at)
+		SELECT sessions.token_hash, users_new.id, sessions.created_at, sessions.expires_at
+		FROM sessions JOIN users_new ON users_new.username = sessions.username;
+	CREATE TABLE team_members_new (
+		team_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		role TEXT DEFAULT 'editor' NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+		PRIMARY KEY (team_id, user_id),
+		FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO team_members_new (team_id, user_id, role, created_at)
+		SELECT team_members.team_id, users_new.id, team_members.role, team_members.created_at
+		FROM team_members JOIN users_new ON users_new.username = team_members.username;
+	DELETE FROM sqlite_sequence WHERE name IN ('links_new', 'recovery_codes_new', 'api_tokens_new');
+	INSERT INTO sqlite_sequence (name, seq)
+		SELECT name || '_new', seq FROM sqlite_sequence WHERE name IN ('links', 'recovery_codes', 'api_tokens');
+	DROP TABLE links;
+	DROP TABLE recovery_codes;
+	DROP TABLE api_tokens;
+	DROP TABLE sessions;
+	DROP TABLE team_members;
+	DROP TABLE users;
+	ALTER TABLE users_new RENAME TO users;
+	ALTER TABLE links_new RENAME TO links;
+	ALTER TABLE recovery_codes_new RENAME TO recovery_codes;
+	ALTER TABLE api_tokens_new RENAME TO api_tokens;
+	ALTER TABLE sessions_new RENAME TO sessions;
+	ALTER TABLE team_members_new RENAME TO team_members;
+	CREATE INDEX IF NOT EXISTS links_created_by_id_idx ON links (created_by_id);
+	CREATE INDEX IF NOT EXISTS links_team_id_idx ON links (team_id);
+	CREATE INDEX IF NOT EXISTS recovery_codes_user_id_idx ON recovery_codes (user_id);
+	CREATE INDEX IF NOT EXISTS api_tokens_user_id_idx ON api_tokens (user_id);
+	CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+	CREATE INDEX IF NOT EXISTS team_members_user_id_idx ON team_members (user_id);
+	`,
+	`
+	ALTER TABLE users ADD COLUMN oidc_issuer TEXT NULL;
+	ALTER TABLE users ADD COLUMN oidc_subject TEXT NULL;
+	CREATE UNIQUE INDEX IF NOT EXISTS users_oidc_identity_idx ON users (oidc_issuer, oidc_subject);
+	`,
+	`
+	ALTER TABLE login_events ADD COLUMN user_id INTEGER NULL REFERENCES users(id) ON DELETE SET NULL;
+	UPDATE login_events SET user_id = (SELECT id FROM users WHERE users.username = login_events.username);
+	CREATE INDEX IF NOT EXISTS login_events_user_id_idx ON login_events (user_id, id);
+	`,
+}
+
 type SqliteStore struct {
 	PostgresStore
 }
+
+func sqlitePragmas(options cfg.SQLiteOptions, readOnly bool) []string {
+	var pragmas []string
+	if options.JournalMode != "" && !readOnly {
+		pragmas = append(pragmas, "PRAGMA journal_mode = "+strings.ToUpper(options.JournalMode))
+	}
+	if options.Synchronous != "" {
+		pragmas = append(pragmas, "PRAGMA synchronous = "+strings.ToUpper(options.Synchronous))
+	}
+	if options.BusyTimeout > 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA busy_timeout = %d", options.BusyTimeout.Milliseconds()))
+	}
+	if options.CacheSize != 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA cache_size = %d", options.CacheSize))
+	}
+	pragmas = append(pragmas, "PRAGMA foreign_keys = ON")
+	if readOnly {
+		pragmas = append(pragmas, "PRAGMA query_only = ON")
+	}
+	return pragmas
+}
+
+type sqliteConnector struct {
+	driver  driver.Driver
+	dsn     string
+	pragmas []string
+}
+
+func (c *sqliteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%s connections do not support ExecContext", sqliteDriverName)
+	}
+	for _, pragma := range c.pragmas {
+		if _, err = execer.ExecContext(ctx, pragma, nil); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to apply %s: %w", pragma, err)
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *sqliteConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func connectSqlite(conf *cfg.Config, readOnly bool) (*sqlx.DB, error) {
+	connector := &sqliteConnector{
+		driver:  newSqliteDriver(),
+		dsn:     sqliteDSN(conf.Database.Name),
+		pragmas: sqlitePragmas(conf.Database.SQLite, readOnly),
+	}
+	db := sqlx.NewDb(sql.OpenDB(connector), "sqlite3")
+	if readOnly {
+		db.SetMaxOpenConns(conf.Database.SQLite.MaxOpenConns)
+	} else {
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	slog.Debug("opened sqlite database", "path", conf.Database.Name, "driver", sqliteDriverName, "read_only", readOnly)
+	return db, nil
+}
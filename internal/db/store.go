@@ -2,22 +2,29 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
 
 	_ "github.com/jackc/pgx/stdlib"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/mattn/go-sqlite3"
 
 	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
 )
 
 type UserStore interface {
-	CreateUser(ctx context.Context, username string, password string) (*User, error)
+	CreateUser(ctx context.Context, username string, password string, role Role) (*User, error)
+	CreateOIDCUser(ctx context.Context, username string, password string, role Role, identity OIDCIdentity) (*User, error)
 	RetrieveAllUsers(ctx context.Context) ([]User, error)
 	RetrieveUser(ctx context.Context, username string) (*User, error)
+	RetrieveUserByOIDCIdentity(ctx context.Context, identity OIDCIdentity) (*User, error)
+	LinkOIDCIdentity(ctx context.Context, username string, identity OIDCIdentity) error
 	UpdateUsername(ctx context.Context, username, newUsername string) error
 	UpdatePassword(ctx context.Context, username, newPassword string) error
-	ToggleAdmin(ctx context.Context, username string) error
+	SetRole(ctx context.Context, username string, role Role) error
 	DeleteUser(ctx context.Context, username string) error
 }
 
@@ -29,53 +36,299 @@ type LinkStore interface {
 	DeleteLink(ctx context.Context, id uint) error
 	GetLinkCountForUser(ctx context.Context, username string) uint
 	RetrieveLinksForUser(ctx context.Context, username string, limit int, offset int) ([]Link, error)
+	CreateTeamLink(ctx context.Context, url, creatorUsername string, teamID uint) (*Link, error)
+	GetLinkCountForTeam(ctx context.Context, teamID uint) uint
+	RetrieveLinksForTeam(ctx context.Context, teamID uint, limit int, offset int) ([]Link, error)
+	TransferLink(ctx context.Context, id uint, owner LinkOwner) error
+	TransferUserLinks(ctx context.Context, username string, owner LinkOwner) (int64, error)
+}
+
+type TeamStore interface {
+	CreateTeam(ctx context.Context, name string, ownerUsername string) (*Team, error)
+	RetrieveAllTeams(ctx context.Context) ([]Team, error)
+	RetrieveTeam(ctx context.Context, name string) (*Team, error)
+	RetrieveTeamsForUser(ctx context.Context, username string) ([]Team, error)
+	DeleteTeam(ctx context.Context, id uint) error
+	SetTeamMember(ctx context.Context, teamID uint, username string, role TeamRole) error
+	RetrieveTeamMember(ctx context.Context, teamID uint, username string) (*TeamMember, error)
+	RetrieveTeamMembers(ctx context.Context, teamID uint) ([]TeamMember, error)
+	RemoveTeamMember(ctx context.Context, teamID uint, username string) error
+}
+
+type AuthStore interface {
+	RecordLoginFailure(ctx context.Context, username string, maxAttempts uint, lockout time.Duration) (bool, error)
+	RefundLoginFailure(ctx context.Context, username string) error
+	ResetLoginFailures(ctx context.Context, username string) error
+	UnlockUser(ctx context.Context, username string) error
+	CreateLoginEvent(ctx context.Context, event *LoginEvent) error
+	RetrieveLoginEvents(ctx context.Context, username string, limit int, offset int) ([]LoginEvent, error)
+	DeleteLoginEventsBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type CredentialStore interface {
+	SetTOTPSecret(ctx context.Context, username string, secret string) error
+	EnableTOTP(ctx context.Context, username string, recoveryCodeHashes []string) error
+	DisableTOTP(ctx context.Context, username string) error
+	UseRecoveryCode(ctx context.Context, username string, codeHash string) (bool, error)
+	CreateAPIToken(ctx context.Context, username string, name string, tokenHash string) (*APIToken, error)
+	RetrieveAPITokens(ctx context.Context, username string) ([]APIToken, error)
+	RetrieveAPITokenByHash(ctx context.Context, tokenHash string) (*APIToken, error)
+	DeleteAPIToken(ctx context.Context, username string, id uint) error
+	CreateSession(ctx context.Context, username string, tokenHash string, expiresAt time.Time) error
+	RetrieveSession(ctx context.Context, tokenHash string) (*Session, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+	DeleteSessionsForUser(ctx context.Context, username string) error
+	DeleteExpiredSessions(ctx context.Context) (int64, error)
 }
 
 type Store interface {
 	UserStore
 	LinkStore
+	AuthStore
+	CredentialStore
+	TeamStore
+	Ping(ctx context.Context) error
+	SchemaVersion(ctx context.Context) (uint, error)
 	Close()
 }
 
+const CurrentSchemaVersion = 8
+
+const (
+	initialConnectRetryDelay = 500 * time.Millisecond
+	maxConnectRetryDelay     = 10 * time.Second
+)
+
 func NewStore(conf *cfg.Config) (Store, error) {
+	if conf.Database.Type == "memory" {
+		store, err := NewMemoryStore(conf.Database.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		return store, nil
+	}
+
+	if conf.Database.Type == "bolt" {
+		store, err := NewBoltStore(conf.Database.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		return store, nil
+	}
+
+	db, err := connect(conf)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = db.Close()
+		}
+	}()
+
 	if conf.Database.Type == "postgresql" {
-		url := fmt.Sprintf(
-			"%s://%s:%s@%s:%d/%s",
-			conf.Database.Type,
-			conf.Database.Username,
-			conf.Database.Password,
-			conf.Database.Host,
-			conf.Database.Port,
-			conf.Database.Name,
-		)
-		if len(conf.Database.ExtraArgs) > 0 {
-			sep := '?'
-			for k, v := range conf.Database.ExtraArgs {
-				url = fmt.Sprintf("%s%c%s=%s", url, sep, k, v)
-				sep = '&'
+		if _, err = db.Exec(postgresSetupSQL); err != nil {
+			return nil, fmt.Errorf("failed to set up schema: %w", err)
+		}
+		if err = migrateSchema(db, postgresMigrations); err != nil {
+			return nil, err
+		}
+
+		store := &PostgresStore{db: db, reader: db}
+		if len(conf.Database.Replicas) > 0 {
+			if store.replicas, err = openReplicas(conf); err != nil {
+				return nil, err
 			}
 		}
 
-		db, err := sqlx.Connect("pgx", url)
-		if err != nil {
+		return store, nil
+	}
+
+	if conf.Database.Type == "mysql" {
+		if _, err = db.Exec(mysqlSetupSQL); err != nil {
+			return nil, fmt.Errorf("failed to set up schema: %w", err)
+		}
+		if err = migrateSchema(db, mysqlMigrations); err != nil {
 			return nil, err
 		}
 
-		db.MustExec(postgresSetupSQL)
+		return &MysqlStore{PostgresStore{db: db, reader: db}}, nil
+	}
+
+	if _, err = db.Exec(sqliteSetupSQL); err != nil {
+		return nil, fmt.Errorf("failed to set up schema: %w", err)
+	}
+	if err = migrateSqliteSchema(db); err != nil {
+		return nil, err
+	}
+
+	reader, err := connectSqlite(conf, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SqliteStore{PostgresStore{db: db, reader: reader}}, nil
+}
+
+func migrateSchema(db *sqlx.DB, migrations []string) error {
+	if _, err := db.Exec("INSERT INTO schema_version (version) SELECT 1 WHERE NOT EXISTS (SELECT 1 FROM schema_version)"); err != nil {
+		return fmt.Errorf("failed to initialize schema version: %w", err)
+	}
+
+	var version uint
+	if err := db.Get(&version, "SELECT max(version) FROM schema_version"); err != nil {
+		return fmt.Errorf("failed to retrieve schema version: %w", err)
+	}
+
+	for ; version < CurrentSchemaVersion; version++ {
+		tx, err := db.Beginx()
+		if err != nil {
+			return fmt.Errorf("failed to start migration: %w", err)
+		}
+
+		if _, err = tx.Exec(migrations[version-1]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to migrate schema to version %d: %w", version+1, err)
+		}
+
+		if _, err = tx.Exec(tx.Rebind("UPDATE schema_version SET version = ?"), version+1); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to migrate schema to version %d: %w", version+1, err)
+		}
 
-		return &PostgresStore{db}, nil
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("failed to migrate schema to version %d: %w", version+1, err)
+		}
+	}
+
+	return nil
+}
+
+func migrateSqliteSchema(db *sqlx.DB) error {
+	db.MustExec("PRAGMA foreign_keys = OFF")
+	defer db.MustExec("PRAGMA foreign_keys = ON")
+
+	if err := migrateSchema(db, sqliteMigrations); err != nil {
+		return err
+	}
+
+	var violations []struct {
+		Table  string `db:"table"`
+		RowID  *int64 `db:"rowid"`
+		Parent string `db:"parent"`
+		FKID   int    `db:"fkid"`
+	}
+	if err := db.Select(&violations, "PRAGMA foreign_key_check"); err != nil {
+		return fmt.Errorf("failed to check foreign keys: %w", err)
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("foreign key violation in table %s referencing %s", violations[0].Table, violations[0].Parent)
+	}
+
+	return nil
+}
+
+func CheckConnection(ctx context.Context, conf *cfg.Config) error {
+	if conf.Database.Type == "memory" || conf.Database.Type == "bolt" {
+		if conf.Database.Name != "" {
+			dir := filepath.Dir(conf.Database.Name)
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				return fmt.Errorf("directory %s does not exist", dir)
+			}
+		}
+		return nil
 	}
 
 	if conf.Database.Type == "sqlite3" {
-		db, err := sqlx.Connect("sqlite3", conf.Database.Name)
+		if _, err := os.Stat(conf.Database.Name); errors.Is(err, os.ErrNotExist) {
+			dir := filepath.Dir(conf.Database.Name)
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				return fmt.Errorf("directory %s does not exist", dir)
+			}
+			return nil
+		}
+	}
+
+	db, err := connect(conf)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	return db.PingContext(ctx)
+}
+
+func connect(conf *cfg.Config) (*sqlx.DB, error) {
+	if conf.Database.Type == "postgresql" {
+		dsn, err := postgresDSN(conf, conf.Database.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		db, err := sqlx.Connect("pgx", dsn)
 		if err != nil {
 			return nil, err
 		}
+		configurePool(db, conf)
+
+		return db, nil
+	}
 
-		db.MustExec(sqliteSetupSQL)
+	if conf.Database.Type == "mysql" {
+		dsn, err := mysqlDSN(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		db, err := sqlx.Connect("mysql", dsn)
+		if err != nil {
+			return nil, err
+		}
+		configurePool(db, conf)
+
+		return db, nil
+	}
 
-		return &SqliteStore{PostgresStore{db}}, nil
+	if conf.Database.Type == "sqlite3" {
+		return connectSqlite(conf, false)
 	}
 
 	return nil, fmt.Errorf("unsupported database type '%s'", conf.Database.Type)
 }
+
+func WaitForDatabase(ctx context.Context, conf *cfg.Config) error {
+	if conf.Database.Type != "postgresql" && conf.Database.Type != "mysql" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, conf.Database.ConnectTimeout)
+	defer cancel()
+
+	delay := initialConnectRetryDelay
+	for {
+		err := CheckConnection(ctx, conf)
+		if err == nil {
+			return nil
+		}
+
+		slog.Warn("failed to connect to database, retrying", "error", err, "retry_in", delay.String())
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay = min(delay*2, maxConnectRetryDelay)
+	}
+}
+
+func configurePool(db *sqlx.DB, conf *cfg.Config) {
+	db.SetMaxOpenConns(conf.Database.MaxOpenConns)
+	if conf.Database.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(conf.Database.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(conf.Database.ConnMaxLifetime)
+}
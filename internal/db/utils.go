@@ -1,15 +1,24 @@
 package db
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
 	"errors"
 	"regexp"
+	"strings"
 	"unicode"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+const APITokenPrefix = "sls_"
+
 var validUsernameCharsRE = regexp.MustCompile("^[a-zA-Z0-9_]+$")
 
+var tokenEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
 func CheckUsernameValidity(username string) error {
 	if len(username) < 3 {
 		return errors.New("username is too short (minimum length: 3)")
@@ -26,6 +35,22 @@ func CheckUsernameValidity(username string) error {
 	return nil
 }
 
+func CheckTeamNameValidity(name string) error {
+	if len(name) < 3 {
+		return errors.New("team name is too short (minimum length: 3)")
+	}
+
+	if len(name) > 32 {
+		return errors.New("team name is too long (maximum length: 32)")
+	}
+
+	if !validUsernameCharsRE.MatchString(name) {
+		return errors.New("team name must only contain letters, numbers, and underscores")
+	}
+
+	return nil
+}
+
 func CheckPasswordStrengthValidity(password string) error {
 	if len(password) < 6 {
 		return errors.New("password is too short (minimum length: 6)")
@@ -60,3 +85,36 @@ func VerifyPassword(hashedPassword, inputPassword string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(inputPassword))
 	return err == nil
 }
+
+func GenerateToken(prefix string) (string, string) {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	token := prefix + strings.ToLower(tokenEncoding.EncodeToString(b))
+	return token, HashToken(token)
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func GenerateRecoveryCodes(count int) ([]string, []string) {
+	codes := make([]string, count)
+	hashes := make([]string, count)
+	for i := range codes {
+		b := make([]byte, 7)
+		_, _ = rand.Read(b)
+		code := strings.ToLower(tokenEncoding.EncodeToString(b))
+		codes[i] = code[:5] + "-" + code[5:10]
+		hashes[i] = HashToken(codes[i])
+	}
+	return codes, hashes
+}
+
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	if len(code) != 10 {
+		return code
+	}
+	return code[:5] + "-" + code[5:]
+}
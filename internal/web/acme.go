@@ -0,0 +1,56 @@
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+)
+
+func newACMEManager(conf *cfg.Config) (*autocert.Manager, error) {
+	httpClient := http.DefaultClient
+	if conf.Server.ACMERootCA != "" {
+		data, err := os.ReadFile(conf.Server.ACMERootCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read acme root ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", conf.Server.ACMERootCA)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		httpClient = &http.Client{Transport: transport}
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(conf.Server.ACMECacheDir),
+		HostPolicy: autocert.HostWhitelist(conf.Server.ACMEHosts...),
+		Email:      conf.Server.ACMEEmail,
+		Client: &acme.Client{
+			DirectoryURL: conf.Server.ACMEDirectoryURL,
+			HTTPClient:   httpClient,
+		},
+	}, nil
+}
+
+func redirectToHTTPS(conf *cfg.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if conf.Server.Port != 443 {
+			host = net.JoinHostPort(host, fmt.Sprint(conf.Server.Port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,453 @@
+package web
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+)
+
+const testACMEHost = "shortener.test"
+
+type stubACME struct {
+	server        *httptest.Server
+	caCert        *x509.Certificate
+	caKey         *ecdsa.PrivateKey
+	challengeAddr string
+
+	mu         sync.Mutex
+	nonce      int
+	thumbprint string
+	validated  bool
+	chain      []byte
+}
+
+func newStubACME(t *testing.T, challengePort uint16) *stubACME {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "stub acme ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca := &stubACME{
+		caCert:        caCert,
+		caKey:         caKey,
+		challengeAddr: fmt.Sprintf("127.0.0.1:%d", challengePort),
+	}
+	ca.server = httptest.NewTLSServer(http.HandlerFunc(ca.serveHTTP))
+	t.Cleanup(ca.server.Close)
+	return ca
+}
+
+func (ca *stubACME) writeRootCA(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "acme-root.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.server.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func (ca *stubACME) clientPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.caCert)
+	return pool
+}
+
+func (ca *stubACME) isValidated() bool {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.validated
+}
+
+func (ca *stubACME) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	ca.nonce++
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", ca.nonce))
+	ca.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/directory":
+		writeACMEJSON(w, http.StatusOK, map[string]string{
+			"newNonce":   ca.server.URL + "/new-nonce",
+			"newAccount": ca.server.URL + "/new-account",
+			"newOrder":   ca.server.URL + "/new-order",
+			"revokeCert": ca.server.URL + "/revoke-cert",
+			"keyChange":  ca.server.URL + "/key-change",
+		})
+		return
+	case "/new-nonce":
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/new-account":
+		if err = ca.registerAccount(jws.Protected); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Location", ca.server.URL+"/account/1")
+		writeACMEJSON(w, http.StatusCreated, map[string]string{"status": "valid"})
+	case "/new-order":
+		w.Header().Set("Location", ca.server.URL+"/order/1")
+		writeACMEJSON(w, http.StatusCreated, ca.order())
+	case "/order/1", "/finalize/1":
+		if r.URL.Path == "/finalize/1" {
+			if err = ca.issue(payload); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		writeACMEJSON(w, http.StatusOK, ca.order())
+	case "/authz/1":
+		writeACMEJSON(w, http.StatusOK, ca.authorization())
+	case "/challenge/1":
+		if len(payload) > 0 {
+			ca.validate()
+		}
+		writeACMEJSON(w, http.StatusOK, ca.challenge())
+	case "/certificate/1":
+		ca.mu.Lock()
+		chain := ca.chain
+		ca.mu.Unlock()
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_, _ = w.Write(chain)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (ca *stubACME) registerAccount(protected string) error {
+	data, err := base64.RawURLEncoding.DecodeString(protected)
+	if err != nil {
+		return err
+	}
+	var header struct {
+		JWK struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"jwk"`
+	}
+	if err = json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	if header.JWK.Kty != "EC" {
+		return fmt.Errorf("unexpected account key type %q", header.JWK.Kty)
+	}
+
+	canonical := fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, header.JWK.Crv, header.JWK.X, header.JWK.Y)
+	sum := sha256.Sum256([]byte(canonical))
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.thumbprint = base64.RawURLEncoding.EncodeToString(sum[:])
+	return nil
+}
+
+func (ca *stubACME) validate() {
+	ca.mu.Lock()
+	thumbprint := ca.thumbprint
+	ca.mu.Unlock()
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+ca.challengeAddr+"/.well-known/acme-challenge/token-1", nil)
+	if err != nil {
+		return
+	}
+	req.Host = testACMEHost
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+
+	if res.StatusCode == http.StatusOK && string(body) == "token-1."+thumbprint {
+		ca.mu.Lock()
+		ca.validated = true
+		ca.mu.Unlock()
+	}
+}
+
+func (ca *stubACME) issue(payload []byte) error {
+	var request struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return err
+	}
+	der, err := base64.RawURLEncoding.DecodeString(request.CSR)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return err
+	}
+	if !ca.isValidated() {
+		return errors.New("order is not ready")
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: testACMEHost},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, template, ca.caCert, csr.PublicKey, ca.caKey)
+	if err != nil {
+		return err
+	}
+
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf})
+	chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.caCert.Raw})...)
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.chain = chain
+	return nil
+}
+
+func (ca *stubACME) order() map[string]any {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	order := map[string]any{
+		"status":         "pending",
+		"identifiers":    []map[string]string{{"type": "dns", "value": testACMEHost}},
+		"authorizations": []string{ca.server.URL + "/authz/1"},
+		"finalize":       ca.server.URL + "/finalize/1",
+	}
+	if ca.chain != nil {
+		order["status"] = "valid"
+		order["certificate"] = ca.server.URL + "/certificate/1"
+	} else if ca.validated {
+		order["status"] = "ready"
+	}
+	return order
+}
+
+func (ca *stubACME) challenge() map[string]string {
+	status := "pending"
+	if ca.isValidated() {
+		status = "valid"
+	}
+	return map[string]string{
+		"type":   "http-01",
+		"url":    ca.server.URL + "/challenge/1",
+		"token":  "token-1",
+		"status": status,
+	}
+}
+
+func (ca *stubACME) authorization() map[string]any {
+	challenge := ca.challenge()
+	return map[string]any{
+		"status":     challenge["status"],
+		"identifier": map[string]string{"type": "dns", "value": testACMEHost},
+		"challenges": []map[string]string{challenge},
+	}
+}
+
+func writeACMEJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func freePort(t *testing.T) uint16 {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return uint16(l.Addr().(*net.TCPAddr).Port)
+}
+
+func expectPortReleased(t *testing.T, port uint16) {
+	t.Helper()
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Errorf("expected port %d to be released: %v", port, err)
+		return
+	}
+	_ = l.Close()
+}
+
+func newACMETestServer(t *testing.T, ca *stubACME, httpsPort, challengePort uint16) *testServer {
+	t.Helper()
+	rootCA := ca.writeRootCA(t)
+	return newTestServer(t, func(conf *cfg.Config) {
+		conf.Server.Port = httpsPort
+		conf.Server.UseTLS = true
+		conf.Server.UseACME = true
+		conf.Server.ACMEDirectoryURL = ca.server.URL + "/directory"
+		conf.Server.ACMERootCA = rootCA
+		conf.Server.ACMECacheDir = t.TempDir()
+		conf.Server.ACMEHosts = []string{testACMEHost}
+		conf.Server.ACMEHTTPPort = challengePort
+	})
+}
+
+func TestACMEServe(t *testing.T) {
+	httpsPort, challengePort := freePort(t), freePort(t)
+	ca := newStubACME(t, challengePort)
+	ts := newACMETestServer(t, ca, httpsPort, challengePort)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- ts.server.Serve() }()
+
+	noRedirect := &http.Client{
+		Timeout:       time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/abc?x=1", challengePort), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = testACMEHost
+
+	var res *http.Response
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if res, err = noRedirect.Do(req); err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("http-01 listener did not start: %v", err)
+	}
+	_ = res.Body.Close()
+	expected := fmt.Sprintf("https://%s:%d/abc?x=1", testACMEHost, httpsPort)
+	if res.StatusCode != http.StatusMovedPermanently || res.Header.Get("Location") != expected {
+		t.Fatalf("expected a redirect to %s, got %d %q", expected, res.StatusCode, res.Header.Get("Location"))
+	}
+
+	httpsAddr := fmt.Sprintf("127.0.0.1:%d", httpsPort)
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: ca.clientPool()},
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, httpsAddr)
+			},
+		},
+	}
+	res, err = client.Get(fmt.Sprintf("https://%s:%d/healthz", testACMEHost, httpsPort))
+	if err != nil {
+		t.Fatalf("https request failed: %v", err)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 over https, got %d", res.StatusCode)
+	}
+	if !ca.isValidated() {
+		t.Error("expected the certificate to be issued through the http-01 challenge")
+	}
+	if leaf := res.TLS.PeerCertificates[0]; leaf.Issuer.CommonName != ca.caCert.Subject.CommonName {
+		t.Errorf("expected a certificate issued by the stub ca, got %q", leaf.Issuer.CommonName)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = ts.server.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	select {
+	case err = <-errCh:
+		if err != nil {
+			t.Errorf("expected serve to return nil after shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after shutdown")
+	}
+	expectPortReleased(t, httpsPort)
+	expectPortReleased(t, challengePort)
+}
+
+func TestACMEServeFailure(t *testing.T) {
+	httpsPort := freePort(t)
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer occupied.Close()
+	challengePort := uint16(occupied.Addr().(*net.TCPAddr).Port)
+
+	ca := newStubACME(t, challengePort)
+	ts := newACMETestServer(t, ca, httpsPort, challengePort)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- ts.server.Serve() }()
+
+	select {
+	case err = <-errCh:
+		if err == nil || !strings.Contains(err.Error(), "address already in use") {
+			t.Errorf("expected serve to fail on the occupied http-01 port, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not fail on the occupied http-01 port")
+	}
+	expectPortReleased(t, httpsPort)
+}
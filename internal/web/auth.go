@@ -0,0 +1,313 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+	"github.com/salmanmorshed/simplelinkshortener/internal/db"
+)
+
+const sessionCookieName = "sls_session"
+
+type Authenticator struct {
+	conf    *atomic.Pointer[cfg.Config]
+	store   db.Store
+	metrics *Metrics
+	limiter *RateLimiter
+}
+
+func NewAuthenticator(conf *atomic.Pointer[cfg.Config], store db.Store, metrics *Metrics, limiter *RateLimiter) *Authenticator {
+	return &Authenticator{conf, store, metrics, limiter}
+}
+
+func (a *Authenticator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if sessionToken, err := c.Cookie(sessionCookieName); err == nil && sessionToken != "" {
+			if user := a.sessionUser(c, sessionToken); user != nil {
+				c.Set("user", user)
+				c.Next()
+				return
+			}
+		}
+
+		username, password, hasAuth := c.Request.BasicAuth()
+
+		if !hasAuth {
+			c.Header("WWW-Authenticate", `Basic realm="Restricted"`)
+			abortWithError(c, http.StatusUnauthorized, "missing authentication credentials")
+			return
+		}
+
+		if ok, retryAfter := a.limiter.TakeAuth(c, username); !ok {
+			abortWithTooManyRequests(c, retryAfter)
+			return
+		}
+
+		user, err := a.store.RetrieveUser(c, username)
+		if err != nil {
+			a.rejectBasic(c, nil, username, "basic", "unknown_user", "incorrect username and/or password")
+			return
+		}
+
+		if user.IsLocked() {
+			a.rejectBasic(c, nil, username, "basic", "locked", "account is temporarily locked")
+			return
+		}
+
+		if strings.HasPrefix(password, db.APITokenPrefix) {
+			if !a.verifyAPIToken(c, user, password) {
+				a.rejectBasic(c, user, username, "token", "bad_token", "incorrect username and/or api token")
+				return
+			}
+			a.limiter.RefundAuth(c, username)
+			a.accept(c, user, "token")
+		} else if user.TOTPEnabled {
+			a.rejectBasic(c, nil, username, "basic", "token_required", "an api token is required for accounts with two-factor authentication")
+			return
+		} else {
+			if !a.reserveAttempt(c, user) {
+				a.rejectBasic(c, nil, username, "basic", "locked", "account is temporarily locked")
+				return
+			}
+			if !db.VerifyPassword(user.Password, password) {
+				a.rejectBasic(c, nil, username, "basic", "bad_password", "incorrect username and/or password")
+				return
+			}
+			a.limiter.RefundAuth(c, username)
+			a.accept(c, user, "basic")
+		}
+
+		c.Set("user", user)
+
+		c.Next()
+	}
+}
+
+func (a *Authenticator) Login() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var data struct {
+			Username string `json:"username" binding:"required"`
+			Password string `json:"password" binding:"required"`
+			Code     string `json:"code"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			abortWithError(c, http.StatusBadRequest, "missing required fields")
+			return
+		}
+
+		if ok, retryAfter := a.limiter.TakeAuth(c, data.Username); !ok {
+			abortWithTooManyRequests(c, retryAfter)
+			return
+		}
+
+		user, err := a.store.RetrieveUser(c, data.Username)
+		if err != nil {
+			a.reject(c, nil, data.Username, "session", "unknown_user", "incorrect username and/or password")
+			return
+		}
+
+		if user.IsLocked() {
+			a.reject(c, nil, data.Username, "session", "locked", "account is temporarily locked")
+			return
+		}
+
+		if !a.reserveAttempt(c, user) {
+			a.reject(c, nil, data.Username, "session", "locked", "account is temporarily locked")
+			return
+		}
+
+		if !db.VerifyPassword(user.Password, data.Password) {
+			a.reject(c, nil, data.Username, "session", "bad_password", "incorrect username and/or password")
+			return
+		}
+
+		if user.TOTPEnabled {
+			if data.Code == "" {
+				a.limiter.RefundAuth(c, data.Username)
+				a.refundAttempt(c, user)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error":               "two-factor authentication code required",
+					"two_factor_required": true,
+					"request_id":          c.GetString("request_id"),
+				})
+				return
+			}
+			if !a.verifySecondFactor(c, user, data.Code) {
+				a.reject(c, nil, data.Username, "session", "bad_totp", "incorrect two-factor authentication code")
+				return
+			}
+		}
+
+		a.limiter.RefundAuth(c, data.Username)
+
+		expiresAt, err := a.startSession(c, user, "session")
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"username":   user.Username,
+			"role":       user.Role,
+			"expires_at": expiresAt.UTC(),
+		})
+	}
+}
+
+func (a *Authenticator) Logout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if sessionToken, err := c.Cookie(sessionCookieName); err == nil && sessionToken != "" {
+			if err := a.store.DeleteSession(c, db.HashToken(sessionToken)); err != nil {
+				abortWithError(c, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+
+		a.setSessionCookie(c, "", -1)
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+func (a *Authenticator) RedirectUnauthenticated(loginPath string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			sessionToken, _ := c.Cookie(sessionCookieName)
+			if sessionToken == "" || a.sessionUser(c, sessionToken) == nil {
+				c.Redirect(http.StatusFound, GetBaseURL(a.conf.Load())+loginPath)
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+func (a *Authenticator) startSession(c *gin.Context, user *db.User, method string) (time.Time, error) {
+	sessionToken, sessionHash := db.GenerateToken("")
+	lifetime := a.conf.Load().Auth.SessionLifetime
+	expiresAt := time.Now().Add(lifetime)
+	if err := a.store.CreateSession(c, user.Username, sessionHash, expiresAt); err != nil {
+		return time.Time{}, err
+	}
+
+	a.accept(c, user, method)
+	a.setSessionCookie(c, sessionToken, int(lifetime.Seconds()))
+	return expiresAt, nil
+}
+
+func (a *Authenticator) sessionUser(c *gin.Context, sessionToken string) *db.User {
+	session, err := a.store.RetrieveSession(c, db.HashToken(sessionToken))
+	if err != nil {
+		return nil
+	}
+
+	user, err := a.store.RetrieveUser(c, session.Username)
+	if err != nil || user.IsLocked() {
+		return nil
+	}
+
+	return user
+}
+
+func (a *Authenticator) verifyAPIToken(c *gin.Context, user *db.User, token string) bool {
+	apiToken, err := a.store.RetrieveAPITokenByHash(c, db.HashToken(token))
+	return err == nil && apiToken.UserID == user.ID
+}
+
+func (a *Authenticator) verifySecondFactor(c *gin.Context, user *db.User, code string) bool {
+	code = strings.TrimSpace(code)
+	if totp.Validate(code, user.TOTPSecret) {
+		return true
+	}
+
+	used, err := a.store.UseRecoveryCode(c, user.Username, db.HashToken(db.NormalizeRecoveryCode(code)))
+	if err != nil {
+		slog.Warn(err.Error(), "user", user.Username)
+	}
+	return used
+}
+
+func (a *Authenticator) reserveAttempt(c *gin.Context, user *db.User) bool {
+	auth := a.conf.Load().Auth
+	locked, err := a.store.RecordLoginFailure(c, user.Username, auth.MaxFailedAttempts, auth.LockoutDuration)
+	if err != nil {
+		slog.Warn(err.Error(), "user", user.Username)
+	}
+	if locked {
+		return false
+	}
+	if auth.MaxFailedAttempts > 0 && auth.LockoutDuration > 0 {
+		user.FailedAttempts++
+	}
+	return true
+}
+
+func (a *Authenticator) refundAttempt(c *gin.Context, user *db.User) {
+	auth := a.conf.Load().Auth
+	if auth.MaxFailedAttempts == 0 || auth.LockoutDuration <= 0 {
+		return
+	}
+	if err := a.store.RefundLoginFailure(c, user.Username); err != nil {
+		slog.Warn(err.Error(), "user", user.Username)
+	}
+	user.FailedAttempts--
+}
+
+func (a *Authenticator) accept(c *gin.Context, user *db.User, method string) {
+	if user.FailedAttempts > 0 {
+		if err := a.store.ResetLoginFailures(c, user.Username); err != nil {
+			slog.Warn(err.Error(), "user", user.Username)
+		}
+	}
+	a.recordLoginEvent(c, user.Username, method, true, "")
+}
+
+func (a *Authenticator) rejectBasic(c *gin.Context, user *db.User, username, method, reason, message string) {
+	c.Header("WWW-Authenticate", `Basic realm="Restricted"`)
+	a.reject(c, user, username, method, reason, message)
+}
+
+func (a *Authenticator) reject(c *gin.Context, user *db.User, username, method, reason, message string) {
+	a.metrics.AuthFailure()
+
+	if user != nil {
+		auth := a.conf.Load().Auth
+		if _, err := a.store.RecordLoginFailure(c, username, auth.MaxFailedAttempts, auth.LockoutDuration); err != nil {
+			slog.Warn(err.Error(), "user", username)
+		}
+	}
+
+	a.recordLoginEvent(c, username, method, false, reason)
+	abortWithError(c, http.StatusUnauthorized, message)
+}
+
+func (a *Authenticator) recordLoginEvent(c *gin.Context, username, method string, success bool, reason string) {
+	event := db.LoginEvent{
+		Username:  username,
+		Success:   success,
+		Method:    method,
+		Reason:    reason,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if err := a.store.CreateLoginEvent(c, &event); err != nil {
+		slog.Warn(err.Error(), "user", username)
+	}
+}
+
+func (a *Authenticator) setSessionCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookieName, value, maxAge, "/", "", isSecureDeployment(a.conf.Load()), true)
+}
+
+func isSecureDeployment(conf *cfg.Config) bool {
+	return conf.Server.UseTLS || strings.HasPrefix(conf.URLPrefix, "https://")
+}
@@ -3,7 +3,9 @@ package web
 import (
 	"container/list"
 	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/salmanmorshed/simplelinkshortener/internal/db"
@@ -31,6 +33,23 @@ type Cache struct {
 
 	lookupCh chan cacheLookup
 	evictCh  chan struct{}
+	resizeCh chan uint
+	pingCh   chan chan struct{}
+	done     <-chan struct{}
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+	size      atomic.Int64
+	pending   atomic.Int64
+}
+
+type CacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Evictions     uint64
+	Size          int64
+	PendingVisits int64
 }
 
 type cacheLookup struct {
@@ -53,10 +72,12 @@ func NewCacheContext(ctx context.Context, capacity uint, resolver ResolveFunc, c
 		lruList:  list.New(),
 		lookupCh: make(chan cacheLookup),
 		evictCh:  make(chan struct{}, capacity),
+		resizeCh: make(chan uint),
+		pingCh:   make(chan chan struct{}),
+		done:     ctx.Done(),
 	}
 
-	intervalSeconds := LinearMapping(int(capacity), 1, 1000, 60, 300)
-	coherenceTicker := time.NewTicker(time.Duration(intervalSeconds) * time.Second)
+	coherenceTicker := time.NewTicker(coherenceInterval(capacity))
 
 	CacheWaitGroup.Add(1)
 	go func() {
@@ -71,6 +92,14 @@ func NewCacheContext(ctx context.Context, capacity uint, resolver ResolveFunc, c
 			case <-c.evictCh:
 				c.evictOldPages()
 
+			case pong := <-c.pingCh:
+				close(pong)
+
+			case capacity := <-c.resizeCh:
+				c.capacity = capacity
+				coherenceTicker.Reset(coherenceInterval(capacity))
+				c.evictOldPages()
+
 			case <-ctx.Done():
 				coherenceTicker.Stop()
 				c.syncAllPages()
@@ -83,6 +112,36 @@ func NewCacheContext(ctx context.Context, capacity uint, resolver ResolveFunc, c
 	return &c
 }
 
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Evictions:     c.evictions.Load(),
+		Size:          c.size.Load(),
+		PendingVisits: c.pending.Load(),
+	}
+}
+
+func (c *Cache) Ping(ctx context.Context) error {
+	pong := make(chan struct{})
+	select {
+	case c.pingCh <- pong:
+		<-pong
+		return nil
+	case <-c.done:
+		return errors.New("cache is stopped")
+	case <-ctx.Done():
+		return errors.New("cache is not responding")
+	}
+}
+
+func (c *Cache) Resize(capacity uint) {
+	select {
+	case c.resizeCh <- capacity:
+	case <-c.done:
+	}
+}
+
 func (c *Cache) Lookup(ctx context.Context, key string) (string, error) {
 	lookup := cacheLookup{key, ctx, make(chan cacheResult)}
 	c.lookupCh <- lookup
@@ -94,11 +153,15 @@ func (c *Cache) handleLookup(lookup cacheLookup) {
 	if page, exists := c.backing[lookup.key]; exists && page != nil {
 		c.lruList.MoveToFront(page.lruMarker)
 		page.NewVisits += 1
+		c.hits.Add(1)
+		c.pending.Add(1)
 		lookup.done <- cacheResult{page.LinkURL, nil}
 		close(lookup.done)
 		return
 	}
 
+	c.misses.Add(1)
+
 	link, err := c.resolver(lookup.ctx, lookup.key)
 	if err != nil {
 		lookup.done <- cacheResult{"", err}
@@ -112,27 +175,46 @@ func (c *Cache) handleLookup(lookup cacheLookup) {
 		NewVisits: 1,
 		lruMarker: c.lruList.PushBack(lookup.key),
 	}
+	c.size.Store(int64(len(c.backing)))
+	c.pending.Add(1)
 	lookup.done <- cacheResult{link.URL, nil}
 	close(lookup.done)
-	c.evictCh <- struct{}{}
+	select {
+	case c.evictCh <- struct{}{}:
+	default:
+	}
 }
 
 func (c *Cache) syncAllPages() {
 	for _, page := range c.backing {
-		c.coherer(page)
+		c.coherePage(page)
 	}
 }
 
+func (c *Cache) coherePage(page *Page) {
+	before := page.NewVisits
+	c.coherer(page)
+	c.pending.Add(int64(page.NewVisits) - int64(before))
+}
+
 func (c *Cache) evictOldPages() {
 	excess := c.lruList.Len() - int(c.capacity)
 	for range excess {
 		el := c.lruList.Back()
 		key := el.Value.(string)
 		page := c.backing[key]
-		c.coherer(page)
+		c.coherePage(page)
 		delete(c.backing, key)
 		c.lruList.Remove(el)
+		c.evictions.Add(1)
+		c.pending.Add(-int64(page.NewVisits))
 	}
+	c.size.Store(int64(len(c.backing)))
+}
+
+func coherenceInterval(capacity uint) time.Duration {
+	intervalSeconds := LinearMapping(int(capacity), 1, 1000, 60, 300)
+	return time.Duration(intervalSeconds) * time.Second
 }
 
 func (c *Cache) Close() {
@@ -0,0 +1,66 @@
+package web
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/db"
+)
+
+type ReadYourWrites struct {
+	window time.Duration
+	mu     sync.Mutex
+	writes map[string]time.Time
+}
+
+func NewReadYourWrites(window time.Duration) *ReadYourWrites {
+	return &ReadYourWrites{window: window, writes: make(map[string]time.Time)}
+}
+
+func (r *ReadYourWrites) Middleware() gin.HandlerFunc {
+	if r == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		user, ok := c.MustGet("user").(*db.User)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		if r.wroteRecently(user.Username) {
+			c.Request = c.Request.WithContext(db.WithPrimary(c.Request.Context()))
+		}
+
+		c.Next()
+
+		if c.Request.Method != http.MethodGet && c.Writer.Status() < http.StatusBadRequest {
+			r.record(user.Username)
+		}
+	}
+}
+
+func (r *ReadYourWrites) wroteRecently(username string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	at, ok := r.writes[username]
+	return ok && time.Since(at) < r.window
+}
+
+func (r *ReadYourWrites) record(username string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for name, at := range r.writes {
+		if now.Sub(at) >= r.window {
+			delete(r.writes, name)
+		}
+	}
+	r.writes[username] = now
+}
@@ -1,12 +1,20 @@
 package web
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"image/png"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
 	"github.com/salmanmorshed/intstrcodec"
 
 	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
@@ -14,24 +22,28 @@ import (
 )
 
 type Handler struct {
-	Conf  *cfg.Config
+	Conf  *atomic.Pointer[cfg.Config]
 	Store db.Store
 	Codec *intstrcodec.Codec
+
+	cache   *Cache
+	metrics *Metrics
 }
 
 func (h *Handler) OpenHomePage() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if h.Conf.HomeRedirect == "" {
+		homeRedirect := h.Conf.Load().HomeRedirect
+		if homeRedirect == "" {
 			c.String(http.StatusNotFound, "Page not found")
 			return
 		}
 
-		c.Redirect(http.StatusFound, h.Conf.HomeRedirect)
+		c.Redirect(http.StatusFound, homeRedirect)
 	}
 }
 
 func (h *Handler) OpenShortLink(globalCtx context.Context) gin.HandlerFunc {
-	if !h.Conf.Server.UseCache {
+	if !h.Conf.Load().Server.UseCache {
 		return func(c *gin.Context) {
 			encodedID := c.Param("id")
 			if IsBadLinkID(encodedID) {
@@ -55,9 +67,9 @@ func (h *Handler) OpenShortLink(globalCtx context.Context) gin.HandlerFunc {
 		}
 	}
 
-	cache := NewCacheContext(
+	h.cache = NewCacheContext(
 		globalCtx,
-		h.Conf.Server.CacheCapacity,
+		h.Conf.Load().Server.CacheCapacity,
 		func(ctx context.Context, key string) (*db.Link, error) {
 			decodedID := h.Codec.Decode(key)
 			if decodedID <= 0 {
@@ -72,11 +84,10 @@ func (h *Handler) OpenShortLink(globalCtx context.Context) gin.HandlerFunc {
 			return link, nil
 		},
 		func(page *Page) {
-			if err := h.Store.IncrementVisits(globalCtx, page.LinkID, page.NewVisits); err == nil {
-				page.NewVisits = 0
-			}
+			h.flushVisits(context.WithoutCancel(globalCtx), page)
 		},
 	)
+	h.metrics.RegisterCache(h.cache)
 
 	return func(c *gin.Context) {
 		encodedID := c.Param("id")
@@ -85,7 +96,7 @@ func (h *Handler) OpenShortLink(globalCtx context.Context) gin.HandlerFunc {
 			return
 		}
 
-		url, err := cache.Lookup(c.Request.Context(), encodedID)
+		url, err := h.cache.Lookup(c.Request.Context(), encodedID)
 		if err != nil {
 			c.String(http.StatusNotFound, "Link not found")
 			return
@@ -96,52 +107,140 @@ func (h *Handler) OpenShortLink(globalCtx context.Context) gin.HandlerFunc {
 
 }
 
+func (h *Handler) flushVisits(ctx context.Context, page *Page) {
+	if timeout := h.Conf.Load().Database.QueryTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := h.Store.IncrementVisits(ctx, page.LinkID, page.NewVisits)
+	h.metrics.ObserveFlush(time.Since(start), err)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		slog.Warn("visit flush timed out, dropping visits", "link_id", page.LinkID, "visits", page.NewVisits)
+		page.NewVisits = 0
+		return
+	}
+	if err == nil {
+		page.NewVisits = 0
+	}
+}
+
 func (h *Handler) APIVersion() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"version": cfg.Version})
 	}
 }
 
+func (h *Handler) Healthz() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+func (h *Handler) Readyz() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+		defer cancel()
+
+		ready := true
+		checks := gin.H{}
+
+		if err := h.Store.Ping(ctx); err != nil {
+			ready = false
+			checks["database"] = err.Error()
+		} else {
+			checks["database"] = "ok"
+		}
+
+		if version, err := h.Store.SchemaVersion(ctx); err != nil {
+			ready = false
+			checks["schema"] = err.Error()
+		} else if version != db.CurrentSchemaVersion {
+			ready = false
+			checks["schema"] = fmt.Sprintf("version %d, expected %d", version, db.CurrentSchemaVersion)
+		} else {
+			checks["schema"] = "ok"
+		}
+
+		if h.cache != nil {
+			if err := h.cache.Ping(ctx); err != nil {
+				ready = false
+				checks["cache"] = err.Error()
+			} else {
+				checks["cache"] = "ok"
+			}
+		}
+
+		if !ready {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": checks})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "checks": checks})
+	}
+}
+
 func (h *Handler) LinkList() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user := c.MustGet("user").(*db.User)
 
-		totalLinkCount := h.Store.GetLinkCountForUser(c, user.Username)
+		var team *db.Team
+		owner := c.DefaultQuery("created_by", user.Username)
+		if teamName := c.Query("team"); teamName != "" {
+			var canView bool
+			team, _, canView = h.teamAccess(c, user, teamName)
+			if !canView {
+				abortWithError(c, http.StatusNotFound, "team not found")
+				return
+			}
+		} else if owner != user.Username && !user.Can(db.PermissionModerateLinks) {
+			abortWithError(c, http.StatusForbidden, "permission denied")
+			return
+		}
+
+		var totalLinkCount uint
+		if team != nil {
+			totalLinkCount = h.Store.GetLinkCountForTeam(c, team.ID)
+		} else {
+			totalLinkCount = h.Store.GetLinkCountForUser(c, owner)
+		}
 
 		limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid limit value"})
+			abortWithError(c, http.StatusBadRequest, "invalid limit value")
 			return
 		}
 		if limit < 1 || limit > 100 {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			abortWithError(c, http.StatusBadRequest, "limit must be between 1 and 100")
 			return
 		}
 
 		offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid offset value"})
+			abortWithError(c, http.StatusBadRequest, "invalid offset value")
 			return
 		}
 		if offset < 0 || uint(offset) > totalLinkCount {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "offset value out of bounds"})
+			abortWithError(c, http.StatusBadRequest, "offset value out of bounds")
 			return
 		}
 
-		links, err := h.Store.RetrieveLinksForUser(c, user.Username, limit, offset)
+		var links []db.Link
+		if team != nil {
+			links, err = h.Store.RetrieveLinksForTeam(c, team.ID, limit, offset)
+		} else {
+			links, err = h.Store.RetrieveLinksForUser(c, owner, limit, offset)
+		}
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			abortWithError(c, http.StatusInternalServerError, err.Error())
 			return
 		}
 
 		results := make([]gin.H, len(links))
-		for i, link := range links {
-			results[i] = gin.H{
-				"id":         h.Codec.Encode(int(link.ID)),
-				"url":        link.URL,
-				"visits":     link.Visits,
-				"created_at": link.CreatedAt,
-			}
+		for i := range links {
+			results[i] = h.serializeLink(&links[i])
 		}
 
 		c.JSON(http.StatusOK, gin.H{
@@ -149,7 +248,7 @@ func (h *Handler) LinkList() gin.HandlerFunc {
 			"total":   totalLinkCount,
 			"limit":   limit,
 			"offset":  offset,
-			"prefix":  GetBaseURL(h.Conf),
+			"prefix":  GetBaseURL(h.Conf.Load()),
 		})
 	}
 }
@@ -159,32 +258,48 @@ func (h *Handler) LinkCreate() gin.HandlerFunc {
 		user := c.MustGet("user").(*db.User)
 
 		var data struct {
-			URL string `json:"url"`
+			URL  string `json:"url"`
+			Team string `json:"team"`
 		}
 		if err := c.ShouldBindJSON(&data); err != nil || data.URL == "" {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "url is required"})
+			abortWithError(c, http.StatusBadRequest, "url is required")
 			return
 		}
 
 		if !CheckURLValidity(data.URL) {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "url is invalid"})
+			abortWithError(c, http.StatusBadRequest, "url is invalid")
 			return
 		}
 
-		link, err := h.Store.CreateLink(c, data.URL, user.Username)
+		var link *db.Link
+		var err error
+		if data.Team != "" {
+			team, member, canView := h.teamAccess(c, user, data.Team)
+			if !canView {
+				abortWithError(c, http.StatusNotFound, "team not found")
+				return
+			}
+			if member == nil || !member.Role.CanEditLinks() {
+				abortWithError(c, http.StatusForbidden, "permission denied")
+				return
+			}
+			link, err = h.Store.CreateTeamLink(c, data.URL, user.Username, team.ID)
+		} else {
+			link, err = h.Store.CreateLink(c, data.URL, user.Username)
+		}
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			abortWithError(c, http.StatusInternalServerError, err.Error())
 			return
 		}
 
 		encodedID := h.Codec.Encode(int(link.ID))
 		if IsBadLinkID(encodedID) {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "please try again"})
+			abortWithError(c, http.StatusInternalServerError, "please try again")
 			return
 		}
 
 		c.JSON(http.StatusCreated, gin.H{
-			"short_url": fmt.Sprintf("%s/%s", GetBaseURL(h.Conf), encodedID),
+			"short_url": fmt.Sprintf("%s/%s", GetBaseURL(h.Conf.Load()), encodedID),
 		})
 	}
 }
@@ -193,7 +308,7 @@ func (h *Handler) LinkDetails() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		encodedID := c.Param("id")
 		if encodedID == "" {
-			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+			abortWithError(c, http.StatusNotFound, "not found")
 			return
 		}
 
@@ -201,22 +316,17 @@ func (h *Handler) LinkDetails() gin.HandlerFunc {
 
 		link, err := h.Store.RetrieveLink(c, uint(decodedID))
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+			abortWithError(c, http.StatusNotFound, "not found")
 			return
 		}
 
 		user := c.MustGet("user").(*db.User)
-		if user.Username != link.CreatedBy {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		if canView, _ := h.linkAccess(c, user, link); !canView {
+			abortWithError(c, http.StatusForbidden, "permission denied")
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"id":         encodedID,
-			"url":        link.URL,
-			"visits":     link.Visits,
-			"created_at": link.CreatedAt,
-		})
+		c.JSON(http.StatusOK, h.serializeLink(link))
 	}
 }
 
@@ -224,7 +334,7 @@ func (h *Handler) LinkDelete() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		encodedID := c.Param("id")
 		if encodedID == "" {
-			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+			abortWithError(c, http.StatusNotFound, "not found")
 			return
 		}
 
@@ -232,12 +342,56 @@ func (h *Handler) LinkDelete() gin.HandlerFunc {
 
 		link, err := h.Store.RetrieveLink(c, uint(decodedID))
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+			abortWithError(c, http.StatusNotFound, "not found")
+			return
+		}
+
+		user := c.MustGet("user").(*db.User)
+		if _, canEdit := h.linkAccess(c, user, link); !canEdit {
+			abortWithError(c, http.StatusForbidden, "permission denied")
 			return
 		}
 
 		if err := h.Store.DeleteLink(c, link.ID); err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) LinkTransfer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var data struct {
+			User string `json:"user"`
+			Team string `json:"team"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil || (data.User == "") == (data.Team == "") {
+			abortWithError(c, http.StatusBadRequest, "either user or team is required")
+			return
+		}
+
+		link, err := h.Store.RetrieveLink(c, uint(h.Codec.Decode(c.Param("id"))))
+		if err != nil {
+			abortWithError(c, http.StatusNotFound, "not found")
+			return
+		}
+
+		user := c.MustGet("user").(*db.User)
+		if _, canEdit := h.linkAccess(c, user, link); !canEdit {
+			abortWithError(c, http.StatusForbidden, "permission denied")
+			return
+		}
+
+		owner, status, err := h.resolveLinkOwner(c, user, data.User, data.Team)
+		if err != nil {
+			abortWithError(c, status, err.Error())
+			return
+		}
+
+		if err := h.Store.TransferLink(c, link.ID, owner); err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
 			return
 		}
 
@@ -245,22 +399,31 @@ func (h *Handler) LinkDelete() gin.HandlerFunc {
 	}
 }
 
+func (h *Handler) RoleList() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		results := make([]gin.H, len(db.Roles))
+		for i, role := range db.Roles {
+			results[i] = gin.H{
+				"name":        role,
+				"permissions": role.Permissions(),
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"results": results})
+	}
+}
+
 func (h *Handler) UserList() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		users, err := h.Store.RetrieveAllUsers(c)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			abortWithError(c, http.StatusInternalServerError, err.Error())
 			return
 		}
 
 		results := make([]gin.H, len(users))
 		for i, user := range users {
-			results[i] = gin.H{
-				"username":   user.Username,
-				"password":   "<secret>",
-				"is_admin":   user.IsAdmin,
-				"created_at": user.CreatedAt,
-			}
+			results[i] = serializeUser(&user)
 		}
 
 		c.JSON(http.StatusOK, gin.H{"results": results})
@@ -272,34 +435,39 @@ func (h *Handler) UserCreate() gin.HandlerFunc {
 		var data struct {
 			Username string `json:"username" binding:"required"`
 			Password string `json:"password" binding:"required"`
+			Role     string `json:"role"`
 		}
 		if err := c.BindJSON(&data); err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing required fields"})
+			abortWithError(c, http.StatusBadRequest, "missing required fields")
 			return
 		}
 
+		role := db.DefaultRole
+		if data.Role != "" {
+			var err error
+			if role, err = db.ParseRole(data.Role); err != nil {
+				abortWithError(c, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
 		if err := db.CheckUsernameValidity(data.Username); err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			abortWithError(c, http.StatusBadRequest, err.Error())
 			return
 		}
 
 		if err := db.CheckPasswordStrengthValidity(data.Password); err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			abortWithError(c, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		user, err := h.Store.CreateUser(c, data.Username, data.Password)
+		user, err := h.Store.CreateUser(c, data.Username, data.Password, role)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			abortWithError(c, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{
-			"username":   user.Username,
-			"password":   "<secret>",
-			"is_admin":   user.IsAdmin,
-			"created_at": user.CreatedAt,
-		})
+		c.JSON(http.StatusCreated, serializeUser(user))
 	}
 }
 
@@ -308,11 +476,12 @@ func (h *Handler) UserDetailsOrEdit() gin.HandlerFunc {
 		var data struct {
 			Username string `json:"username"`
 			Password string `json:"password"`
+			Role     string `json:"role"`
 		}
 
 		user, err := h.Store.RetrieveUser(c, c.Param("username"))
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			abortWithError(c, http.StatusNotFound, "user not found")
 			return
 		}
 
@@ -321,39 +490,52 @@ func (h *Handler) UserDetailsOrEdit() gin.HandlerFunc {
 		}
 
 		if err := c.BindJSON(&data); err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			abortWithError(c, http.StatusBadRequest, err.Error())
 			return
 		}
 
 		if data.Username != "" {
 			if err := db.CheckUsernameValidity(data.Username); err != nil {
-				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				abortWithError(c, http.StatusBadRequest, err.Error())
 				return
 			}
 			if err := h.Store.UpdateUsername(c, user.Username, data.Username); err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				abortWithError(c, http.StatusInternalServerError, err.Error())
 				return
 			}
+			user.Username = data.Username
 		}
 
 		if data.Password != "" {
 			if err := db.CheckPasswordStrengthValidity(data.Password); err != nil {
-				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				abortWithError(c, http.StatusBadRequest, err.Error())
 				return
 			}
 			if err := h.Store.UpdatePassword(c, user.Username, data.Password); err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				abortWithError(c, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+
+		if data.Role != "" {
+			role, err := db.ParseRole(data.Role)
+			if err != nil {
+				abortWithError(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			if c.MustGet("user").(*db.User).ID == user.ID && role != user.Role {
+				abortWithError(c, http.StatusForbidden, "can not change your own role")
+				return
+			}
+			if err := h.Store.SetRole(c, user.Username, role); err != nil {
+				abortWithError(c, http.StatusInternalServerError, err.Error())
 				return
 			}
+			user.Role = role
 		}
 
 	respondWithUserDetails:
-		c.JSON(http.StatusOK, gin.H{
-			"username":   user.Username,
-			"password":   "<secret>",
-			"is_admin":   user.IsAdmin,
-			"created_at": user.CreatedAt,
-		})
+		c.JSON(http.StatusOK, serializeUser(user))
 	}
 }
 
@@ -361,20 +543,357 @@ func (h *Handler) UserDelete() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, err := h.Store.RetrieveUser(c, c.Param("username"))
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			abortWithError(c, http.StatusNotFound, "user not found")
 			return
 		}
 
-		if user.IsAdmin {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "target user is admin"})
+		if user.Role == db.RoleAdmin {
+			abortWithError(c, http.StatusForbidden, "target user is admin")
+			return
+		}
+
+		reassignUser, reassignTeam := c.Query("reassign_to"), c.Query("reassign_to_team")
+		if reassignUser != "" || reassignTeam != "" {
+			if reassignUser == user.Username {
+				abortWithError(c, http.StatusBadRequest, "can not reassign links to the deleted user")
+				return
+			}
+			owner, status, err := h.resolveLinkOwner(c, c.MustGet("user").(*db.User), reassignUser, reassignTeam)
+			if err != nil {
+				abortWithError(c, status, err.Error())
+				return
+			}
+			if _, err := h.Store.TransferUserLinks(c, user.Username, owner); err != nil {
+				abortWithError(c, http.StatusInternalServerError, err.Error())
+				return
+			}
+		} else if count := h.Store.GetLinkCountForUser(c, user.Username); count > 0 {
+			abortWithError(c, http.StatusConflict, fmt.Sprintf(
+				"%s still owns %d links, pass reassign_to or reassign_to_team", user.Username, count))
 			return
 		}
 
 		if err := h.Store.DeleteUser(c, user.Username); err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) UserUnlock() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := h.Store.RetrieveUser(c, c.Param("username"))
+		if err != nil {
+			abortWithError(c, http.StatusNotFound, "user not found")
+			return
+		}
+
+		if err := h.Store.UnlockUser(c, user.Username); err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) UserLoginEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit < 1 || limit > 100 {
+			abortWithError(c, http.StatusBadRequest, "limit must be between 1 and 100")
+			return
+		}
+
+		offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if err != nil || offset < 0 {
+			abortWithError(c, http.StatusBadRequest, "invalid offset value")
+			return
+		}
+
+		events, err := h.Store.RetrieveLoginEvents(c, c.Param("username"), limit, offset)
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		results := make([]gin.H, len(events))
+		for i, event := range events {
+			results[i] = gin.H{
+				"username":   event.Username,
+				"success":    event.Success,
+				"method":     event.Method,
+				"reason":     event.Reason,
+				"ip":         event.IP,
+				"user_agent": event.UserAgent,
+				"created_at": event.CreatedAt,
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"results": results,
+			"limit":   limit,
+			"offset":  offset,
+		})
+	}
+}
+
+func (h *Handler) AccountTOTPSetup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(*db.User)
+
+		if user.TOTPEnabled {
+			abortWithError(c, http.StatusConflict, "two-factor authentication is already enabled")
+			return
+		}
+
+		key, err := totp.Generate(totp.GenerateOpts{
+			Issuer:      "SimpleLinkShortener",
+			AccountName: user.Username,
+		})
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		img, err := key.Image(256, 256)
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if err := h.Store.SetTOTPSecret(c, user.Username, key.Secret()); err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"secret":      key.Secret(),
+			"otpauth_url": key.URL(),
+			"qr_code":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+		})
+	}
+}
+
+func (h *Handler) AccountTOTPConfirm() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(*db.User)
+
+		var data struct {
+			Code string `json:"code" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			abortWithError(c, http.StatusBadRequest, "code is required")
+			return
+		}
+
+		if user.TOTPEnabled {
+			abortWithError(c, http.StatusConflict, "two-factor authentication is already enabled")
+			return
+		}
+
+		if user.TOTPSecret == "" {
+			abortWithError(c, http.StatusBadRequest, "two-factor authentication setup has not been started")
+			return
+		}
+
+		if !totp.Validate(data.Code, user.TOTPSecret) {
+			abortWithError(c, http.StatusBadRequest, "incorrect two-factor authentication code")
+			return
+		}
+
+		codes, hashes := db.GenerateRecoveryCodes(10)
+		if err := h.Store.EnableTOTP(c, user.Username, hashes); err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"recovery_codes": codes,
+		})
+	}
+}
+
+func (h *Handler) AccountTOTPDisable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(*db.User)
+
+		var data struct {
+			Code string `json:"code" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			abortWithError(c, http.StatusBadRequest, "code is required")
+			return
+		}
+
+		if !user.TOTPEnabled {
+			abortWithError(c, http.StatusConflict, "two-factor authentication is not enabled")
+			return
+		}
+
+		if !totp.Validate(data.Code, user.TOTPSecret) {
+			used, err := h.Store.UseRecoveryCode(c, user.Username, db.HashToken(db.NormalizeRecoveryCode(data.Code)))
+			if err != nil {
+				abortWithError(c, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if !used {
+				abortWithError(c, http.StatusBadRequest, "incorrect two-factor authentication code")
+				return
+			}
+		}
+
+		if err := h.Store.DisableTOTP(c, user.Username); err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
 			return
 		}
 
 		c.AbortWithStatus(http.StatusNoContent)
 	}
 }
+
+func (h *Handler) AccountTokenList() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(*db.User)
+
+		tokens, err := h.Store.RetrieveAPITokens(c, user.Username)
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		results := make([]gin.H, len(tokens))
+		for i := range tokens {
+			results[i] = serializeAPIToken(&tokens[i])
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"results": results,
+		})
+	}
+}
+
+func (h *Handler) AccountTokenCreate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(*db.User)
+
+		var data struct {
+			Name string `json:"name" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil || len(data.Name) > 64 {
+			abortWithError(c, http.StatusBadRequest, "name is required and must be at most 64 characters")
+			return
+		}
+
+		token, tokenHash := db.GenerateToken(db.APITokenPrefix)
+		apiToken, err := h.Store.CreateAPIToken(c, user.Username, data.Name, tokenHash)
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		result := serializeAPIToken(apiToken)
+		result["token"] = token
+		c.JSON(http.StatusCreated, result)
+	}
+}
+
+func (h *Handler) AccountTokenDelete() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(*db.User)
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			abortWithError(c, http.StatusNotFound, "token not found")
+			return
+		}
+
+		if err := h.Store.DeleteAPIToken(c, user.Username, uint(id)); err != nil {
+			abortWithError(c, http.StatusNotFound, "token not found")
+			return
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) linkAccess(c *gin.Context, user *db.User, link *db.Link) (bool, bool) {
+	if user.Can(db.PermissionModerateLinks) {
+		return true, true
+	}
+
+	if link.TeamID == nil {
+		owns := link.CreatedByID != nil && *link.CreatedByID == user.ID
+		return owns, owns
+	}
+
+	member, err := h.Store.RetrieveTeamMember(c, *link.TeamID, user.Username)
+	if err != nil {
+		return false, false
+	}
+	return true, member.Role.CanEditLinks()
+}
+
+func (h *Handler) resolveLinkOwner(c *gin.Context, user *db.User, username, teamName string) (db.LinkOwner, int, error) {
+	if teamName != "" {
+		team, member, canView := h.teamAccess(c, user, teamName)
+		if !canView {
+			return db.LinkOwner{}, http.StatusNotFound, errors.New("team not found")
+		}
+		if !user.Can(db.PermissionModerateLinks) && (member == nil || !member.Role.CanEditLinks()) {
+			return db.LinkOwner{}, http.StatusForbidden, errors.New("permission denied")
+		}
+		return db.LinkOwner{TeamID: team.ID}, 0, nil
+	}
+
+	if username != user.Username && !user.Can(db.PermissionModerateLinks) {
+		return db.LinkOwner{}, http.StatusForbidden, errors.New("permission denied")
+	}
+
+	target, err := h.Store.RetrieveUser(c, username)
+	if err != nil {
+		return db.LinkOwner{}, http.StatusNotFound, errors.New("user not found")
+	}
+	return db.LinkOwner{Username: target.Username}, 0, nil
+}
+
+func (h *Handler) serializeLink(link *db.Link) gin.H {
+	return gin.H{
+		"id":         h.Codec.Encode(int(link.ID)),
+		"url":        link.URL,
+		"visits":     link.Visits,
+		"created_by": link.CreatedBy,
+		"team_id":    link.TeamID,
+		"created_at": link.CreatedAt,
+	}
+}
+
+func serializeUser(user *db.User) gin.H {
+	return gin.H{
+		"username":        user.Username,
+		"password":        "<secret>",
+		"role":            user.Role,
+		"permissions":     user.Role.Permissions(),
+		"created_at":      user.CreatedAt,
+		"failed_attempts": user.FailedAttempts,
+		"locked_until":    user.LockedUntil,
+		"is_locked":       user.IsLocked(),
+		"totp_enabled":    user.TOTPEnabled,
+	}
+}
+
+func serializeAPIToken(token *db.APIToken) gin.H {
+	return gin.H{
+		"id":           token.ID,
+		"name":         token.Name,
+		"created_at":   token.CreatedAt,
+		"last_used_at": token.LastUsedAt,
+	}
+}
@@ -0,0 +1,89 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/db"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		c.Set("request_id", requestID)
+		c.Header(requestIDHeader, requestID)
+
+		c.Next()
+	}
+}
+
+func AccessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("request_id", c.GetString("request_id")),
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+
+		if user, ok := c.Get("user"); ok {
+			attrs = append(attrs, slog.String("user", user.(*db.User).Username))
+		}
+
+		if linkID := c.Param("id"); linkID != "" {
+			attrs = append(attrs, slog.String("link", linkID))
+		}
+
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+func abortWithError(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": message, "request_id": c.GetString("request_id")})
+}
+
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > 128 {
+		return false
+	}
+	for _, char := range requestID {
+		if char < '!' || char > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,179 @@
+package web
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+)
+
+const metricsNamespace = "simplelinkshortener"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	redirects       *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	authFailures    prometheus.Counter
+	flushDuration   prometheus.Histogram
+	flushFailures   prometheus.Counter
+}
+
+type dbStatsReporter interface {
+	Stats() sql.DBStats
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "redirects_total",
+			Help:      "Short link requests by response status.",
+		}, []string{"status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Request latency by route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		authFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "auth_failures_total",
+			Help:      "Rejected authentication attempts.",
+		}),
+		flushDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_flush_duration_seconds",
+			Help:      "Time taken to write cached visits of a link to the database.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}),
+		flushFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_flush_failures_total",
+			Help:      "Failed attempts to write cached visits to the database.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.redirects,
+		m.requestDuration,
+		m.authFailures,
+		m.flushDuration,
+		m.flushFailures,
+	)
+
+	return m
+}
+
+func (m *Metrics) RegisterCache(cache *Cache) {
+	if m == nil || cache == nil {
+		return
+	}
+
+	stat := func(name, help string, value func(CacheStats) float64) prometheus.Collector {
+		opts := prometheus.GaugeOpts{Namespace: metricsNamespace, Subsystem: "cache", Name: name, Help: help}
+		return prometheus.NewGaugeFunc(opts, func() float64 { return value(cache.Stats()) })
+	}
+	counter := func(name, help string, value func(CacheStats) float64) prometheus.Collector {
+		opts := prometheus.CounterOpts{Namespace: metricsNamespace, Subsystem: "cache", Name: name, Help: help}
+		return prometheus.NewCounterFunc(opts, func() float64 { return value(cache.Stats()) })
+	}
+
+	m.registry.MustRegister(
+		counter("hits_total", "Lookups served from the cache.", func(s CacheStats) float64 { return float64(s.Hits) }),
+		counter("misses_total", "Lookups resolved from the database.", func(s CacheStats) float64 { return float64(s.Misses) }),
+		counter("evictions_total", "Pages evicted from the cache.", func(s CacheStats) float64 { return float64(s.Evictions) }),
+		stat("size", "Pages currently held in the cache.", func(s CacheStats) float64 { return float64(s.Size) }),
+		stat("pending_visits", "Visits not yet written to the database.", func(s CacheStats) float64 { return float64(s.PendingVisits) }),
+	)
+}
+
+func (m *Metrics) RegisterStore(store any) {
+	if m == nil {
+		return
+	}
+
+	reporter, ok := store.(dbStatsReporter)
+	if !ok {
+		return
+	}
+
+	stat := func(name, help string, value func(sql.DBStats) float64) prometheus.Collector {
+		opts := prometheus.GaugeOpts{Namespace: metricsNamespace, Subsystem: "db", Name: name, Help: help}
+		return prometheus.NewGaugeFunc(opts, func() float64 { return value(reporter.Stats()) })
+	}
+
+	m.registry.MustRegister(
+		stat("max_open_connections", "Maximum number of open connections.", func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }),
+		stat("open_connections", "Established connections.", func(s sql.DBStats) float64 { return float64(s.OpenConnections) }),
+		stat("in_use_connections", "Connections currently in use.", func(s sql.DBStats) float64 { return float64(s.InUse) }),
+		stat("idle_connections", "Idle connections.", func(s sql.DBStats) float64 { return float64(s.Idle) }),
+		stat("wait_count", "Total number of connections waited for.", func(s sql.DBStats) float64 { return float64(s.WaitCount) }),
+		stat("wait_duration_seconds", "Total time blocked waiting for a connection.", func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }),
+	)
+}
+
+func (m *Metrics) AuthFailure() {
+	if m == nil {
+		return
+	}
+	m.authFailures.Inc()
+}
+
+func (m *Metrics) ObserveFlush(duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.flushDuration.Observe(duration.Seconds())
+	if err != nil {
+		m.flushFailures.Inc()
+	}
+}
+
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		m.requestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+		if route == "/:id" {
+			m.redirects.WithLabelValues(status).Inc()
+		}
+	}
+}
+
+func (m *Metrics) Handler(conf *atomic.Pointer[cfg.Config]) http.Handler {
+	metricsHandler := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := conf.Load().Server.MetricsToken
+		if token != "" {
+			expected := []byte("Bearer " + token)
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		metricsHandler.ServeHTTP(w, r)
+	})
+}
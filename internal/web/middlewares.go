@@ -1,8 +1,11 @@
 package web
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"slices"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 
@@ -10,15 +13,21 @@ import (
 	"github.com/salmanmorshed/simplelinkshortener/internal/db"
 )
 
-func CORSMiddleware(conf *cfg.Config) gin.HandlerFunc {
+func CORSMiddleware(conf *atomic.Pointer[cfg.Config]) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		server := conf.Load().Server
+		if !server.UseCORS {
+			c.Next()
+			return
+		}
+
 		origin := c.GetHeader("Origin")
-		if origin != "" && slices.Contains(conf.Server.CORSOrigins, origin) {
+		if origin != "" && slices.Contains(server.CORSOrigins, origin) {
 			c.Header("Access-Control-Allow-Origin", origin)
 			c.Header("Access-Control-Allow-Credentials", "true")
 			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			c.Header("Access-Control-Allow-Headers", "Authorization, Accept-Encoding, Content-Type, Content-Length")
-			c.Header("Access-Control-Expose-Headers", "WWW-Authenticate, Content-Type, Content-Length, X-API-Version")
+			c.Header("Access-Control-Allow-Headers", "Authorization, Accept-Encoding, Content-Type, Content-Length, X-Request-ID")
+			c.Header("Access-Control-Expose-Headers", "WWW-Authenticate, Content-Type, Content-Length, X-API-Version, X-Request-ID")
 
 			if c.Request.Method == "OPTIONS" {
 				c.AbortWithStatus(http.StatusNoContent)
@@ -30,38 +39,31 @@ func CORSMiddleware(conf *cfg.Config) gin.HandlerFunc {
 	}
 }
 
-func BasicAuthMiddleware(store db.Store) gin.HandlerFunc {
+func PermissionMiddleware(permission db.Permission) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		username, password, hasAuth := c.Request.BasicAuth()
-
-		if !hasAuth {
-			c.Header("WWW-Authenticate", `Basic realm="Restricted"`)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing authentication credentials"})
-			return
-		}
+		user, ok := c.MustGet("user").(*db.User)
 
-		user, err := store.RetrieveUser(c, username)
-		if err != nil || !db.VerifyPassword(user.Password, password) {
-			c.Header("WWW-Authenticate", `Basic realm="Restricted"`)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "incorrect username and/or password"})
+		if !ok || !user.Can(permission) {
+			abortWithError(c, http.StatusForbidden, fmt.Sprintf("permission '%s' is required", permission))
 			return
 		}
 
-		c.Set("user", user)
-
 		c.Next()
 	}
 }
 
-func AdminFilterMiddleware() gin.HandlerFunc {
+func QueryTimeoutMiddleware(conf *atomic.Pointer[cfg.Config]) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		user, ok := c.MustGet("user").(*db.User)
-
-		if !ok || !user.IsAdmin {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "user is not admin"})
+		timeout := conf.Load().Database.QueryTimeout
+		if timeout <= 0 {
+			c.Next()
 			return
 		}
 
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
 		c.Next()
 	}
 }
@@ -0,0 +1,273 @@
+package web
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+	"github.com/salmanmorshed/simplelinkshortener/internal/db"
+)
+
+const (
+	oidcStateCookieName = "sls_oidc"
+	oidcStateLifetime   = 10 * time.Minute
+	oidcCookiePath      = "/api/oidc"
+)
+
+type OIDCProvider struct {
+	conf       *atomic.Pointer[cfg.Config]
+	auth       *Authenticator
+	ctx        context.Context
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewOIDCProvider(globalCtx context.Context, conf *atomic.Pointer[cfg.Config], auth *Authenticator) *OIDCProvider {
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	return &OIDCProvider{
+		conf:       conf,
+		auth:       auth,
+		ctx:        oidc.ClientContext(context.WithoutCancel(globalCtx), httpClient),
+		httpClient: httpClient,
+	}
+}
+
+func (p *OIDCProvider) client() (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth2 != nil {
+		return p.oauth2, p.verifier, nil
+	}
+
+	conf := p.conf.Load()
+	provider, err := oidc.NewProvider(p.ctx, conf.OIDC.IssuerURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+
+	redirectURL := conf.OIDC.RedirectURL
+	if redirectURL == "" {
+		redirectURL = GetBaseURL(conf) + oidcCookiePath + "/callback"
+	}
+
+	p.oauth2 = &oauth2.Config{
+		ClientID:     conf.OIDC.ClientID,
+		ClientSecret: conf.OIDC.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       conf.OIDC.Scopes,
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: conf.OIDC.ClientID})
+
+	return p.oauth2, p.verifier, nil
+}
+
+func (p *OIDCProvider) Login() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		oauthConf, _, err := p.client()
+		if err != nil {
+			slog.Error(err.Error())
+			abortWithError(c, http.StatusServiceUnavailable, "identity provider is unavailable")
+			return
+		}
+
+		state, _ := db.GenerateToken("")
+		nonce, _ := db.GenerateToken("")
+		verifier := oauth2.GenerateVerifier()
+
+		p.setStateCookie(c, strings.Join([]string{state, nonce, verifier}, "."), int(oidcStateLifetime.Seconds()))
+
+		c.Redirect(http.StatusFound, oauthConf.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)))
+	}
+}
+
+func (p *OIDCProvider) Callback() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stateCookie, _ := c.Cookie(oidcStateCookieName)
+		p.setStateCookie(c, "", -1)
+
+		parts := strings.Split(stateCookie, ".")
+		if len(parts) != 3 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(c.Query("state"))) != 1 {
+			abortWithError(c, http.StatusBadRequest, "invalid or expired login state")
+			return
+		}
+		nonce, verifier := parts[1], parts[2]
+
+		if errCode := c.Query("error"); errCode != "" {
+			p.auth.metrics.AuthFailure()
+			abortWithError(c, http.StatusUnauthorized, "identity provider denied the login: "+errCode)
+			return
+		}
+
+		oauthConf, idVerifier, err := p.client()
+		if err != nil {
+			slog.Error(err.Error())
+			abortWithError(c, http.StatusServiceUnavailable, "identity provider is unavailable")
+			return
+		}
+
+		ctx := oidc.ClientContext(c, p.httpClient)
+		token, err := oauthConf.Exchange(ctx, c.Query("code"), oauth2.VerifierOption(verifier))
+		if err != nil {
+			slog.Warn("oidc code exchange failed", "error", err)
+			p.auth.metrics.AuthFailure()
+			abortWithError(c, http.StatusUnauthorized, "failed to exchange authorization code")
+			return
+		}
+
+		rawIDToken, ok := token.Extra("id_token").(string)
+		if !ok {
+			p.auth.metrics.AuthFailure()
+			abortWithError(c, http.StatusUnauthorized, "identity provider did not return an id token")
+			return
+		}
+
+		idToken, err := idVerifier.Verify(ctx, rawIDToken)
+		if err != nil {
+			slog.Warn("oidc id token verification failed", "error", err)
+			p.auth.metrics.AuthFailure()
+			abortWithError(c, http.StatusUnauthorized, "invalid id token")
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+			p.auth.metrics.AuthFailure()
+			abortWithError(c, http.StatusUnauthorized, "invalid id token nonce")
+			return
+		}
+
+		var claims map[string]any
+		if err := idToken.Claims(&claims); err != nil {
+			abortWithError(c, http.StatusUnauthorized, "invalid id token claims")
+			return
+		}
+
+		identity := db.OIDCIdentity{Issuer: idToken.Issuer, Subject: idToken.Subject}
+		user, err := p.provisionUser(c, identity, claims)
+		if err != nil {
+			p.auth.metrics.AuthFailure()
+			abortWithError(c, http.StatusForbidden, err.Error())
+			return
+		}
+
+		if user.IsLocked() {
+			p.auth.reject(c, nil, user.Username, "oidc", "locked", "account is temporarily locked")
+			return
+		}
+
+		if _, err := p.auth.startSession(c, user, "oidc"); err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.Redirect(http.StatusFound, GetBaseURL(p.conf.Load())+"/web")
+	}
+}
+
+func (p *OIDCProvider) provisionUser(c *gin.Context, identity db.OIDCIdentity, claims map[string]any) (*db.User, error) {
+	conf := p.conf.Load()
+
+	user, err := p.auth.store.RetrieveUserByOIDCIdentity(c, identity)
+	if errors.Is(err, db.ErrNotFound) {
+		user, err = p.linkUser(c, identity, claims)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if role := mapOIDCRole(conf, claims, user.Role); role != user.Role {
+		if err := p.auth.store.SetRole(c, user.Username, role); err != nil {
+			return nil, err
+		}
+		user.Role = role
+	}
+
+	return user, nil
+}
+
+func (p *OIDCProvider) linkUser(c *gin.Context, identity db.OIDCIdentity, claims map[string]any) (*db.User, error) {
+	conf := p.conf.Load()
+
+	username, _ := claims[conf.OIDC.UsernameClaim].(string)
+	if err := db.CheckUsernameValidity(username); err != nil {
+		return nil, fmt.Errorf("claim '%s' is not a valid username: %w", conf.OIDC.UsernameClaim, err)
+	}
+
+	user, err := p.auth.store.RetrieveUser(c, username)
+	if errors.Is(err, db.ErrNotFound) {
+		password, _ := db.GenerateToken("")
+		role := mapOIDCRole(conf, claims, db.DefaultRole)
+		if user, err = p.auth.store.CreateOIDCUser(c, username, password, role, identity); err != nil {
+			return nil, errors.New("failed to provision user")
+		}
+		slog.Info("provisioned user from oidc", "user", username)
+		return user, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !conf.OIDC.LinkExisting || user.OIDCIssuer != nil {
+		return nil, fmt.Errorf("account %s is not linked to this identity provider", username)
+	}
+	if err = p.auth.store.LinkOIDCIdentity(c, username, identity); err != nil {
+		return nil, err
+	}
+	slog.Info("linked existing user to oidc identity", "user", username)
+
+	return user, nil
+}
+
+func (p *OIDCProvider) setStateCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookieName, value, maxAge, oidcCookiePath, "", isSecureDeployment(p.conf.Load()), true)
+}
+
+func mapOIDCRole(conf *cfg.Config, claims map[string]any, role db.Role) db.Role {
+	if len(conf.OIDC.AdminGroups) == 0 {
+		return role
+	}
+
+	groups := claimStrings(claims[conf.OIDC.GroupsClaim])
+	if slices.ContainsFunc(conf.OIDC.AdminGroups, func(group string) bool { return slices.Contains(groups, group) }) {
+		return db.RoleAdmin
+	}
+	if role == db.RoleAdmin {
+		return db.DefaultRole
+	}
+	return role
+}
+
+func claimStrings(claim any) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,78 @@
+package web
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+)
+
+const parsedForwardedHeader = "X-Sls-Forwarded-For"
+
+func configureClientIP(router *gin.Engine, conf *cfg.Config) error {
+	if err := router.SetTrustedProxies(conf.Server.TrustedProxies); err != nil {
+		return err
+	}
+
+	headers := make([]string, 0, len(conf.Server.ClientIPHeaders))
+	useForwarded := false
+	for _, header := range conf.Server.ClientIPHeaders {
+		if strings.EqualFold(header, cfg.HeaderForwarded) {
+			headers = append(headers, parsedForwardedHeader)
+			useForwarded = true
+		} else {
+			headers = append(headers, http.CanonicalHeaderKey(header))
+		}
+	}
+	router.RemoteIPHeaders = headers
+
+	if useForwarded {
+		router.Use(ForwardedHeaderMiddleware())
+	}
+
+	return nil
+}
+
+func ForwardedHeaderMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Header.Del(parsedForwardedHeader)
+
+		var addrs []string
+		for _, value := range c.Request.Header.Values(cfg.HeaderForwarded) {
+			for _, element := range strings.Split(value, ",") {
+				if addr := parseForwardedFor(element); addr != "" {
+					addrs = append(addrs, addr)
+				}
+			}
+		}
+
+		if len(addrs) > 0 {
+			c.Request.Header.Set(parsedForwardedHeader, strings.Join(addrs, ", "))
+		}
+
+		c.Next()
+	}
+}
+
+func parseForwardedFor(element string) string {
+	for _, pair := range strings.Split(element, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !strings.EqualFold(key, "for") {
+			continue
+		}
+
+		value = strings.Trim(value, `"`)
+		if host, _, err := net.SplitHostPort(value); err == nil {
+			value = host
+		}
+		value = strings.Trim(value, "[]")
+
+		if net.ParseIP(value) != nil {
+			return value
+		}
+	}
+	return ""
+}
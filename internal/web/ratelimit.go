@@ -0,0 +1,198 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+	"github.com/salmanmorshed/simplelinkshortener/internal/db"
+)
+
+type RateLimitBackend interface {
+	Take(key string, policy cfg.RateLimitPolicy) (bool, time.Duration)
+	Refund(key string, policy cfg.RateLimitPolicy)
+}
+
+type PolicySelector func(*cfg.Config) cfg.RateLimitPolicy
+
+type RateLimiter struct {
+	backend RateLimitBackend
+	conf    *atomic.Pointer[cfg.Config]
+}
+
+func NewRateLimiter(backend RateLimitBackend, conf *atomic.Pointer[cfg.Config]) *RateLimiter {
+	return &RateLimiter{backend, conf}
+}
+
+func (l *RateLimiter) PerIP(name string, selector PolicySelector) gin.HandlerFunc {
+	return l.middleware(name, selector, func(c *gin.Context) string {
+		return "ip:" + c.ClientIP()
+	})
+}
+
+func (l *RateLimiter) PerUser(name string, selector PolicySelector) gin.HandlerFunc {
+	return l.middleware(name, selector, func(c *gin.Context) string {
+		if user, ok := c.Get("user"); ok {
+			return "user:" + user.(*db.User).Username
+		}
+		return "ip:" + c.ClientIP()
+	})
+}
+
+func (l *RateLimiter) TakeAuth(c *gin.Context, username string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	policy := l.conf.Load().RateLimit.AuthFailures
+	ipKey := authFailureKey("ip:" + c.ClientIP())
+	if ok, retryAfter := l.backend.Take(ipKey, policy); !ok {
+		return false, retryAfter
+	}
+	if username != "" {
+		if ok, retryAfter := l.backend.Take(authFailureKey("user:"+username), policy); !ok {
+			l.backend.Refund(ipKey, policy)
+			return false, retryAfter
+		}
+	}
+	return true, 0
+}
+
+func (l *RateLimiter) RefundAuth(c *gin.Context, username string) {
+	if l == nil {
+		return
+	}
+
+	policy := l.conf.Load().RateLimit.AuthFailures
+	l.backend.Refund(authFailureKey("ip:"+c.ClientIP()), policy)
+	if username != "" {
+		l.backend.Refund(authFailureKey("user:"+username), policy)
+	}
+}
+
+func (l *RateLimiter) middleware(name string, selector PolicySelector, key func(*gin.Context) string) gin.HandlerFunc {
+	if l == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		policy := selector(l.conf.Load())
+		if ok, retryAfter := l.backend.Take(name+":"+key(c), policy); !ok {
+			abortWithTooManyRequests(c, retryAfter)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func authFailureKey(key string) string {
+	return "auth_failures:" + key
+}
+
+func abortWithTooManyRequests(c *gin.Context, retryAfter time.Duration) {
+	c.Header("Retry-After", fmt.Sprint(int(math.Ceil(retryAfter.Seconds()))))
+	abortWithError(c, http.StatusTooManyRequests, "too many requests")
+}
+
+type tokenBucket struct {
+	tokens   float64
+	burst    float64
+	rate     float64
+	lastSeen time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time, policy cfg.RateLimitPolicy) {
+	b.rate = float64(policy.Requests) / policy.Period.Seconds()
+	b.burst = float64(policy.Burst)
+	if b.burst == 0 {
+		b.burst = float64(policy.Requests)
+	}
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.lastSeen).Seconds()*b.rate)
+	b.lastSeen = now
+}
+
+func (b *tokenBucket) wait() time.Duration {
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+type MemoryRateLimitBackend struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func NewMemoryRateLimitBackend(ctx context.Context) *MemoryRateLimitBackend {
+	b := &MemoryRateLimitBackend{buckets: make(map[string]*tokenBucket)}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				b.removeFullBuckets(now)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return b
+}
+
+func (b *MemoryRateLimitBackend) Take(key string, policy cfg.RateLimitPolicy) (bool, time.Duration) {
+	if policy.Requests == 0 || policy.Period <= 0 {
+		return true, 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	bucket, exists := b.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: math.Inf(1), lastSeen: now}
+		b.buckets[key] = bucket
+	}
+	bucket.refill(now, policy)
+
+	if bucket.tokens < 1 {
+		return false, bucket.wait()
+	}
+	bucket.tokens -= 1
+	return true, 0
+}
+
+func (b *MemoryRateLimitBackend) Refund(key string, policy cfg.RateLimitPolicy) {
+	if policy.Requests == 0 || policy.Period <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bucket, exists := b.buckets[key]
+	if !exists {
+		return
+	}
+	bucket.refill(time.Now(), policy)
+	bucket.tokens = math.Min(bucket.burst, bucket.tokens+1)
+}
+
+func (b *MemoryRateLimitBackend) removeFullBuckets(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for key, bucket := range b.buckets {
+		if bucket.tokens+now.Sub(bucket.lastSeen).Seconds()*bucket.rate >= bucket.burst {
+			delete(b.buckets, key)
+		}
+	}
+}
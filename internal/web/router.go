@@ -2,10 +2,15 @@ package web
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io/fs"
+	"log/slog"
+	"net/http"
 	"os"
 	"strings"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 	"github.com/salmanmorshed/intstrcodec"
@@ -14,7 +19,16 @@ import (
 	"github.com/salmanmorshed/simplelinkshortener/internal/db"
 )
 
-func SetupRouter(globalCtx context.Context, conf *cfg.Config, store db.Store, codec *intstrcodec.Codec) func() error {
+type Server struct {
+	conf          atomic.Pointer[cfg.Config]
+	certificate   atomic.Pointer[tls.Certificate]
+	handler       *Handler
+	httpServer    *http.Server
+	acmeServer    *http.Server
+	metricsServer *http.Server
+}
+
+func SetupRouter(globalCtx context.Context, conf *cfg.Config, store db.Store, codec *intstrcodec.Codec) *Server {
 	var static fs.FS
 	if strings.HasPrefix(cfg.Version, "v") {
 		static = efs
@@ -23,42 +37,229 @@ func SetupRouter(globalCtx context.Context, conf *cfg.Config, store db.Store, co
 		static = os.DirFS("internal/web")
 	}
 
-	handler := Handler{conf, store, codec}
+	srv := &Server{}
+	srv.conf.Store(conf)
+
+	var metrics *Metrics
+	if conf.Server.UseMetrics {
+		metrics = NewMetrics()
+		metrics.RegisterStore(store)
+	}
+
+	handler := &Handler{Conf: &srv.conf, Store: store, Codec: codec, metrics: metrics}
+
+	router := gin.New()
+	router.ContextWithFallback = true
+	if err := configureClientIP(router, conf); err != nil {
+		slog.Error("failed to configure trusted proxies", "error", err)
+	}
+	router.Use(RequestIDMiddleware(), AccessLogMiddleware(), gin.Recovery())
+
+	if metrics != nil {
+		router.Use(metrics.Middleware())
+	}
+
+	router.Use(CORSMiddleware(&srv.conf), QueryTimeoutMiddleware(&srv.conf))
+
+	var limiter *RateLimiter
+	if conf.RateLimit.Enabled {
+		limiter = NewRateLimiter(NewMemoryRateLimitBackend(globalCtx), &srv.conf)
+	}
 
-	router := gin.Default()
+	auth := NewAuthenticator(&srv.conf, store, metrics, limiter)
+	authed := auth.Middleware()
 
-	if conf.Server.UseCORS {
-		router.Use(CORSMiddleware(conf))
+	var consistency *ReadYourWrites
+	if conf.Database.ReadYourWrites && len(conf.Database.Replicas) > 0 {
+		consistency = NewReadYourWrites(conf.Database.ReplicaMaxLag)
 	}
 
-	authed := BasicAuthMiddleware(store)
+	redirectLimit := limiter.PerIP("redirects", func(c *cfg.Config) cfg.RateLimitPolicy { return c.RateLimit.Redirects })
+	apiLimit := limiter.PerIP("api", func(c *cfg.Config) cfg.RateLimitPolicy { return c.RateLimit.API })
+	linkCreationLimit := limiter.PerUser("link_creation", func(c *cfg.Config) cfg.RateLimitPolicy { return c.RateLimit.LinkCreation })
 
 	router.GET("/", handler.OpenHomePage())
-	router.GET("/:id", handler.OpenShortLink(globalCtx))
-	router.GET("/web", authed, ServeStaticFile(static, "static/index.html"))
+	router.GET("/:id", redirectLimit, handler.OpenShortLink(globalCtx))
+
+	loginPath := "/web/login"
+	if conf.OIDC.Enabled {
+		oidcProvider := NewOIDCProvider(globalCtx, &srv.conf, auth)
+		router.GET("/api/oidc/login", apiLimit, oidcProvider.Login())
+		router.GET("/api/oidc/callback", apiLimit, oidcProvider.Callback())
+		loginPath = oidcCookiePath + "/login"
+	}
+	router.GET("/web", auth.RedirectUnauthenticated(loginPath), authed, ServeStaticFile(static, "static/index.html"))
+	router.GET("/web/login", ServeStaticFile(static, "pages/login.html"))
+
+	router.GET("/healthz", handler.Healthz())
+	router.GET("/readyz", handler.Readyz())
 
 	router.GET("/api", handler.APIVersion())
-	api := router.Group("/api", authed)
-	api.GET("/links", handler.LinkList())
-	api.POST("/links", handler.LinkCreate())
-	api.GET("/links/:id", handler.LinkDetails())
-	api.DELETE("/links/:id", handler.LinkDelete())
-
-	apiAdmin := api.Group("", AdminFilterMiddleware())
-	apiAdmin.GET("/users", handler.UserList())
-	apiAdmin.POST("/users", handler.UserCreate())
-	apiAdmin.GET("/users/:username", handler.UserDetailsOrEdit())
-	apiAdmin.PATCH("/users/:username", handler.UserDetailsOrEdit())
-	apiAdmin.DELETE("/users/:username", handler.UserDelete())
-
-	return func() error {
-		if !conf.Server.UseTLS {
-			return router.Run(fmt.Sprintf("%s:%d", conf.Server.Host, conf.Server.Port))
+	router.POST("/api/login", apiLimit, auth.Login())
+	router.POST("/api/logout", auth.Logout())
+	api := router.Group("/api", apiLimit, authed, consistency.Middleware())
+	api.GET("/links", PermissionMiddleware(db.PermissionViewLinks), handler.LinkList())
+	api.POST("/links", PermissionMiddleware(db.PermissionCreateLinks), linkCreationLimit, handler.LinkCreate())
+	api.GET("/links/:id", PermissionMiddleware(db.PermissionViewLinks), handler.LinkDetails())
+	api.DELETE("/links/:id", PermissionMiddleware(db.PermissionDeleteLinks), handler.LinkDelete())
+	api.POST("/links/:id/transfer", PermissionMiddleware(db.PermissionDeleteLinks), handler.LinkTransfer())
+
+	manageTeams := PermissionMiddleware(db.PermissionManageTeams)
+	api.GET("/teams", PermissionMiddleware(db.PermissionViewLinks), handler.TeamList())
+	api.POST("/teams", manageTeams, handler.TeamCreate())
+	api.GET("/teams/:team", PermissionMiddleware(db.PermissionViewLinks), handler.TeamDetails())
+	api.DELETE("/teams/:team", manageTeams, handler.TeamDelete())
+	api.PUT("/teams/:team/members/:username", manageTeams, handler.TeamMemberSet())
+	api.DELETE("/teams/:team/members/:username", manageTeams, handler.TeamMemberRemove())
+
+	api.POST("/account/2fa", handler.AccountTOTPSetup())
+	api.POST("/account/2fa/confirm", handler.AccountTOTPConfirm())
+	api.DELETE("/account/2fa", handler.AccountTOTPDisable())
+	api.GET("/account/tokens", handler.AccountTokenList())
+	api.POST("/account/tokens", handler.AccountTokenCreate())
+	api.DELETE("/account/tokens/:id", handler.AccountTokenDelete())
+
+	manageUsers := PermissionMiddleware(db.PermissionManageUsers)
+	api.GET("/roles", manageUsers, handler.RoleList())
+	api.GET("/users", manageUsers, handler.UserList())
+	api.POST("/users", manageUsers, handler.UserCreate())
+	api.GET("/users/:username", manageUsers, handler.UserDetailsOrEdit())
+	api.PATCH("/users/:username", manageUsers, handler.UserDetailsOrEdit())
+	api.DELETE("/users/:username", manageUsers, handler.UserDelete())
+	api.POST("/users/:username/unlock", manageUsers, handler.UserUnlock())
+	api.GET("/users/:username/login-events", manageUsers, handler.UserLoginEvents())
+
+	if metrics != nil {
+		if conf.Server.MetricsListen == "" {
+			router.GET("/metrics", gin.WrapH(metrics.Handler(&srv.conf)))
+		} else {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler(&srv.conf))
+			srv.metricsServer = &http.Server{
+				Addr:        conf.Server.MetricsListen,
+				Handler:     mux,
+				ReadTimeout: conf.Server.ReadTimeout,
+			}
+		}
+	}
+
+	srv.handler = handler
+	srv.httpServer = &http.Server{
+		Addr:         fmt.Sprintf("%s:%d", conf.Server.Host, conf.Server.Port),
+		Handler:      router,
+		ReadTimeout:  conf.Server.ReadTimeout,
+		WriteTimeout: conf.Server.WriteTimeout,
+		IdleTimeout:  conf.Server.IdleTimeout,
+	}
+
+	if conf.Server.UseACME {
+		srv.acmeServer = &http.Server{
+			Addr:         fmt.Sprintf("%s:%d", conf.Server.Host, conf.Server.ACMEHTTPPort),
+			ReadTimeout:  conf.Server.ReadTimeout,
+			WriteTimeout: conf.Server.WriteTimeout,
+			IdleTimeout:  conf.Server.IdleTimeout,
+		}
+	}
+
+	return srv
+}
+
+func (s *Server) Serve() error {
+	var err error
+
+	if s.metricsServer != nil {
+		go func() {
+			if err := s.metricsServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("metrics server stopped", "error", err)
+			}
+		}()
+	}
+
+	conf := s.conf.Load()
+	if !conf.Server.UseTLS {
+		err = s.httpServer.ListenAndServe()
+	} else if conf.Server.UseACME {
+		err = s.serveACME(conf)
+	} else {
+		if err = s.loadCertificate(conf); err != nil {
+			return err
+		}
+		s.httpServer.TLSConfig = &tls.Config{
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return s.certificate.Load(), nil
+			},
+		}
+		err = s.httpServer.ListenAndServeTLS("", "")
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) serveACME(conf *cfg.Config) error {
+	manager, err := newACMEManager(conf)
+	if err != nil {
+		return err
+	}
+
+	s.httpServer.TLSConfig = manager.TLSConfig()
+	s.acmeServer.Handler = manager.HTTPHandler(redirectToHTTPS(conf))
+
+	errCh := make(chan error, 2)
+	go func() { errCh <- s.acmeServer.ListenAndServe() }()
+	go func() { errCh <- s.httpServer.ListenAndServeTLS("", "") }()
+
+	err = <-errCh
+	if !errors.Is(err, http.ErrServerClosed) {
+		_ = s.acmeServer.Close()
+		_ = s.httpServer.Close()
+	}
+	return err
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	var errs []error
+
+	if s.metricsServer != nil {
+		errs = append(errs, s.metricsServer.Shutdown(ctx))
+	}
+
+	if s.acmeServer != nil {
+		errs = append(errs, s.acmeServer.Shutdown(ctx))
+	}
+
+	errs = append(errs, s.httpServer.Shutdown(ctx))
+
+	return errors.Join(errs...)
+}
+
+func (s *Server) Reload(conf *cfg.Config) error {
+	if err := cfg.CheckReloadable(s.conf.Load(), conf); err != nil {
+		return err
+	}
+
+	if conf.Server.UseTLS && !conf.Server.UseACME {
+		if err := s.loadCertificate(conf); err != nil {
+			return err
 		}
-		return router.RunTLS(
-			fmt.Sprintf("%s:%d", conf.Server.Host, conf.Server.Port),
-			conf.Server.TLSCertificate,
-			conf.Server.TLSPrivateKey,
-		)
 	}
+
+	if s.handler.cache != nil {
+		s.handler.cache.Resize(conf.Server.CacheCapacity)
+	}
+
+	s.conf.Store(conf)
+
+	return nil
+}
+
+func (s *Server) loadCertificate(conf *cfg.Config) error {
+	certificate, err := tls.LoadX509KeyPair(conf.Server.TLSCertificate, conf.Server.TLSPrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+	s.certificate.Store(&certificate)
+	return nil
 }
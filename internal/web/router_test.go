@@ -0,0 +1,1070 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"github.com/salmanmorshed/intstrcodec"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
+	"github.com/salmanmorshed/simplelinkshortener/internal/db"
+)
+
+const (
+	testAlphabet = "23456789abcdefghijkmnoprstuvwxyz"
+	testPassword = "Passw0rd!xyz"
+)
+
+func TestMain(m *testing.M) {
+	cfg.Version = "v0.0.0-test"
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+type testServer struct {
+	t       *testing.T
+	conf    *cfg.Config
+	store   *db.MemoryStore
+	codec   *intstrcodec.Codec
+	server  *Server
+	handler http.Handler
+}
+
+type testResponse struct {
+	*httptest.ResponseRecorder
+}
+
+func (r testResponse) JSON(t *testing.T) map[string]any {
+	t.Helper()
+	var body map[string]any
+	if err := json.Unmarshal(r.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not a JSON object: %q", r.Body.String())
+	}
+	return body
+}
+
+func newTestConfig() *cfg.Config {
+	conf := &cfg.Config{}
+	conf.Database.Type = "memory"
+	conf.Codec.Alphabet = testAlphabet
+	conf.Codec.BlockSize = 20
+	conf.Server.Host = "127.0.0.1"
+	conf.Server.Port = 8080
+	conf.Server.UseMetrics = true
+	conf.Auth.MaxFailedAttempts = 3
+	conf.Auth.LockoutDuration = time.Minute
+	conf.Auth.SessionLifetime = time.Hour
+	return conf
+}
+
+func newTestServer(t *testing.T, configure func(*cfg.Config)) *testServer {
+	t.Helper()
+	return newTestServerWithStore(t, configure, nil)
+}
+
+func newTestServerWithStore(t *testing.T, configure func(*cfg.Config), wrap func(*db.MemoryStore) db.Store) *testServer {
+	t.Helper()
+
+	conf := newTestConfig()
+	if configure != nil {
+		configure(conf)
+	}
+
+	store, err := db.NewMemoryStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codec, err := intstrcodec.New(conf.Codec.Alphabet, conf.Codec.BlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	var wrapped db.Store = store
+	if wrap != nil {
+		wrapped = wrap(store)
+	}
+
+	srv := SetupRouter(ctx, conf, wrapped, codec)
+	ts := &testServer{t: t, conf: conf, store: store, codec: codec, server: srv, handler: srv.httpServer.Handler}
+
+	ts.addUser("admin", db.RoleAdmin)
+	ts.addUser("alice", db.RoleCreator)
+	ts.addUser("bob", db.RoleCreator)
+	ts.addUser("mod", db.RoleModerator)
+	ts.addUser("viewer", db.RoleViewer)
+
+	return ts
+}
+
+func (ts *testServer) addUser(username string, role db.Role) {
+	ts.t.Helper()
+	if _, err := ts.store.CreateUser(context.Background(), username, testPassword, role); err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+func (ts *testServer) request(method, path string, body any, prepare ...func(*http.Request)) testResponse {
+	ts.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, fn := range prepare {
+		fn(req)
+	}
+
+	rec := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+	return testResponse{rec}
+}
+
+func (ts *testServer) as(username string) func(*http.Request) {
+	return func(req *http.Request) {
+		req.SetBasicAuth(username, testPassword)
+	}
+}
+
+func withCookie(cookie *http.Cookie) func(*http.Request) {
+	return func(req *http.Request) {
+		req.AddCookie(cookie)
+	}
+}
+
+func (ts *testServer) createLink(username string, body map[string]any) string {
+	ts.t.Helper()
+	res := ts.request("POST", "/api/links", body, ts.as(username))
+	expectStatus(ts.t, res, http.StatusCreated)
+	shortURL := res.JSON(ts.t)["short_url"].(string)
+	return shortURL[strings.LastIndex(shortURL, "/")+1:]
+}
+
+func expectStatus(t *testing.T, res testResponse, status int) {
+	t.Helper()
+	if res.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, res.Code, res.Body.String())
+	}
+}
+
+func crossSiteNavigation(res testResponse) func(*http.Request) {
+	return func(req *http.Request) {
+		for _, cookie := range res.Result().Cookies() {
+			if cookie.SameSite != http.SameSiteStrictMode && cookie.MaxAge >= 0 {
+				req.AddCookie(cookie)
+			}
+		}
+	}
+}
+
+func sessionCookie(t *testing.T, res testResponse) *http.Cookie {
+	t.Helper()
+	for _, cookie := range res.Result().Cookies() {
+		if cookie.Name == sessionCookieName {
+			return cookie
+		}
+	}
+	t.Fatal("session cookie not set")
+	return nil
+}
+
+func TestPublicRoutes(t *testing.T) {
+	ts := newTestServer(t, func(conf *cfg.Config) {
+		conf.HomeRedirect = "https://example.org"
+	})
+
+	res := ts.request("GET", "/", nil)
+	expectStatus(t, res, http.StatusFound)
+	if location := res.Header().Get("Location"); location != "https://example.org" {
+		t.Errorf("unexpected home redirect %q", location)
+	}
+
+	expectStatus(t, ts.request("GET", "/healthz", nil), http.StatusOK)
+
+	res = ts.request("GET", "/readyz", nil)
+	expectStatus(t, res, http.StatusOK)
+	if status := res.JSON(t)["status"]; status != "ok" {
+		t.Errorf("unexpected readiness status %v", status)
+	}
+
+	res = ts.request("GET", "/api", nil)
+	expectStatus(t, res, http.StatusOK)
+	if version := res.JSON(t)["version"]; version != cfg.Version {
+		t.Errorf("unexpected version %v", version)
+	}
+
+	res = ts.request("GET", "/metrics", nil)
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(res.Body.String(), "simplelinkshortener_auth_failures_total") {
+		t.Error("metrics do not include authentication failures")
+	}
+}
+
+type unreachableStore struct {
+	*db.MemoryStore
+}
+
+func (unreachableStore) Ping(context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestReadinessFailsWithoutDatabase(t *testing.T) {
+	ts := newTestServerWithStore(t, func(conf *cfg.Config) {
+		conf.Server.UseCache = true
+		conf.Server.CacheCapacity = 10
+	}, func(store *db.MemoryStore) db.Store {
+		return unreachableStore{store}
+	})
+
+	expectStatus(t, ts.request("GET", "/healthz", nil), http.StatusOK)
+
+	res := ts.request("GET", "/readyz", nil)
+	expectStatus(t, res, http.StatusServiceUnavailable)
+	body := res.JSON(t)
+	if status := body["status"]; status != "unavailable" {
+		t.Errorf("unexpected readiness status %v", status)
+	}
+	checks := body["checks"].(map[string]any)
+	if checks["database"] != "connection refused" || checks["schema"] != "ok" || checks["cache"] != "ok" {
+		t.Errorf("unexpected readiness checks %v", checks)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	ts := newTestServer(t, func(conf *cfg.Config) {
+		conf.Server.UseMetrics = false
+	})
+	expectStatus(t, ts.request("GET", "/metrics", nil), http.StatusNotFound)
+
+	ts = newTestServer(t, func(conf *cfg.Config) {
+		conf.Server.MetricsListen = "127.0.0.1:0"
+	})
+	expectStatus(t, ts.request("GET", "/metrics", nil), http.StatusNotFound)
+
+	ts = newTestServer(t, func(conf *cfg.Config) {
+		conf.Server.MetricsToken = "secret"
+	})
+	res := ts.request("GET", "/metrics", nil)
+	expectStatus(t, res, http.StatusUnauthorized)
+	if challenge := res.Header().Get("WWW-Authenticate"); !strings.HasPrefix(challenge, "Bearer") {
+		t.Errorf("unexpected challenge %q", challenge)
+	}
+	expectStatus(t, ts.request("GET", "/metrics", nil, func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer wrong")
+	}), http.StatusUnauthorized)
+
+	ts.createLink("alice", map[string]any{"url": "https://go.dev"})
+	res = ts.request("GET", "/metrics", nil, func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer secret")
+	})
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(res.Body.String(), "simplelinkshortener_") {
+		t.Error("metrics do not include any application series")
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	ts := newTestServer(t, func(conf *cfg.Config) {
+		conf.HomeRedirect = "https://example.org"
+	})
+
+	expectRedirect := func(want string) {
+		t.Helper()
+		res := ts.request("GET", "/", nil)
+		expectStatus(t, res, http.StatusFound)
+		if location := res.Header().Get("Location"); location != want {
+			t.Errorf("expected home redirect %q, got %q", want, location)
+		}
+	}
+
+	accepted := *ts.conf
+	accepted.HomeRedirect = "https://example.com"
+	if err := ts.server.Reload(&accepted); err != nil {
+		t.Fatalf("reload of a reloadable field was rejected: %v", err)
+	}
+	expectRedirect("https://example.com")
+
+	rejected := accepted
+	rejected.HomeRedirect = "https://example.net"
+	rejected.Server.Port = 9090
+	err := ts.server.Reload(&rejected)
+	if err == nil || !strings.Contains(err.Error(), "server.port") {
+		t.Fatalf("expected the server.port change to be rejected, got %v", err)
+	}
+	expectRedirect("https://example.com")
+}
+
+func TestShortLinkRedirect(t *testing.T) {
+	for _, useCache := range []bool{false, true} {
+		t.Run(fmt.Sprintf("cache=%v", useCache), func(t *testing.T) {
+			ts := newTestServer(t, func(conf *cfg.Config) {
+				conf.Server.UseCache = useCache
+				conf.Server.CacheCapacity = 10
+			})
+
+			id := ts.createLink("alice", map[string]any{"url": "https://go.dev"})
+
+			res := ts.request("GET", "/"+id, nil)
+			expectStatus(t, res, http.StatusMovedPermanently)
+			if location := res.Header().Get("Location"); location != "https://go.dev" {
+				t.Errorf("unexpected redirect %q", location)
+			}
+
+			expectStatus(t, ts.request("GET", "/"+ts.codec.Encode(999), nil), http.StatusNotFound)
+
+			if !useCache {
+				link, err := ts.store.RetrieveLink(context.Background(), uint(ts.codec.Decode(id)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if link.Visits != 1 {
+					t.Errorf("expected 1 visit, got %d", link.Visits)
+				}
+			}
+		})
+	}
+}
+
+func TestWebUI(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	res := ts.request("GET", "/web", nil)
+	expectStatus(t, res, http.StatusFound)
+	if location := res.Header().Get("Location"); !strings.HasSuffix(location, "/web/login") {
+		t.Errorf("unexpected redirect to %q", location)
+	}
+
+	res = ts.request("GET", "/web/login", nil)
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(res.Body.String(), `name="code"`) {
+		t.Error("login page has no two-factor code field")
+	}
+	embedded, err := fs.ReadFile(efs, "pages/login.html")
+	if err != nil {
+		t.Fatalf("login page is not embedded: %v", err)
+	}
+	if res.Body.String() != string(embedded) {
+		t.Error("login page was not served from the embedded files")
+	}
+
+	res = ts.request("GET", "/web", nil, ts.as("alice"))
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(res.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("unexpected content type %q", res.Header().Get("Content-Type"))
+	}
+
+	res = ts.request("POST", "/api/account/2fa", nil, ts.as("alice"))
+	expectStatus(t, res, http.StatusOK)
+	code, err := totp.GenerateCode(res.JSON(t)["secret"].(string), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, ts.request("POST", "/api/account/2fa/confirm", map[string]any{"code": code}, ts.as("alice")), http.StatusOK)
+	expectStatus(t, ts.request("GET", "/web", nil, ts.as("alice")), http.StatusUnauthorized)
+
+	res = ts.request("POST", "/api/login", map[string]any{"username": "alice", "password": testPassword, "code": code})
+	expectStatus(t, res, http.StatusOK)
+	expectStatus(t, ts.request("GET", "/web", nil, withCookie(sessionCookie(t, res))), http.StatusOK)
+}
+
+func TestLoginAndLogout(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	expectStatus(t, ts.request("POST", "/api/login", map[string]any{"username": "alice"}), http.StatusBadRequest)
+
+	res := ts.request("POST", "/api/login", map[string]any{"username": "alice", "password": "wrong"})
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	res = ts.request("POST", "/api/login", map[string]any{"username": "alice", "password": testPassword})
+	expectStatus(t, res, http.StatusOK)
+	if role := res.JSON(t)["role"]; role != string(db.RoleCreator) {
+		t.Errorf("unexpected role %v", role)
+	}
+	cookie := sessionCookie(t, res)
+
+	expectStatus(t, ts.request("GET", "/api/links", nil, withCookie(cookie)), http.StatusOK)
+	expectStatus(t, ts.request("POST", "/api/logout", nil, withCookie(cookie)), http.StatusNoContent)
+	expectStatus(t, ts.request("GET", "/api/links", nil, withCookie(cookie)), http.StatusUnauthorized)
+}
+
+func TestLinkRoutes(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	expectStatus(t, ts.request("GET", "/api/links", nil), http.StatusUnauthorized)
+	expectStatus(t, ts.request("POST", "/api/links", map[string]any{}, ts.as("alice")), http.StatusBadRequest)
+	expectStatus(t, ts.request("POST", "/api/links", map[string]any{"url": "https://a.example"}, ts.as("viewer")), http.StatusForbidden)
+
+	first := ts.createLink("alice", map[string]any{"url": "https://a.example"})
+	second := ts.createLink("alice", map[string]any{"url": "https://b.example"})
+	ts.createLink("bob", map[string]any{"url": "https://c.example"})
+
+	res := ts.request("GET", "/api/links?limit=1", nil, ts.as("alice"))
+	expectStatus(t, res, http.StatusOK)
+	body := res.JSON(t)
+	if body["total"] != float64(2) {
+		t.Errorf("expected 2 links, got %v", body["total"])
+	}
+	results := body["results"].([]any)
+	if len(results) != 1 || results[0].(map[string]any)["id"] != second {
+		t.Errorf("expected newest link first, got %v", results)
+	}
+
+	expectStatus(t, ts.request("GET", "/api/links?limit=0", nil, ts.as("alice")), http.StatusBadRequest)
+	expectStatus(t, ts.request("GET", "/api/links?offset=5", nil, ts.as("alice")), http.StatusBadRequest)
+	expectStatus(t, ts.request("GET", "/api/links?created_by=bob", nil, ts.as("alice")), http.StatusForbidden)
+	expectStatus(t, ts.request("GET", "/api/links?created_by=alice", nil, ts.as("mod")), http.StatusOK)
+
+	res = ts.request("GET", "/api/links/"+first, nil, ts.as("alice"))
+	expectStatus(t, res, http.StatusOK)
+	if createdBy := res.JSON(t)["created_by"]; createdBy != "alice" {
+		t.Errorf("unexpected creator %v", createdBy)
+	}
+	expectStatus(t, ts.request("GET", "/api/links/"+first, nil, ts.as("bob")), http.StatusForbidden)
+	expectStatus(t, ts.request("GET", "/api/links/"+ts.codec.Encode(999), nil, ts.as("alice")), http.StatusNotFound)
+
+	expectStatus(t, ts.request("POST", "/api/links/"+first+"/transfer", map[string]any{}, ts.as("alice")), http.StatusBadRequest)
+	expectStatus(t, ts.request("POST", "/api/links/"+first+"/transfer", map[string]any{"user": "bob"}, ts.as("bob")), http.StatusForbidden)
+	expectStatus(t, ts.request("POST", "/api/links/"+first+"/transfer", map[string]any{"user": "bob"}, ts.as("alice")), http.StatusForbidden)
+	expectStatus(t, ts.request("POST", "/api/links/"+first+"/transfer", map[string]any{"user": "nobody"}, ts.as("mod")), http.StatusNotFound)
+	expectStatus(t, ts.request("POST", "/api/links/"+first+"/transfer", map[string]any{"user": "bob"}, ts.as("mod")), http.StatusNoContent)
+	expectStatus(t, ts.request("GET", "/api/links/"+first, nil, ts.as("bob")), http.StatusOK)
+
+	expectStatus(t, ts.request("DELETE", "/api/links/"+second, nil, ts.as("bob")), http.StatusForbidden)
+	expectStatus(t, ts.request("DELETE", "/api/links/"+second, nil, ts.as("alice")), http.StatusNoContent)
+	expectStatus(t, ts.request("GET", "/api/links/"+second, nil, ts.as("alice")), http.StatusNotFound)
+	expectStatus(t, ts.request("DELETE", "/api/links/"+first, nil, ts.as("mod")), http.StatusNoContent)
+}
+
+func TestTeamRoutes(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	expectStatus(t, ts.request("POST", "/api/teams", map[string]any{}, ts.as("alice")), http.StatusBadRequest)
+	expectStatus(t, ts.request("POST", "/api/teams", map[string]any{"name": "readers"}, ts.as("viewer")), http.StatusForbidden)
+
+	res := ts.request("POST", "/api/teams", map[string]any{"name": "marketing"}, ts.as("alice"))
+	expectStatus(t, res, http.StatusCreated)
+	expectStatus(t, ts.request("POST", "/api/teams", map[string]any{"name": "marketing"}, ts.as("bob")), http.StatusBadRequest)
+
+	res = ts.request("GET", "/api/teams", nil, ts.as("alice"))
+	expectStatus(t, res, http.StatusOK)
+	if results := res.JSON(t)["results"].([]any); len(results) != 1 {
+		t.Errorf("expected 1 team, got %d", len(results))
+	}
+
+	expectStatus(t, ts.request("GET", "/api/teams/marketing", nil, ts.as("bob")), http.StatusNotFound)
+	expectStatus(t, ts.request("PUT", "/api/teams/marketing/members/bob", map[string]any{"role": "editor"}, ts.as("bob")), http.StatusNotFound)
+	expectStatus(t, ts.request("PUT", "/api/teams/marketing/members/bob", map[string]any{"role": "boss"}, ts.as("alice")), http.StatusBadRequest)
+	expectStatus(t, ts.request("PUT", "/api/teams/marketing/members/nobody", map[string]any{"role": "editor"}, ts.as("alice")), http.StatusNotFound)
+	expectStatus(t, ts.request("PUT", "/api/teams/marketing/members/bob", map[string]any{"role": "editor"}, ts.as("alice")), http.StatusOK)
+	expectStatus(t, ts.request("PUT", "/api/teams/marketing/members/alice", map[string]any{"role": "editor"}, ts.as("alice")), http.StatusConflict)
+
+	res = ts.request("GET", "/api/teams/marketing", nil, ts.as("bob"))
+	expectStatus(t, res, http.StatusOK)
+	if members := res.JSON(t)["members"].([]any); len(members) != 2 {
+		t.Errorf("expected 2 members, got %d", len(members))
+	}
+
+	id := ts.createLink("bob", map[string]any{"url": "https://team.example", "team": "marketing"})
+	res = ts.request("GET", "/api/links?team=marketing", nil, ts.as("alice"))
+	expectStatus(t, res, http.StatusOK)
+	if total := res.JSON(t)["total"]; total != float64(1) {
+		t.Errorf("expected 1 team link, got %v", total)
+	}
+
+	expectStatus(t, ts.request("DELETE", "/api/teams/marketing", nil, ts.as("bob")), http.StatusForbidden)
+	expectStatus(t, ts.request("DELETE", "/api/teams/marketing", nil, ts.as("alice")), http.StatusConflict)
+	expectStatus(t, ts.request("DELETE", "/api/teams/marketing", nil, ts.as("viewer")), http.StatusForbidden)
+	expectStatus(t, ts.request("POST", "/api/links/"+id+"/transfer", map[string]any{"user": "bob"}, ts.as("alice")), http.StatusForbidden)
+	expectStatus(t, ts.request("POST", "/api/links/"+id+"/transfer", map[string]any{"user": "alice"}, ts.as("alice")), http.StatusNoContent)
+
+	expectStatus(t, ts.request("DELETE", "/api/teams/marketing/members/alice", nil, ts.as("alice")), http.StatusConflict)
+	expectStatus(t, ts.request("DELETE", "/api/teams/marketing/members/bob", nil, ts.as("bob")), http.StatusNoContent)
+	expectStatus(t, ts.request("DELETE", "/api/teams/marketing", nil, ts.as("alice")), http.StatusNoContent)
+	expectStatus(t, ts.request("GET", "/api/teams/marketing", nil, ts.as("alice")), http.StatusNotFound)
+}
+
+func TestAccountTwoFactorRoutes(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	res := ts.request("POST", "/api/account/2fa", nil, ts.as("alice"))
+	expectStatus(t, res, http.StatusOK)
+	secret := res.JSON(t)["secret"].(string)
+
+	expectStatus(t, ts.request("POST", "/api/account/2fa/confirm", map[string]any{"code": "000000"}, ts.as("alice")), http.StatusBadRequest)
+
+	code, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = ts.request("POST", "/api/account/2fa/confirm", map[string]any{"code": code}, ts.as("alice"))
+	expectStatus(t, res, http.StatusOK)
+	recoveryCodes := res.JSON(t)["recovery_codes"].([]any)
+	if len(recoveryCodes) != 10 {
+		t.Fatalf("expected 10 recovery codes, got %d", len(recoveryCodes))
+	}
+
+	res = ts.request("GET", "/api/links", nil, ts.as("alice"))
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	res = ts.request("POST", "/api/login", map[string]any{"username": "alice", "password": testPassword})
+	expectStatus(t, res, http.StatusUnauthorized)
+	if required := res.JSON(t)["two_factor_required"]; required != true {
+		t.Error("expected two_factor_required")
+	}
+
+	res = ts.request("POST", "/api/login", map[string]any{
+		"username": "alice", "password": testPassword, "code": recoveryCodes[0],
+	})
+	expectStatus(t, res, http.StatusOK)
+	cookie := sessionCookie(t, res)
+
+	expectStatus(t, ts.request("DELETE", "/api/account/2fa", map[string]any{"code": recoveryCodes[0]}, withCookie(cookie)), http.StatusBadRequest)
+	expectStatus(t, ts.request("DELETE", "/api/account/2fa", map[string]any{"code": recoveryCodes[1]}, withCookie(cookie)), http.StatusNoContent)
+	expectStatus(t, ts.request("GET", "/api/links", nil, ts.as("alice")), http.StatusOK)
+}
+
+func TestAccountTokenRoutes(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	expectStatus(t, ts.request("POST", "/api/account/tokens", map[string]any{}, ts.as("alice")), http.StatusBadRequest)
+
+	res := ts.request("POST", "/api/account/tokens", map[string]any{"name": "ci"}, ts.as("alice"))
+	expectStatus(t, res, http.StatusCreated)
+	created := res.JSON(t)
+	token := created["token"].(string)
+	id := fmt.Sprint(created["id"])
+
+	withToken := func(req *http.Request) { req.SetBasicAuth("alice", token) }
+	expectStatus(t, ts.request("GET", "/api/links", nil, withToken), http.StatusOK)
+	expectStatus(t, ts.request("GET", "/api/links", nil, func(req *http.Request) { req.SetBasicAuth("bob", token) }), http.StatusUnauthorized)
+
+	res = ts.request("GET", "/api/account/tokens", nil, ts.as("alice"))
+	expectStatus(t, res, http.StatusOK)
+	results := res.JSON(t)["results"].([]any)
+	if len(results) != 1 || results[0].(map[string]any)["last_used_at"] == nil {
+		t.Errorf("expected one used token, got %v", results)
+	}
+
+	expectStatus(t, ts.request("DELETE", "/api/account/tokens/"+id, nil, ts.as("bob")), http.StatusNotFound)
+	expectStatus(t, ts.request("DELETE", "/api/account/tokens/"+id, nil, ts.as("alice")), http.StatusNoContent)
+	expectStatus(t, ts.request("GET", "/api/links", nil, withToken), http.StatusUnauthorized)
+}
+
+func TestUserManagementRoutes(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	expectStatus(t, ts.request("GET", "/api/users", nil, ts.as("alice")), http.StatusForbidden)
+
+	res := ts.request("GET", "/api/roles", nil, ts.as("admin"))
+	expectStatus(t, res, http.StatusOK)
+	if results := res.JSON(t)["results"].([]any); len(results) != len(db.Roles) {
+		t.Errorf("expected %d roles, got %d", len(db.Roles), len(results))
+	}
+
+	res = ts.request("GET", "/api/users", nil, ts.as("admin"))
+	expectStatus(t, res, http.StatusOK)
+	if results := res.JSON(t)["results"].([]any); len(results) != 5 {
+		t.Errorf("expected 5 users, got %d", len(results))
+	}
+
+	expectStatus(t, ts.request("POST", "/api/users", map[string]any{"username": "carol"}, ts.as("admin")), http.StatusBadRequest)
+	res = ts.request("POST", "/api/users", map[string]any{"username": "carol", "password": testPassword, "role": "viewer"}, ts.as("admin"))
+	expectStatus(t, res, http.StatusCreated)
+	if role := res.JSON(t)["role"]; role != string(db.RoleViewer) {
+		t.Errorf("unexpected role %v", role)
+	}
+
+	res = ts.request("GET", "/api/users/carol", nil, ts.as("admin"))
+	expectStatus(t, res, http.StatusOK)
+	expectStatus(t, ts.request("GET", "/api/users/nobody", nil, ts.as("admin")), http.StatusNotFound)
+
+	res = ts.request("PATCH", "/api/users/carol", map[string]any{"username": "caroline", "role": "creator"}, ts.as("admin"))
+	expectStatus(t, res, http.StatusOK)
+	if body := res.JSON(t); body["username"] != "caroline" || body["role"] != string(db.RoleCreator) {
+		t.Errorf("unexpected user %v", body)
+	}
+	expectStatus(t, ts.request("PATCH", "/api/users/admin", map[string]any{"role": "viewer"}, ts.as("admin")), http.StatusForbidden)
+
+	for range 3 {
+		ts.request("GET", "/api/links", nil, func(req *http.Request) { req.SetBasicAuth("caroline", "wrong") })
+	}
+	expectStatus(t, ts.request("GET", "/api/links", nil, ts.as("caroline")), http.StatusUnauthorized)
+
+	res = ts.request("GET", "/api/users/caroline/login-events", nil, ts.as("admin"))
+	expectStatus(t, res, http.StatusOK)
+	if results := res.JSON(t)["results"].([]any); len(results) != 4 {
+		t.Errorf("expected 4 login events, got %d", len(results))
+	}
+
+	expectStatus(t, ts.request("POST", "/api/users/caroline/unlock", nil, ts.as("admin")), http.StatusNoContent)
+	id := ts.createLink("caroline", map[string]any{"url": "https://caroline.example"})
+
+	expectStatus(t, ts.request("DELETE", "/api/users/admin", nil, ts.as("admin")), http.StatusForbidden)
+	expectStatus(t, ts.request("DELETE", "/api/users/caroline", nil, ts.as("admin")), http.StatusConflict)
+	expectStatus(t, ts.request("DELETE", "/api/users/caroline?reassign_to=bob", nil, ts.as("admin")), http.StatusNoContent)
+	expectStatus(t, ts.request("GET", "/api/users/caroline", nil, ts.as("admin")), http.StatusNotFound)
+
+	res = ts.request("GET", "/api/links/"+id, nil, ts.as("bob"))
+	expectStatus(t, res, http.StatusOK)
+	if createdBy := res.JSON(t)["created_by"]; createdBy != "bob" {
+		t.Errorf("unexpected creator %v", createdBy)
+	}
+}
+
+type mockIDP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	claims map[string]any
+}
+
+func newMockIDP(t *testing.T) *mockIDP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &mockIDP{key: key}
+	idp.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"issuer":                                idp.URL,
+				"authorization_endpoint":                idp.URL + "/authorize",
+				"token_endpoint":                        idp.URL + "/token",
+				"jwks_uri":                              idp.URL + "/keys",
+				"id_token_signing_alg_values_supported": []string{"RS256"},
+			})
+		case "/keys":
+			_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]any{{
+				"kty": "RSA",
+				"kid": "test",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}}})
+		case "/token":
+			idp.mu.Lock()
+			claims := idp.claims
+			idp.mu.Unlock()
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "access",
+				"token_type":   "Bearer",
+				"expires_in":   3600,
+				"id_token":     idp.sign(t, claims),
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(idp.Close)
+
+	return idp
+}
+
+func (idp *mockIDP) sign(t *testing.T, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]any{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Error(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (idp *mockIDP) login(ts *testServer, claims map[string]any) testResponse {
+	ts.t.Helper()
+
+	res := ts.request("GET", "/api/oidc/login", nil)
+	expectStatus(ts.t, res, http.StatusFound)
+	location, err := url.Parse(res.Header().Get("Location"))
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	issued := map[string]any{
+		"iss":   idp.URL,
+		"aud":   "shortener",
+		"nonce": location.Query().Get("nonce"),
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}
+	for k, v := range claims {
+		issued[k] = v
+	}
+	idp.mu.Lock()
+	idp.claims = issued
+	idp.mu.Unlock()
+
+	var stateCookie *http.Cookie
+	for _, cookie := range res.Result().Cookies() {
+		if cookie.Name == oidcStateCookieName {
+			stateCookie = cookie
+		}
+	}
+	if stateCookie == nil {
+		ts.t.Fatal("state cookie not set")
+	}
+
+	return ts.request("GET", "/api/oidc/callback?code=code&state="+location.Query().Get("state"), nil, withCookie(stateCookie))
+}
+
+func newOIDCTestServer(t *testing.T, idp *mockIDP, configure func(*cfg.Config)) *testServer {
+	return newTestServer(t, func(conf *cfg.Config) {
+		conf.OIDC.Enabled = true
+		conf.OIDC.IssuerURL = idp.URL
+		conf.OIDC.ClientID = "shortener"
+		conf.OIDC.Scopes = []string{"openid"}
+		conf.OIDC.UsernameClaim = "preferred_username"
+		conf.OIDC.GroupsClaim = "groups"
+		conf.OIDC.AdminGroups = []string{"link-admins"}
+		if configure != nil {
+			configure(conf)
+		}
+	})
+}
+
+func TestOIDCRoutes(t *testing.T) {
+	idp := newMockIDP(t)
+	ts := newOIDCTestServer(t, idp, nil)
+
+	res := ts.request("GET", "/web", nil)
+	expectStatus(t, res, http.StatusFound)
+	if location := res.Header().Get("Location"); !strings.HasSuffix(location, "/api/oidc/login") {
+		t.Errorf("unexpected redirect %q", location)
+	}
+
+	res = ts.request("GET", "/api/oidc/login", nil)
+	expectStatus(t, res, http.StatusFound)
+	location, err := url.Parse(res.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), idp.URL+"/authorize") {
+		t.Errorf("unexpected redirect %q", location)
+	}
+	if location.Query().Get("code_challenge_method") != "S256" || location.Query().Get("state") == "" {
+		t.Errorf("authorization request is missing PKCE or state: %q", location)
+	}
+
+	var stateCookie *http.Cookie
+	for _, cookie := range res.Result().Cookies() {
+		if cookie.Name == oidcStateCookieName {
+			stateCookie = cookie
+		}
+	}
+	if stateCookie == nil {
+		t.Fatal("state cookie not set")
+	}
+
+	expectStatus(t, ts.request("GET", "/api/oidc/callback?state=forged&code=x", nil, withCookie(stateCookie)), http.StatusBadRequest)
+	expectStatus(t, ts.request("GET", "/api/oidc/callback?state="+location.Query().Get("state")+"&error=access_denied", nil,
+		withCookie(stateCookie)), http.StatusUnauthorized)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newMockIDP(t)
+	ts := newOIDCTestServer(t, idp, nil)
+
+	res := idp.login(ts, map[string]any{"sub": "u-1", "preferred_username": "carol"})
+	expectStatus(t, res, http.StatusFound)
+	if location := res.Header().Get("Location"); !strings.HasSuffix(location, "/web") {
+		t.Errorf("unexpected redirect %q", location)
+	}
+	expectStatus(t, ts.request("GET", "/api/links", nil, withCookie(sessionCookie(t, res))), http.StatusOK)
+
+	carol, err := ts.store.RetrieveUser(context.Background(), "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if carol.Role != db.DefaultRole || carol.OIDCIssuer == nil || *carol.OIDCIssuer != idp.URL || *carol.OIDCSubject != "u-1" {
+		t.Errorf("unexpected provisioned user %+v", carol)
+	}
+
+	res = idp.login(ts, map[string]any{"sub": "u-1", "preferred_username": "renamed"})
+	expectStatus(t, res, http.StatusFound)
+	sessionCookie(t, res)
+	if _, err = ts.store.RetrieveUser(context.Background(), "renamed"); err == nil {
+		t.Error("a changed username claim provisioned a second account")
+	}
+
+	res = idp.login(ts, map[string]any{"sub": "u-1", "preferred_username": "carol", "nonce": "forged"})
+	expectStatus(t, res, http.StatusUnauthorized)
+	if message := res.JSON(t)["error"]; message != "invalid id token nonce" {
+		t.Errorf("unexpected error %v", message)
+	}
+
+	res = idp.login(ts, map[string]any{"sub": "u-1", "preferred_username": "carol", "aud": "another-client"})
+	expectStatus(t, res, http.StatusUnauthorized)
+	if message := res.JSON(t)["error"]; message != "invalid id token" {
+		t.Errorf("unexpected error %v", message)
+	}
+
+	expectStatus(t, idp.login(ts, map[string]any{"sub": "u-2", "preferred_username": "alice"}), http.StatusForbidden)
+	expectStatus(t, idp.login(ts, map[string]any{"sub": "u-3", "preferred_username": "admin"}), http.StatusForbidden)
+	if admin, _ := ts.store.RetrieveUser(context.Background(), "admin"); admin.Role != db.RoleAdmin || admin.OIDCIssuer != nil {
+		t.Errorf("local admin was modified by an oidc login: %+v", admin)
+	}
+}
+
+func TestOIDCLoginRedirectKeepsSession(t *testing.T) {
+	idp := newMockIDP(t)
+	ts := newOIDCTestServer(t, idp, nil)
+
+	res := idp.login(ts, map[string]any{"sub": "u-1", "preferred_username": "carol"})
+	expectStatus(t, res, http.StatusFound)
+	location, err := url.Parse(res.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res = ts.request("GET", location.Path, nil, crossSiteNavigation(res))
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(res.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("unexpected content type %q", res.Header().Get("Content-Type"))
+	}
+}
+
+func TestOIDCAdminGroups(t *testing.T) {
+	idp := newMockIDP(t)
+	ts := newOIDCTestServer(t, idp, nil)
+
+	role := func(username string) db.Role {
+		user, err := ts.store.RetrieveUser(context.Background(), username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user.Role
+	}
+
+	expectStatus(t, idp.login(ts, map[string]any{"sub": "u-1", "preferred_username": "dave", "groups": []string{"link-admins"}}), http.StatusFound)
+	if got := role("dave"); got != db.RoleAdmin {
+		t.Errorf("expected admin, got %s", got)
+	}
+
+	expectStatus(t, idp.login(ts, map[string]any{"sub": "u-1", "preferred_username": "dave", "groups": []string{"staff"}}), http.StatusFound)
+	if got := role("dave"); got != db.DefaultRole {
+		t.Errorf("expected %s after leaving the admin group, got %s", db.DefaultRole, got)
+	}
+
+	expectStatus(t, idp.login(ts, map[string]any{"sub": "u-1", "preferred_username": "dave", "groups": "link-admins"}), http.StatusFound)
+	if got := role("dave"); got != db.RoleAdmin {
+		t.Errorf("expected a single group claim to grant admin, got %s", got)
+	}
+}
+
+func TestOIDCLinkExisting(t *testing.T) {
+	idp := newMockIDP(t)
+	ts := newOIDCTestServer(t, idp, func(conf *cfg.Config) {
+		conf.OIDC.LinkExisting = true
+	})
+
+	expectStatus(t, idp.login(ts, map[string]any{"sub": "u-1", "preferred_username": "alice"}), http.StatusFound)
+	alice, _ := ts.store.RetrieveUser(context.Background(), "alice")
+	if alice.OIDCSubject == nil || *alice.OIDCSubject != "u-1" {
+		t.Errorf("existing account was not linked: %+v", alice)
+	}
+	expectStatus(t, ts.request("GET", "/api/links", nil, ts.as("alice")), http.StatusOK)
+
+	expectStatus(t, idp.login(ts, map[string]any{"sub": "u-1", "preferred_username": "alice"}), http.StatusFound)
+	expectStatus(t, idp.login(ts, map[string]any{"sub": "u-2", "preferred_username": "alice"}), http.StatusForbidden)
+}
+
+func TestConcurrentAuthFailuresAreLimited(t *testing.T) {
+	policy := cfg.RateLimitPolicy{Requests: 3, Period: time.Hour}
+	ts := newTestServer(t, func(conf *cfg.Config) {
+		conf.RateLimit.Enabled = true
+		conf.RateLimit.AuthFailures = policy
+		conf.Auth.MaxFailedAttempts = 100
+	})
+
+	const attempts = 20
+	statuses := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := ts.request("POST", "/api/login", map[string]any{"username": "alice", "password": "wrong"})
+			statuses <- res.Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	checked, limited := 0, 0
+	for status := range statuses {
+		switch status {
+		case http.StatusUnauthorized:
+			checked++
+		case http.StatusTooManyRequests:
+			limited++
+		default:
+			t.Errorf("unexpected status %d", status)
+		}
+	}
+	if checked > int(policy.Requests) {
+		t.Errorf("expected at most %d password checks, got %d", policy.Requests, checked)
+	}
+	if checked+limited != attempts {
+		t.Errorf("expected %d responses, got %d", attempts, checked+limited)
+	}
+
+	res := ts.request("POST", "/api/login", map[string]any{"username": "alice", "password": testPassword})
+	expectStatus(t, res, http.StatusTooManyRequests)
+}
+
+func TestConcurrentLoginFailuresAreLocked(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	const attempts = 20
+	responses := make(chan testResponse, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses <- ts.request("POST", "/api/login", map[string]any{"username": "alice", "password": "wrong"})
+		}()
+	}
+	wg.Wait()
+	close(responses)
+
+	checked := 0
+	for res := range responses {
+		expectStatus(t, res, http.StatusUnauthorized)
+		if res.JSON(t)["error"] == "incorrect username and/or password" {
+			checked++
+		}
+	}
+	if checked > 3 {
+		t.Errorf("expected at most 3 password checks, got %d", checked)
+	}
+
+	res := ts.request("POST", "/api/login", map[string]any{"username": "alice", "password": testPassword})
+	expectStatus(t, res, http.StatusUnauthorized)
+	if message := res.JSON(t)["error"]; message != "account is temporarily locked" {
+		t.Errorf("unexpected error %v", message)
+	}
+}
+
+func TestTwoStepLoginDoesNotCountAsFailure(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	res := ts.request("POST", "/api/account/2fa", nil, ts.as("alice"))
+	expectStatus(t, res, http.StatusOK)
+	secret := res.JSON(t)["secret"].(string)
+	code, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, ts.request("POST", "/api/account/2fa/confirm", map[string]any{"code": code}, ts.as("alice")), http.StatusOK)
+
+	expectStatus(t, ts.request("POST", "/api/login", map[string]any{"username": "alice", "password": "wrong"}), http.StatusUnauthorized)
+	for i := 0; i < 5; i++ {
+		res = ts.request("POST", "/api/login", map[string]any{"username": "alice", "password": testPassword})
+		expectStatus(t, res, http.StatusUnauthorized)
+		if required := res.JSON(t)["two_factor_required"]; required != true {
+			t.Fatalf("attempt %d: expected two_factor_required, got %s", i+1, res.Body.String())
+		}
+	}
+
+	user, err := ts.store.RetrieveUser(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.FailedAttempts != 1 || user.IsLocked() {
+		t.Errorf("expected only the wrong password to count, got %d failed attempts", user.FailedAttempts)
+	}
+
+	expectStatus(t, ts.request("POST", "/api/login", map[string]any{"username": "alice", "password": testPassword, "code": code}), http.StatusOK)
+}
+
+func TestSuccessfulLoginsRefundAuthBudget(t *testing.T) {
+	ts := newTestServer(t, func(conf *cfg.Config) {
+		conf.RateLimit.Enabled = true
+		conf.RateLimit.AuthFailures = cfg.RateLimitPolicy{Requests: 2, Period: time.Hour}
+	})
+
+	for i := 0; i < 5; i++ {
+		expectStatus(t, ts.request("GET", "/api/links", nil, ts.as("alice")), http.StatusOK)
+	}
+	expectStatus(t, ts.request("GET", "/api/links", nil, func(req *http.Request) { req.SetBasicAuth("alice", "wrong") }), http.StatusUnauthorized)
+	expectStatus(t, ts.request("GET", "/api/links", nil, ts.as("alice")), http.StatusOK)
+}
+
+type stuckVisitStore struct {
+	db.Store
+}
+
+func (stuckVisitStore) IncrementVisits(ctx context.Context, _ uint, _ uint) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestVisitFlushTimesOut(t *testing.T) {
+	conf := newTestConfig()
+	conf.Database.QueryTimeout = 50 * time.Millisecond
+	var current atomic.Pointer[cfg.Config]
+	current.Store(conf)
+	h := &Handler{Conf: &current, Store: stuckVisitStore{}}
+
+	page := &Page{LinkID: 1, NewVisits: 3}
+	done := make(chan struct{})
+	go func() {
+		h.flushVisits(context.Background(), page)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("visit flush did not give up on a stuck database")
+	}
+	if page.NewVisits != 0 {
+		t.Errorf("expected the timed out batch to be dropped, %d visits left", page.NewVisits)
+	}
+}
@@ -12,7 +12,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-//go:embed static/*
+//go:embed static/* pages/*
 var efs embed.FS
 
 func ServeStaticFile(fs fs.FS, relPath string) gin.HandlerFunc {
@@ -0,0 +1,242 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/salmanmorshed/simplelinkshortener/internal/db"
+)
+
+func (h *Handler) TeamList() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(*db.User)
+
+		teams, err := h.Store.RetrieveTeamsForUser(c, user.Username)
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		results := make([]gin.H, len(teams))
+		for i := range teams {
+			results[i] = serializeTeam(&teams[i])
+			if member, err := h.Store.RetrieveTeamMember(c, teams[i].ID, user.Username); err == nil {
+				results[i]["role"] = member.Role
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"results": results})
+	}
+}
+
+func (h *Handler) TeamCreate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(*db.User)
+
+		var data struct {
+			Name string `json:"name" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			abortWithError(c, http.StatusBadRequest, "name is required")
+			return
+		}
+
+		if err := db.CheckTeamNameValidity(data.Name); err != nil {
+			abortWithError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		team, err := h.Store.CreateTeam(c, data.Name, user.Username)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusCreated, serializeTeam(team))
+	}
+}
+
+func (h *Handler) TeamDetails() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		team, _, canView := h.teamAccess(c, c.MustGet("user").(*db.User), c.Param("team"))
+		if !canView {
+			abortWithError(c, http.StatusNotFound, "team not found")
+			return
+		}
+
+		members, err := h.Store.RetrieveTeamMembers(c, team.ID)
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		memberResults := make([]gin.H, len(members))
+		for i, member := range members {
+			memberResults[i] = gin.H{
+				"username":   member.Username,
+				"role":       member.Role,
+				"created_at": member.CreatedAt,
+			}
+		}
+
+		result := serializeTeam(team)
+		result["members"] = memberResults
+		result["link_count"] = h.Store.GetLinkCountForTeam(c, team.ID)
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *Handler) TeamDelete() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		team, ok := h.requireTeamManager(c)
+		if !ok {
+			return
+		}
+
+		if count := h.Store.GetLinkCountForTeam(c, team.ID); count > 0 {
+			abortWithError(c, http.StatusConflict, "team still owns links, transfer them first")
+			return
+		}
+
+		if err := h.Store.DeleteTeam(c, team.ID); err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) TeamMemberSet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		team, ok := h.requireTeamManager(c)
+		if !ok {
+			return
+		}
+
+		var data struct {
+			Role string `json:"role" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			abortWithError(c, http.StatusBadRequest, "role is required")
+			return
+		}
+
+		role, err := db.ParseTeamRole(data.Role)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		target, err := h.Store.RetrieveUser(c, c.Param("username"))
+		if err != nil {
+			abortWithError(c, http.StatusNotFound, "user not found")
+			return
+		}
+
+		if role != db.TeamRoleOwner && h.isLastTeamOwner(c, team, target.Username) {
+			abortWithError(c, http.StatusConflict, "a team must keep at least one owner")
+			return
+		}
+
+		if err := h.Store.SetTeamMember(c, team.ID, target.Username, role); err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"username": target.Username,
+			"role":     role,
+		})
+	}
+}
+
+func (h *Handler) TeamMemberRemove() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(*db.User)
+		username := c.Param("username")
+
+		team, member, canView := h.teamAccess(c, user, c.Param("team"))
+		if !canView {
+			abortWithError(c, http.StatusNotFound, "team not found")
+			return
+		}
+
+		isSelf := member != nil && username == user.Username
+		if !isSelf && !canManageTeam(user, member) {
+			abortWithError(c, http.StatusForbidden, "permission denied")
+			return
+		}
+
+		if h.isLastTeamOwner(c, team, username) {
+			abortWithError(c, http.StatusConflict, "a team must keep at least one owner")
+			return
+		}
+
+		if err := h.Store.RemoveTeamMember(c, team.ID, username); err != nil {
+			abortWithError(c, http.StatusNotFound, err.Error())
+			return
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) teamAccess(c *gin.Context, user *db.User, name string) (*db.Team, *db.TeamMember, bool) {
+	team, err := h.Store.RetrieveTeam(c, name)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	member, err := h.Store.RetrieveTeamMember(c, team.ID, user.Username)
+	if err != nil {
+		return team, nil, user.Can(db.PermissionModerateLinks)
+	}
+	return team, member, true
+}
+
+func (h *Handler) requireTeamManager(c *gin.Context) (*db.Team, bool) {
+	user := c.MustGet("user").(*db.User)
+
+	team, member, canView := h.teamAccess(c, user, c.Param("team"))
+	if !canView {
+		abortWithError(c, http.StatusNotFound, "team not found")
+		return nil, false
+	}
+
+	if !canManageTeam(user, member) {
+		abortWithError(c, http.StatusForbidden, "permission denied")
+		return nil, false
+	}
+
+	return team, true
+}
+
+func (h *Handler) isLastTeamOwner(c *gin.Context, team *db.Team, username string) bool {
+	members, err := h.Store.RetrieveTeamMembers(c, team.ID)
+	if err != nil {
+		return false
+	}
+
+	owners, isOwner := 0, false
+	for _, member := range members {
+		if member.Role == db.TeamRoleOwner {
+			owners++
+			isOwner = isOwner || member.Username == username
+		}
+	}
+	return isOwner && owners == 1
+}
+
+func canManageTeam(user *db.User, member *db.TeamMember) bool {
+	return user.Can(db.PermissionManageUsers) || (member != nil && member.Role.CanManageTeam())
+}
+
+func serializeTeam(team *db.Team) gin.H {
+	return gin.H{
+		"id":         team.ID,
+		"name":       team.Name,
+		"created_at": team.CreatedAt,
+	}
+}
@@ -8,7 +8,7 @@ import (
 	"github.com/salmanmorshed/simplelinkshortener/internal/cfg"
 )
 
-var badLinkIDs = []string{"", "api", "web", "favicon.ico"}
+var badLinkIDs = []string{"", "api", "web", "metrics", "healthz", "readyz", "favicon.ico"}
 
 func GetBaseURL(conf *cfg.Config) string {
 	if conf.URLPrefix != "" {